@@ -8,9 +8,12 @@ import (
 	"svimpass/internal/commands"
 	"svimpass/internal/crypto"
 	"svimpass/internal/database"
+	"svimpass/internal/hardening"
 	"svimpass/internal/hotkey"
+	"svimpass/internal/legacy"
 	"svimpass/internal/paths"
 	"svimpass/internal/services"
+	"svimpass/internal/session"
 	"svimpass/internal/systray"
 
 	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
@@ -26,7 +29,10 @@ type App struct {
 	db              *database.DB
 	authSvc         *services.AuthService
 	passwordSvc     *services.PasswordService
+	security        *hardening.Report    // Process protections applied at startup
 	hotkeyManager   hotkey.HotkeyManager // Platform-specific hotkey manager
+	sessionWatcher  session.Watcher      // Locks the vault on suspend and session lock
+	legacyImport    *legacy.Import       // Legacy vault waiting to be verified on unlock
 	isWindowVisible bool                 // Track window visibility state
 }
 
@@ -39,6 +45,14 @@ func NewApp() *App {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+
+	// Bring the config of older builds from the home directory into the XDG layout
+	legacyImport, err := legacy.Start(a.paths)
+	if err != nil {
+		fmt.Printf("Warning: failed to import legacy config: %v\n", err)
+	}
+	a.legacyImport = legacyImport
+
 	// Initialize master password manager with new paths
 	masterMgr, err := crypto.NewMasterPasswordManagerWithPaths(a.paths)
 	if err != nil {
@@ -47,16 +61,36 @@ func (a *App) startup(ctx context.Context) {
 	}
 
 	// Initialize database with new paths
-	db, err := database.NewDB(a.paths.Database())
+	db, err := database.NewDBWithBackupDir(a.paths.Database(), a.paths.BackupDir())
 	if err != nil {
 		fmt.Printf("Error initializing the db : %v", err)
 		return
 	}
 	a.db = db
 
+	// Re-encrypt the database whenever the master key changes
+	if err := masterMgr.AttachVault(db); err != nil {
+		fmt.Printf("Error attaching the vault: %v \n", err)
+		return
+	}
+
 	// Initialize services
 	a.authSvc = services.NewAuthService(masterMgr)
 	a.passwordSvc = services.NewPasswordService(db, a.authSvc)
+	a.authSvc.OnUnlock(a.finishLegacyImport)
+
+	// Send the frontend back to the unlock screen however the vault was locked
+	a.authSvc.OnLock(func() {
+		wailsruntime.EventsEmit(a.ctx, "locked")
+	})
+
+	// Lock as soon as the system suspends or the session is locked
+	watcher, err := session.Watch(a.authSvc.LockApp)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else {
+		a.sessionWatcher = watcher
+	}
 
 	// Initialize platform-specific hotkey manager
 	a.hotkeyManager = hotkey.NewManager()
@@ -75,6 +109,27 @@ func (a *App) startup(ctx context.Context) {
 	})
 }
 
+// finishLegacyImport archives the legacy config once the master password decrypted
+// every entry of the database, the unlock fails if one cannot be decrypted
+func (a *App) finishLegacyImport(encKey *crypto.EncryptionKey) error {
+	if a.legacyImport == nil {
+		return nil
+	}
+
+	var count int
+	dir, err := a.legacyImport.Finish(func() (err error) {
+		count, err = a.passwordSvc.VerifyEntries(encKey)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Verified %d entries, legacy config archived in %s\n", count, dir)
+	a.legacyImport = nil
+	return nil
+}
+
 // QuitApp handles application quit with proper cleanup
 func (a *App) QuitApp() {
 	if a.ctx != nil {
@@ -90,6 +145,11 @@ func (a *App) OnShutdown(ctx context.Context) {
 		a.hotkeyManager.Stop()
 	}
 
+	// Stop watching the session
+	if a.sessionWatcher != nil {
+		a.sessionWatcher.Stop()
+	}
+
 	// Close database
 	if a.db != nil {
 		a.db.Close()
@@ -106,15 +166,65 @@ func (a *App) IsInitialized() bool {
 	return a.authSvc.IsInitialized()
 }
 
-// SetupMasterPassword sets up the master password for first time
-func (a *App) SetupMasterPassword(password, confirmPassword string) error {
-	return a.authSvc.SetupMasterPassword(password, confirmPassword)
+// SetupMasterPassword sets up the master password for first time, an empty
+// keyfile path means the master password alone unlocks the vault
+func (a *App) SetupMasterPassword(password, confirmPassword, keyfilePath string) error {
+	return a.authSvc.SetupMasterPassword(password, confirmPassword, keyfilePath)
+}
+
+// CheckPasswordStrength rates a candidate master password for the setup screen
+func (a *App) CheckPasswordStrength(password string) services.PasswordStrengthResponse {
+	return a.authSvc.CheckPasswordStrength(password)
+}
+
+// RequiredKeyfile returns where the keyfile required to unlock is expected, if any
+func (a *App) RequiredKeyfile() string {
+	return a.authSvc.RequiredKeyfile()
 }
 
 func (a *App) UnlockApp(password string) error {
 	return a.authSvc.UnlockApp(password)
 }
 
+// UnlockWithPIN unlocks the app with the quick unlock PIN set by :pin
+func (a *App) UnlockWithPIN(pin string) error {
+	return a.authSvc.UnlockWithPIN(pin)
+}
+
+// QuickUnlockAvailable reports whether a PIN can unlock the app instead of the master password
+func (a *App) QuickUnlockAvailable() bool {
+	return !a.authSvc.QuickUnlockExpiry().IsZero()
+}
+
+// ChangeMasterPassword replaces the vault key, protected by the new master password only,
+// and locks the app
+func (a *App) ChangeMasterPassword(oldPassword, newPassword, confirmPassword string) error {
+	_, err := a.authSvc.ChangeMasterPassword(oldPassword, newPassword, confirmPassword)
+	return err
+}
+
+// UnlockWithRecoveryKey accepts a recovery key instead of the master password, the app
+// unlocks once CompleteRecovery has set a new master password
+func (a *App) UnlockWithRecoveryKey(recoveryKey string) error {
+	return a.authSvc.UnlockWithRecoveryKey(recoveryKey)
+}
+
+// UnlockWithShares accepts enough Shamir shares instead of the master password, the app
+// unlocks once CompleteRecovery has set a new master password
+func (a *App) UnlockWithShares(shares []string) error {
+	return a.authSvc.UnlockWithShares(shares)
+}
+
+// CompleteRecovery sets a new master password after a recovery key or shares were accepted
+func (a *App) CompleteRecovery(newPassword, confirmPassword string) error {
+	return a.authSvc.CompleteRecovery(newPassword, confirmPassword)
+}
+
+// UnlockWithKeyfile unlocks the app with a keyfile instead of the master password
+func (a *App) UnlockWithKeyfile(path string) error {
+	return a.authSvc.UnlockWithKeyfile(path)
+}
+
 func (a *App) LockApp() {
 	a.authSvc.LockApp()
 }
@@ -140,8 +250,36 @@ func (a *App) GenerateAndSavePassword(req services.CreatePasswordRequest) (strin
 	return a.passwordSvc.GenerateAndSavePassword(req)
 }
 
+// GetPassword hands a password to the frontend, the only place it becomes a string
 func (a *App) GetPassword(id int) (string, error) {
-	return a.passwordSvc.GetPassword(id)
+	password, err := a.passwordSvc.GetPassword(id)
+	if err != nil {
+		return "", err
+	}
+	defer password.Destroy()
+
+	return password.Reveal()
+}
+
+// GetField hands the value of a custom field to the frontend, concealed values
+// are only read through here
+func (a *App) GetField(id int, name string) (string, error) {
+	value, err := a.passwordSvc.GetField(id, name)
+	if err != nil {
+		return "", err
+	}
+	defer value.Destroy()
+
+	return value.Reveal()
+}
+
+// SetField adds a custom field to an entry or replaces the field of the same name
+func (a *App) SetField(id int, field services.CustomField) error {
+	return a.passwordSvc.SetField(id, field)
+}
+
+func (a *App) RemoveField(id int, name string) error {
+	return a.passwordSvc.RemoveField(id, name)
 }
 
 func (a *App) CreatePassword(req services.CreatePasswordRequest) error {
@@ -156,6 +294,12 @@ func (a *App) UpdatePassword(id int, newpassword string) error {
 	return a.passwordSvc.UpdatePasswordEntry(id, newpassword)
 }
 
+// UpdateEntry applies a partial update to an entry, refused if the entry changed
+// after patch.UpdatedAt
+func (a *App) UpdateEntry(id int, patch services.UpdateEntryRequest) (*services.PasswordEntryResponse, error) {
+	return a.passwordSvc.UpdateEntry(id, patch)
+}
+
 func (a *App) ToggleWindow() {
 	if a.ctx == nil {
 		fmt.Println("Context is nil in ToggleWindow!")
@@ -278,7 +422,8 @@ func (a *App) TestConnection() string {
 
 // ExecuteCommand parses and executes user commands
 func (a *App) ExecuteCommand(input string) (any, error) {
-	cmd, err := commands.ParseCommand(input, a.passwordSvc, a.paths)
+	a.authSvc.Touch()
+	cmd, err := commands.ParseCommand(input, a.authSvc, a.passwordSvc, a.paths, a.security)
 	if err != nil {
 		return nil, err
 	}
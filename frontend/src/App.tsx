@@ -3,6 +3,7 @@ import './App.css';
 import LoginScreen from './components/LoginScreen';
 import MainScreen from './components/MainScreen';
 import { IsUnlocked } from '../wailsjs/go/main/App';
+import { EventsOn } from '../wailsjs/runtime/runtime';
 
 function App() {
   const [isLoggedIn, setIsLoggedIn] = useState(false);
@@ -10,6 +11,12 @@ function App() {
 
   useEffect(() => {
     checkAuthStatus();
+
+    // The backend locks on idle timeout, suspend and session lock
+    const cleanup = EventsOn('locked', () => {
+      setIsLoggedIn(false);
+    });
+    return cleanup;
   }, []);
 
   const checkAuthStatus = async () => {
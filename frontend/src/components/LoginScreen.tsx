@@ -1,16 +1,50 @@
 import React, { useState, useEffect, useRef } from 'react';
-import { IsInitialized, SetupMasterPassword, UnlockApp, HideSpotlight } from '../../wailsjs/go/main/App';
+import {
+  IsInitialized,
+  SetupMasterPassword,
+  UnlockApp,
+  HideSpotlight,
+  RequiredKeyfile,
+  UnlockWithRecoveryKey,
+  UnlockWithShares,
+  CompleteRecovery,
+  CheckPasswordStrength,
+  QuickUnlockAvailable,
+  UnlockWithPIN,
+  ExecuteCommand,
+} from '../../wailsjs/go/main/App';
 
 interface LoginScreenProps {
   onLogin: () => void;
 }
 
+// Setup walks through password, confirm, keyfile and kit. Unlocking uses pin while a
+// quick unlock PIN is set, password, or recoveryKey (recovery words or key shares)
+// followed by a new master password when Tab switches to recovery.
+type Step = 'pin' | 'password' | 'confirm' | 'keyfile' | 'kit' | 'recoveryKey' | 'newPassword' | 'confirmNew';
+
+const placeholders: Record<Step, string> = {
+  pin: 'Enter PIN (Tab for master password)',
+  password: 'Create Master Password',
+  confirm: 'Confirm Master Password',
+  keyfile: 'Keyfile path (optional, Enter to skip)',
+  kit: 'Recovery kit path, e.g. /media/usb/kit.html (optional, Enter to skip)',
+  recoveryKey: 'Enter Recovery Key words or key shares (Tab for master password)',
+  newPassword: 'Recovery accepted, create a new Master Password',
+  confirmNew: 'Confirm new Master Password',
+};
+
 export default function LoginScreen({ onLogin }: LoginScreenProps) {
   const [password, setPassword] = useState('');
   const [confirmPassword, setConfirmPassword] = useState('');
+  const [keyfilePath, setKeyfilePath] = useState('');
+  const [kitPath, setKitPath] = useState('');
+  const [recoveryKey, setRecoveryKey] = useState('');
+  const [requiredKeyfile, setRequiredKeyfile] = useState('');
+  const [quickUnlock, setQuickUnlock] = useState(false);
   const [isSetup, setIsSetup] = useState(false);
   const [loading, setLoading] = useState(true);
-  const [currentStep, setCurrentStep] = useState<'password' | 'confirm'>('password');
+  const [currentStep, setCurrentStep] = useState<Step>('password');
   const [placeholder, setPlaceholder] = useState('');
   const inputRef = useRef<HTMLInputElement>(null);
 
@@ -29,21 +63,50 @@ export default function LoginScreen({ onLogin }: LoginScreenProps) {
     // Update placeholder based on current state
     if (loading) {
       setPlaceholder('Initializing...');
-    } else if (isSetup) {
-      if (currentStep === 'password') {
-        setPlaceholder('Create Master Password');
-      } else {
-        setPlaceholder('Confirm Master Password');
-      }
+    } else if (!isSetup && currentStep === 'password') {
+      setPlaceholder(unlockPlaceholder());
     } else {
-      setPlaceholder('Enter Master Password');
+      setPlaceholder(placeholders[currentStep]);
+    }
+  }, [loading, isSetup, currentStep, requiredKeyfile]);
+
+  const unlockPlaceholder = () => {
+    if (requiredKeyfile) {
+      return `Enter Master Password (keyfile: ${requiredKeyfile})`;
+    }
+    return 'Enter Master Password (Tab for recovery key)';
+  };
+
+  // strengthError returns why a candidate master password is rejected, or '' if it is strong enough
+  const strengthError = async (candidate: string) => {
+    const result = await CheckPasswordStrength(candidate);
+    if (result.acceptable) {
+      return '';
     }
-  }, [loading, isSetup, currentStep]);
+    return `Too weak (${result.score}/${result.maxScore}): ${result.feedback.join(', ')}`;
+  };
+
+  // showError shows a message in place of the placeholder, then restores it
+  const showError = (message: string, restore: string) => {
+    setPlaceholder(message);
+    setTimeout(() => setPlaceholder(restore), 2000);
+    setTimeout(() => {
+      if (inputRef.current) {
+        inputRef.current.focus();
+      }
+    }, 100);
+  };
 
   const checkInitialization = async () => {
     try {
       const initialized = await IsInitialized();
       setIsSetup(!initialized);
+      if (initialized) {
+        setRequiredKeyfile(await RequiredKeyfile());
+        const pinAvailable = await QuickUnlockAvailable();
+        setQuickUnlock(pinAvailable);
+        setCurrentStep(pinAvailable ? 'pin' : 'password');
+      }
       setLoading(false);
     } catch (err) {
       setPlaceholder('Failed to initialize');
@@ -68,10 +131,16 @@ export default function LoginScreen({ onLogin }: LoginScreenProps) {
           setTimeout(() => setPlaceholder('Create Master Password'), 2000);
           return;
         }
+        const weak = await strengthError(password);
+        if (weak) {
+          setPassword('');
+          showError(weak, placeholders.password);
+          return;
+        }
         // Move to confirmation step
         setCurrentStep('confirm');
         return;
-      } else {
+      } else if (currentStep === 'confirm') {
         // Confirm step
         if (confirmPassword.length < 1) {
           setPlaceholder('Please confirm password');
@@ -84,21 +153,99 @@ export default function LoginScreen({ onLogin }: LoginScreenProps) {
           setTimeout(() => setPlaceholder('Confirm Master Password'), 2000);
           return;
         }
-
+        // Move to the optional keyfile step
+        setCurrentStep('keyfile');
+        return;
+      } else if (currentStep === 'keyfile') {
+        // Keyfile step, an empty path means no keyfile is required
+        try {
+          await SetupMasterPassword(password, confirmPassword, keyfilePath.trim());
+          setPassword('');
+          setConfirmPassword('');
+          // The vault exists from here on, offer the optional recovery kit
+          setCurrentStep('kit');
+        } catch (err) {
+          setKeyfilePath('');
+          showError(`Failed to setup master password: ${err}`, placeholders.keyfile);
+        }
+      } else {
+        // Recovery kit step, an empty path skips the recovery key
+        if (kitPath.trim() === '') {
+          onLogin();
+          return;
+        }
         try {
-          await SetupMasterPassword(password, confirmPassword);
+          await ExecuteCommand(`:recovery-kit ${kitPath.trim()}`);
           onLogin();
         } catch (err) {
-          setPlaceholder('Failed to setup master password');
-          setConfirmPassword('');
-          setTimeout(() => setPlaceholder('Confirm Master Password'), 2000);
-          setTimeout(() => {
-            if (inputRef.current) {
-              inputRef.current.focus();
-            }
-          }, 100);
+          setKitPath('');
+          showError(String(err), placeholders.kit);
         }
       }
+    } else if (currentStep === 'pin') {
+      if (password.length < 1) {
+        showError('PIN cannot be empty', placeholders.pin);
+        return;
+      }
+      try {
+        await UnlockWithPIN(password);
+        onLogin();
+      } catch (err) {
+        setPassword('');
+        const message = String(err);
+        if (message.includes('master password')) {
+          // The PIN expired or was discarded after too many wrong attempts,
+          // switch to the master password once the message has been shown
+          setQuickUnlock(false);
+          showError(message, placeholders.pin);
+          setTimeout(() => setCurrentStep('password'), 2000);
+        } else {
+          showError(message, placeholders.pin);
+        }
+      }
+    } else if (currentStep === 'recoveryKey') {
+      if (recoveryKey.trim() === '') {
+        showError('Recovery key cannot be empty', placeholders.recoveryKey);
+        return;
+      }
+      try {
+        // Key shares from :split-key are pasted separated by spaces
+        const input = recoveryKey.trim();
+        if (input.startsWith('svimpass-share:')) {
+          await UnlockWithShares(input.split(/\s+/));
+        } else {
+          await UnlockWithRecoveryKey(recoveryKey);
+        }
+        setRecoveryKey('');
+        setCurrentStep('newPassword');
+      } catch (err) {
+        showError(String(err), placeholders.recoveryKey);
+      }
+    } else if (currentStep === 'newPassword') {
+      if (password.length < 1) {
+        showError('Password cannot be empty', placeholders.newPassword);
+        return;
+      }
+      const weak = await strengthError(password);
+      if (weak) {
+        setPassword('');
+        showError(weak, placeholders.newPassword);
+        return;
+      }
+      setCurrentStep('confirmNew');
+    } else if (currentStep === 'confirmNew') {
+      if (password !== confirmPassword) {
+        setConfirmPassword('');
+        showError('Passwords do not match', placeholders.confirmNew);
+        return;
+      }
+      try {
+        await CompleteRecovery(password, confirmPassword);
+        onLogin();
+      } catch (err) {
+        setConfirmPassword('');
+        showError(String(err), placeholders.confirmNew);
+      }
     } else {
       // Login mode
       if (password.length < 1) {
@@ -111,9 +258,18 @@ export default function LoginScreen({ onLogin }: LoginScreenProps) {
         await UnlockApp(password);
         onLogin();
       } catch (err) {
-        setPlaceholder('Wrong Master Password');
+        // Keyfile errors say which file is missing or wrong, throttling errors
+        // say when to try again
+        const message = String(err);
+        const throttled = message.includes('too many failed attempts');
+        setPlaceholder(requiredKeyfile || throttled ? message : 'Wrong Master Password');
         setPassword('');
-        setTimeout(() => setPlaceholder('Enter Master Password'), 2000);
+        if (message.includes('has been wiped')) {
+          // The lockout policy destroyed the vault, start over with setup
+          setTimeout(checkInitialization, 2000);
+          return;
+        }
+        setTimeout(() => setPlaceholder(unlockPlaceholder()), 2000);
         // Re-focus the input after clearing
         setTimeout(() => {
           if (inputRef.current) {
@@ -128,8 +284,30 @@ export default function LoginScreen({ onLogin }: LoginScreenProps) {
     if (e.key === 'Enter') {
       e.preventDefault();
       handleSubmit();
+    } else if (e.key === 'Tab' && !isSetup && currentStep === 'pin') {
+      // Fall back to the master password
+      e.preventDefault();
+      setPassword('');
+      setCurrentStep('password');
+    } else if (e.key === 'Tab' && !isSetup && (currentStep === 'password' || currentStep === 'recoveryKey')) {
+      // Switch between the master password and the recovery key
+      e.preventDefault();
+      setPassword('');
+      setRecoveryKey('');
+      setCurrentStep(currentStep === 'password' ? 'recoveryKey' : 'password');
     } else if (e.key === 'Escape') {
-      if (isSetup && currentStep === 'confirm') {
+      if (isSetup && currentStep === 'kit') {
+        // The vault is already set up, skip the recovery kit
+        onLogin();
+      } else if (currentStep === 'confirmNew') {
+        // Go back to the new password step
+        setCurrentStep('newPassword');
+        setConfirmPassword('');
+      } else if (isSetup && currentStep === 'keyfile') {
+        // Go back to confirm step
+        setCurrentStep('confirm');
+        setKeyfilePath('');
+      } else if (isSetup && currentStep === 'confirm') {
         // Go back to password step
         setCurrentStep('password');
         setConfirmPassword('');
@@ -137,7 +315,9 @@ export default function LoginScreen({ onLogin }: LoginScreenProps) {
         // Clear UI state
         setPassword('');
         setConfirmPassword('');
-        setCurrentStep('password');
+        setKeyfilePath('');
+        setRecoveryKey('');
+        setCurrentStep(quickUnlock ? 'pin' : 'password');
         
         // Hide the window (same behavior as MainScreen)
         try {
@@ -151,7 +331,13 @@ export default function LoginScreen({ onLogin }: LoginScreenProps) {
 
   const handleInputChange = (e: React.ChangeEvent<HTMLInputElement>) => {
     const value = e.target.value;
-    if (isSetup && currentStep === 'confirm') {
+    if (currentStep === 'keyfile') {
+      setKeyfilePath(value);
+    } else if (currentStep === 'kit') {
+      setKitPath(value);
+    } else if (currentStep === 'recoveryKey') {
+      setRecoveryKey(value);
+    } else if (currentStep === 'confirm' || currentStep === 'confirmNew') {
       setConfirmPassword(value);
     } else {
       setPassword(value);
@@ -159,7 +345,16 @@ export default function LoginScreen({ onLogin }: LoginScreenProps) {
   };
 
   const getCurrentValue = () => {
-    if (isSetup && currentStep === 'confirm') {
+    if (currentStep === 'keyfile') {
+      return keyfilePath;
+    }
+    if (currentStep === 'kit') {
+      return kitPath;
+    }
+    if (currentStep === 'recoveryKey') {
+      return recoveryKey;
+    }
+    if (currentStep === 'confirm' || currentStep === 'confirmNew') {
       return confirmPassword;
     }
     return password;
@@ -170,7 +365,7 @@ export default function LoginScreen({ onLogin }: LoginScreenProps) {
       <div className="search-container">
         <input
           ref={inputRef}
-          type="password"
+          type={currentStep === 'keyfile' || currentStep === 'kit' ? 'text' : 'password'}
           value={getCurrentValue()}
           onChange={handleInputChange}
           onKeyDown={handleKeyDown}
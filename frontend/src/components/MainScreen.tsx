@@ -49,9 +49,9 @@ const HELP_COMMANDS: PasswordEntry[] = [
     },
     {
         id: 4,
-        serviceName: ":export",
+        serviceName: ":export [#tag ...]",
         username: "Export all passwords",
-        notes: "Export all passwords to CSV file",
+        notes: "Export all passwords to CSV file, or only the entries carrying every tag given",
         createdAt: "",
         updatedAt: "",
     },
@@ -67,7 +67,7 @@ const HELP_COMMANDS: PasswordEntry[] = [
         id: 6,
         serviceName: "Ctrl+D",
         username: "Delete selected entry",
-        notes: "Delete the currently selected password entry",
+        notes: "Move the currently selected password entry to the trash",
         createdAt: "",
         updatedAt: "",
     },
@@ -87,6 +87,94 @@ const HELP_COMMANDS: PasswordEntry[] = [
         createdAt: "",
         updatedAt: "",
     },
+    {
+        id: 9,
+        serviceName: ":passwd old;new;confirm",
+        username: "Change master password",
+        notes: "Backs up the vault and re-encrypts every entry",
+        createdAt: "",
+        updatedAt: "",
+    },
+    {
+        id: 10,
+        serviceName: ":keyslot list",
+        username: "Manage key slots",
+        notes: ":keyslot add recovery|keyfile /path|password secret, :keyslot remove id",
+        createdAt: "",
+        updatedAt: "",
+    },
+    {
+        id: 11,
+        serviceName: ":kdf",
+        username: "Show key derivation settings",
+        notes: "Use :kdf master;time=N;memory=NMiB;threads=N to raise them",
+        createdAt: "",
+        updatedAt: "",
+    },
+    {
+        id: 12,
+        serviceName: ":edit id|query field=value;field=value",
+        username: "Edit an entry",
+        notes: "Fields: service, username, password, notes",
+        createdAt: "",
+        updatedAt: "",
+    },
+    {
+        id: 13,
+        serviceName: ":history id|query",
+        username: "Show previous passwords",
+        notes: ":history id|query reveal N copies version N, :history id|query rollback [N] restores it",
+        createdAt: "",
+        updatedAt: "",
+    },
+    {
+        id: 14,
+        serviceName: ":trash",
+        username: "Show deleted entries",
+        notes: ":restore id brings one back, :purge empties the trash, :trash-days N sets when they are purged",
+        createdAt: "",
+        updatedAt: "",
+    },
+    {
+        id: 15,
+        serviceName: ":field id|query",
+        username: "Show custom fields",
+        notes: "set name=value, conceal name=value for secrets, reveal name copies it, remove name",
+        createdAt: "",
+        updatedAt: "",
+    },
+    {
+        id: 16,
+        serviceName: ":add type:...",
+        username: "Add a note, card, identity or API token",
+        notes: "note:title;text, card:name;cardholder;MM/YY;cvv, identity:title;name;email;phone;address, token:service;key id;YYYY-MM-DD;notes",
+        createdAt: "",
+        updatedAt: "",
+    },
+    {
+        id: 17,
+        serviceName: ":tag name id|query",
+        username: "Tag entries",
+        notes: "A query tags every entry it matches, :untag name id|query removes the tag, :tags lists them, search with #name",
+        createdAt: "",
+        updatedAt: "",
+    },
+    {
+        id: 18,
+        serviceName: "user:me notes:\"two words\" -bank",
+        username: "Search with qualifiers",
+        notes: "service: user: notes: url: tag: type: updated:>90d created:<2024-01-01, -term or NOT term, a OR b, @name recalls a saved query",
+        createdAt: "",
+        updatedAt: "",
+    },
+    {
+        id: 19,
+        serviceName: ":query save name query",
+        username: "Save a search",
+        notes: "Recall it as @name while searching, :query lists saved searches, :query remove name deletes one",
+        createdAt: "",
+        updatedAt: "",
+    },
 ];
 
 interface MainScreenProps {
@@ -174,15 +262,35 @@ export default function MainScreen({ onLogout }: MainScreenProps) {
                 );
             } else {
                 setPlaceholder(
-                    `Enter password for ${passwordEntryState.serviceName}...`,
+                    `Enter ${passwordEntryState.prompt || "password"} for ${passwordEntryState.serviceName}...`,
                 );
             }
+        } else if (input.startsWith(":edit")) {
+            setPlaceholder(":edit id|query service=...;username=...;password=...;notes=...");
+        } else if (input.startsWith(":history")) {
+            setPlaceholder(":history id|query [reveal N | rollback [N]]");
+        } else if (input.startsWith(":field")) {
+            setPlaceholder(":field id|query [set name=value | conceal name=value | reveal name | remove name]");
+        } else if (input.startsWith(":tags")) {
+            setPlaceholder(":tags lists the tags in use");
+        } else if (input.startsWith(":tag")) {
+            setPlaceholder(":tag name id|query, a query tags every entry it matches");
+        } else if (input.startsWith(":untag")) {
+            setPlaceholder(":untag name id|query");
+        } else if (input.startsWith(":query")) {
+            setPlaceholder(":query [save name query | remove name]");
+        } else if (input.startsWith(":export")) {
+            setPlaceholder(":export [#tag ...]");
+        } else if (input.startsWith(":restore")) {
+            setPlaceholder(":restore id, see :trash for the ids");
+        } else if (input.startsWith(":trash-days")) {
+            setPlaceholder(":trash-days [days, 0 keeps entries until :purge]");
         } else if (input.startsWith(":import")) {
             setPlaceholder(":import /absolute/path/to/passwords.csv");
         } else if (input.startsWith(":addgen")) {
             setPlaceholder(":addgen service;username;notes");
         } else if (input.startsWith(":add")) {
-            setPlaceholder(":add service;username;notes");
+            setPlaceholder(":add [note:|card:|identity:|token:]service;username;notes");
         } else if (input.startsWith(":help")) {
             setPlaceholder("Select a command from the help list below");
         } else {
@@ -192,6 +300,7 @@ export default function MainScreen({ onLogout }: MainScreenProps) {
         passwordEntryState.isActive,
         passwordEntryState.editingId,
         passwordEntryState.serviceName,
+        passwordEntryState.prompt,
         input,
         isShowingMessage,
     ]);
@@ -349,6 +458,7 @@ export default function MainScreen({ onLogout }: MainScreenProps) {
                 } else {
                     // Create new password (existing logic)
                     const request = new CreatePasswordRequest({
+                        ...passwordEntryState.request,
                         serviceName: passwordEntryState.serviceName,
                         username: passwordEntryState.username,
                         password: input,
@@ -415,32 +525,40 @@ export default function MainScreen({ onLogout }: MainScreenProps) {
 
             // Frontend validation for :add command without arguments
             if (lowerInput === ":add") {
-                showMessage("usage: :add service;username;notes");
+                showMessage("usage: :add [type:]service;username;notes");
                 return;
             }
 
-            // Special case: :add command - parse in frontend and switch to password entry mode
+            // Special case: :add command - parsed by the backend, which hands the entry
+            // back when it still needs its secret; switch to password entry mode for it
             if (lowerInput.startsWith(":add ") && !lowerInput.startsWith(":addgen")) {
-                const args = trimmedInput.slice(5); // Remove ':add '
-                const parts = args.split(";").map((p) => p.trim());
-
-                if (parts.length < 2 || !parts[0] || !parts[1]) {
-                    showMessage("usage: :add service;username;notes");
-                    return;
+                try {
+                    setIsLoading(true);
+                    const result = await ExecuteCommand(trimmedInput);
+
+                    if (result && typeof result === "object" && result.request) {
+                        const request = new CreatePasswordRequest(result.request);
+                        setPasswordEntryState({
+                            isActive: true,
+                            serviceName: request.serviceName,
+                            username: request.username || "",
+                            notes: request.notes || "",
+                            showPassword: false,
+                            request,
+                            prompt: result.prompt,
+                        });
+                        setInput("");
+                        setShowDropdown(false);
+                        setResults([]);
+                        navigation.reset();
+                    } else if (typeof result === "string") {
+                        showMessage(result);
+                    }
+                } catch (error) {
+                    showMessage(String(error));
+                } finally {
+                    setIsLoading(false);
                 }
-
-                // Switch to password entry mode
-                setPasswordEntryState({
-                    isActive: true,
-                    serviceName: parts[0],
-                    username: parts[1],
-                    notes: parts[2] || "",
-                    showPassword: false,
-                });
-                setInput("");
-                setShowDropdown(false);
-                setResults([]);
-                navigation.reset();
                 return;
             }
 
@@ -456,6 +574,16 @@ export default function MainScreen({ onLogout }: MainScreenProps) {
                     }
                     setInput("");
                     await HideSpotlight();
+                } else if (lowerInput.startsWith(":history") && / reveal /.test(lowerInput)) {
+                    if (result) {
+                        await navigator.clipboard.writeText(result);
+                    }
+                    showMessage("Previous password copied to clipboard");
+                } else if (/^:field \S+ reveal /.test(lowerInput)) {
+                    if (result) {
+                        await navigator.clipboard.writeText(result);
+                    }
+                    showMessage("Field copied to clipboard");
                 } else if (lowerInput.startsWith(":import")) {
                     showMessage(`Successfully imported ${result} passwords`);
                 } else if (lowerInput.startsWith(":export")) {
@@ -483,7 +611,7 @@ export default function MainScreen({ onLogout }: MainScreenProps) {
             try {
                 const entry = results.find((r) => r.id === id);
                 await DeletePassword(id);
-                showMessage(`Deleted ${entry?.serviceName || "entry"}`);
+                showMessage(`Moved ${entry?.serviceName || "entry"} to the trash`);
 
                 // Refresh results
                 if (input.trim() && isSearchMode()) {
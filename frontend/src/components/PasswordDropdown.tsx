@@ -13,6 +13,26 @@ interface PasswordDropdownProps {
   onDelete: (id: number) => Promise<void>;
 }
 
+// Marks the ranges the search matched in one field of an entry. Offsets count
+// code points, so the text is split with Array.from rather than sliced.
+function highlight(text: string, field: string, highlights: PasswordEntry['highlights']) {
+  const ranges = (highlights || []).filter((h) => h.field === field);
+  if (ranges.length === 0) {
+    return text;
+  }
+
+  const chars = Array.from(text);
+  const parts: React.ReactNode[] = [];
+  let last = 0;
+  ranges.forEach((range, i) => {
+    parts.push(chars.slice(last, range.start).join(''));
+    parts.push(<mark key={i}>{chars.slice(range.start, range.end).join('')}</mark>);
+    last = range.end;
+  });
+  parts.push(chars.slice(last).join(''));
+  return parts;
+}
+
 export default function PasswordDropdown({ 
   results, 
   navigation,
@@ -83,12 +103,24 @@ export default function PasswordDropdown({
             {...navigation.getItemProps(index)}
           >
             <div className="entry-main">
-              <div className="service-name">{entry.serviceName}</div>
-              <div className="username">{entry.username}</div>
+              <div className="service-name">{highlight(entry.serviceName, 'serviceName', entry.highlights)}</div>
+              <div className="username">
+                {entry.summary || highlight(entry.username, 'username', entry.highlights)}
+              </div>
             </div>
             
             <div className="entry-details">
-              <div className="notes">{entry.notes || ''}</div>
+              <div className="notes">{highlight(entry.notes || '', 'notes', entry.highlights)}</div>
+              {entry.fields && entry.fields.length > 0 && (
+                <div className="fields">
+                  {entry.fields.map((field) => field.name).join(' · ')}
+                </div>
+              )}
+              {entry.tags && entry.tags.length > 0 && (
+                <div className="tags">
+                  {entry.tags.map((tag) => `#${tag}`).join(' ')}
+                </div>
+              )}
             </div>
             
             <div className="entry-actions">
@@ -1,7 +1,8 @@
 // TypeScript interfaces for the password manager
 import { services } from "../wailsjs/go/models";
 
-export type PasswordEntry = services.PasswordEntryResponse;
+// Help entries are written as plain objects, so the generated helper is left out
+export type PasswordEntry = Omit<services.PasswordEntryResponse, "convertValues">;
 
 export interface PasswordEntryState {
     isActive: boolean;
@@ -10,4 +11,7 @@ export interface PasswordEntryState {
     notes: string;
     showPassword: boolean;
     editingId?: number;
+    // New entry from :add waiting for its secret, and what the secret is called
+    request?: services.CreatePasswordRequest;
+    prompt?: string;
 }
@@ -3,6 +3,12 @@
 import {services} from '../models';
 import {context} from '../models';
 
+export function ChangeMasterPassword(arg1:string,arg2:string,arg3:string):Promise<void>;
+
+export function CheckPasswordStrength(arg1:string):Promise<services.PasswordStrengthResponse>;
+
+export function CompleteRecovery(arg1:string,arg2:string):Promise<void>;
+
 export function CreatePassword(arg1:services.CreatePasswordRequest):Promise<void>;
 
 export function DeletePassword(arg1:number):Promise<void>;
@@ -15,6 +21,8 @@ export function GenerateAndSavePassword(arg1:services.CreatePasswordRequest):Pro
 
 export function GeneratePassword():Promise<string>;
 
+export function GetField(arg1:number,arg2:string):Promise<string>;
+
 export function GetPassword(arg1:number):Promise<string>;
 
 export function Greet(arg1:string):Promise<string>;
@@ -31,17 +39,25 @@ export function LockApp():Promise<void>;
 
 export function OnShutdown(arg1:context.Context):Promise<void>;
 
+export function QuickUnlockAvailable():Promise<boolean>;
+
 export function QuitApp():Promise<void>;
 
+export function RemoveField(arg1:number,arg2:string):Promise<void>;
+
+export function RequiredKeyfile():Promise<string>;
+
 export function ResizeWindow(arg1:number,arg2:number):Promise<void>;
 
 export function SearchPasswords(arg1:string):Promise<Array<services.PasswordEntryResponse>>;
 
+export function SetField(arg1:number,arg2:services.CustomField):Promise<void>;
+
 export function SetWindowCollapsed():Promise<void>;
 
 export function SetWindowExpanded():Promise<void>;
 
-export function SetupMasterPassword(arg1:string,arg2:string):Promise<void>;
+export function SetupMasterPassword(arg1:string,arg2:string,arg3:string):Promise<void>;
 
 export function ShowSpotlight():Promise<void>;
 
@@ -55,4 +71,14 @@ export function ToggleWindowVisibility():Promise<void>;
 
 export function UnlockApp(arg1:string):Promise<void>;
 
+export function UnlockWithKeyfile(arg1:string):Promise<void>;
+
+export function UnlockWithPIN(arg1:string):Promise<void>;
+
+export function UnlockWithRecoveryKey(arg1:string):Promise<void>;
+
+export function UnlockWithShares(arg1:Array<string>):Promise<void>;
+
+export function UpdateEntry(arg1:number,arg2:services.UpdateEntryRequest):Promise<services.PasswordEntryResponse>;
+
 export function UpdatePassword(arg1:number,arg2:string):Promise<void>;
@@ -2,6 +2,18 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ChangeMasterPassword(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ChangeMasterPassword'](arg1, arg2, arg3);
+}
+
+export function CheckPasswordStrength(arg1) {
+  return window['go']['main']['App']['CheckPasswordStrength'](arg1);
+}
+
+export function CompleteRecovery(arg1, arg2) {
+  return window['go']['main']['App']['CompleteRecovery'](arg1, arg2);
+}
+
 export function CreatePassword(arg1) {
   return window['go']['main']['App']['CreatePassword'](arg1);
 }
@@ -26,6 +38,10 @@ export function GeneratePassword() {
   return window['go']['main']['App']['GeneratePassword']();
 }
 
+export function GetField(arg1, arg2) {
+  return window['go']['main']['App']['GetField'](arg1, arg2);
+}
+
 export function GetPassword(arg1) {
   return window['go']['main']['App']['GetPassword'](arg1);
 }
@@ -58,10 +74,22 @@ export function OnShutdown(arg1) {
   return window['go']['main']['App']['OnShutdown'](arg1);
 }
 
+export function QuickUnlockAvailable() {
+  return window['go']['main']['App']['QuickUnlockAvailable']();
+}
+
 export function QuitApp() {
   return window['go']['main']['App']['QuitApp']();
 }
 
+export function RemoveField(arg1, arg2) {
+  return window['go']['main']['App']['RemoveField'](arg1, arg2);
+}
+
+export function RequiredKeyfile() {
+  return window['go']['main']['App']['RequiredKeyfile']();
+}
+
 export function ResizeWindow(arg1, arg2) {
   return window['go']['main']['App']['ResizeWindow'](arg1, arg2);
 }
@@ -70,6 +98,10 @@ export function SearchPasswords(arg1) {
   return window['go']['main']['App']['SearchPasswords'](arg1);
 }
 
+export function SetField(arg1, arg2) {
+  return window['go']['main']['App']['SetField'](arg1, arg2);
+}
+
 export function SetWindowCollapsed() {
   return window['go']['main']['App']['SetWindowCollapsed']();
 }
@@ -78,8 +110,8 @@ export function SetWindowExpanded() {
   return window['go']['main']['App']['SetWindowExpanded']();
 }
 
-export function SetupMasterPassword(arg1, arg2) {
-  return window['go']['main']['App']['SetupMasterPassword'](arg1, arg2);
+export function SetupMasterPassword(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SetupMasterPassword'](arg1, arg2, arg3);
 }
 
 export function ShowSpotlight() {
@@ -106,6 +138,26 @@ export function UnlockApp(arg1) {
   return window['go']['main']['App']['UnlockApp'](arg1);
 }
 
+export function UnlockWithKeyfile(arg1) {
+  return window['go']['main']['App']['UnlockWithKeyfile'](arg1);
+}
+
+export function UnlockWithPIN(arg1) {
+  return window['go']['main']['App']['UnlockWithPIN'](arg1);
+}
+
+export function UnlockWithRecoveryKey(arg1) {
+  return window['go']['main']['App']['UnlockWithRecoveryKey'](arg1);
+}
+
+export function UnlockWithShares(arg1) {
+  return window['go']['main']['App']['UnlockWithShares'](arg1);
+}
+
+export function UpdateEntry(arg1, arg2) {
+  return window['go']['main']['App']['UpdateEntry'](arg1, arg2);
+}
+
 export function UpdatePassword(arg1, arg2) {
   return window['go']['main']['App']['UpdatePassword'](arg1, arg2);
 }
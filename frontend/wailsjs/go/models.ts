@@ -1,10 +1,12 @@
 export namespace services {
 	
 	export class CreatePasswordRequest {
+	    type?: string;
 	    serviceName: string;
 	    username: string;
 	    password: string;
 	    notes: string;
+	    fields?: CustomField[];
 	
 	    static createFrom(source: any = {}) {
 	        return new CreatePasswordRequest(source);
@@ -12,19 +14,76 @@ export namespace services {
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.type = source["type"];
 	        this.serviceName = source["serviceName"];
 	        this.username = source["username"];
 	        this.password = source["password"];
 	        this.notes = source["notes"];
+	        this.fields = this.convertValues(source["fields"], CustomField);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class CustomField {
+	    name: string;
+	    value: string;
+	    concealed: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new CustomField(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.value = source["value"];
+	        this.concealed = source["concealed"];
+	    }
+	}
+	export class Highlight {
+	    field: string;
+	    start: number;
+	    end: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Highlight(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.field = source["field"];
+	        this.start = source["start"];
+	        this.end = source["end"];
 	    }
 	}
 	export class PasswordEntryResponse {
 	    id: number;
+	    type?: string;
+	    summary?: string;
 	    serviceName: string;
 	    username: string;
 	    notes: string;
 	    createdAt: string;
 	    updatedAt: string;
+	    fields?: CustomField[];
+	    tags?: string[];
+	    highlights?: Highlight[];
 	
 	    static createFrom(source: any = {}) {
 	        return new PasswordEntryResponse(source);
@@ -33,11 +92,74 @@ export namespace services {
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.id = source["id"];
+	        this.type = source["type"];
+	        this.summary = source["summary"];
 	        this.serviceName = source["serviceName"];
 	        this.username = source["username"];
 	        this.notes = source["notes"];
 	        this.createdAt = source["createdAt"];
 	        this.updatedAt = source["updatedAt"];
+	        this.fields = this.convertValues(source["fields"], CustomField);
+	        this.tags = source["tags"];
+	        this.highlights = this.convertValues(source["highlights"], Highlight);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class PasswordStrengthResponse {
+	    score: number;
+	    maxScore: number;
+	    minScore: number;
+	    acceptable: boolean;
+	    feedback: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new PasswordStrengthResponse(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.score = source["score"];
+	        this.maxScore = source["maxScore"];
+	        this.minScore = source["minScore"];
+	        this.acceptable = source["acceptable"];
+	        this.feedback = source["feedback"];
+	    }
+	}
+	export class UpdateEntryRequest {
+	    serviceName?: string;
+	    username?: string;
+	    password?: string;
+	    notes?: string;
+	    updatedAt?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new UpdateEntryRequest(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.serviceName = source["serviceName"];
+	        this.username = source["username"];
+	        this.password = source["password"];
+	        this.notes = source["notes"];
+	        this.updatedAt = source["updatedAt"];
 	    }
 	}
 
@@ -4,28 +4,44 @@ package commands
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"svimpass/internal/crypto"
+	"svimpass/internal/hardening"
 	"svimpass/internal/paths"
+	"svimpass/internal/recoverykit"
 	"svimpass/internal/services"
+	"svimpass/internal/strength"
 )
 
 // AddCommand handles the :add command.
 type AddCommand struct {
 	PasswordService *services.PasswordService
-	ServiceName     string
-	Username        string
-	Password        string
-	Notes           string
+	Request         services.CreatePasswordRequest
+}
+
+// PendingEntry is a new entry still missing its secret, which the frontend asks
+// for before it creates the entry with CreatePassword
+type PendingEntry struct {
+	Request services.CreatePasswordRequest `json:"request"`
+	Prompt  string                         `json:"prompt"` // what the secret is called, such as card number
 }
 
 func (c *AddCommand) Execute(ctx context.Context) (any, error) {
-	req := services.CreatePasswordRequest{
-		ServiceName: c.ServiceName,
-		Username:    c.Username,
-		Password:    c.Password,
-		Notes:       c.Notes,
+	missing, err := services.CheckNewEntry(&c.Request)
+	if err != nil {
+		return nil, err
 	}
-	return nil, c.PasswordService.CreatePassword(req)
+	if missing != "" {
+		return &PendingEntry{Request: c.Request, Prompt: missing}, nil
+	}
+
+	if err := c.PasswordService.CreatePassword(c.Request); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Added %s %s", c.Request.Type, c.Request.ServiceName), nil
 }
 
 type AddGenCommand struct {
@@ -45,6 +61,355 @@ func (c *AddGenCommand) Execute(ctx context.Context) (any, error) {
 	return c.PasswordService.GenerateAndSavePassword(req)
 }
 
+// EditCommand handles the :edit command, Target is an entry id or a query
+// matching exactly one entry
+type EditCommand struct {
+	PasswordService *services.PasswordService
+	Target          string
+	Patch           services.UpdateEntryRequest
+}
+
+func (c *EditCommand) Execute(ctx context.Context) (any, error) {
+	id, err := resolveEntry(c.PasswordService, c.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := c.PasswordService.UpdateEntry(id, c.Patch)
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Updated %s (%s)", entry.ServiceName, entry.Username), nil
+}
+
+// resolveEntry returns the id of the entry target names, either its id or a
+// query matching exactly one entry
+func resolveEntry(passwordSvc *services.PasswordService, target string) (int, error) {
+	if id, err := strconv.Atoi(target); err == nil {
+		return id, nil
+	}
+
+	entries, err := passwordSvc.SearchPasswords(target)
+	if err != nil {
+		return 0, err
+	}
+	switch len(entries) {
+	case 0:
+		return 0, fmt.Errorf("no entry matches %q", target)
+	case 1:
+		return entries[0].ID, nil
+	default:
+		return 0, fmt.Errorf("%d entries match %q, use the entry id", len(entries), target)
+	}
+}
+
+// resolveEntries returns the ids of the entries target names, either one entry id
+// or every entry a query matches
+func resolveEntries(passwordSvc *services.PasswordService, target string) ([]int, error) {
+	if id, err := strconv.Atoi(target); err == nil {
+		return []int{id}, nil
+	}
+
+	entries, err := passwordSvc.SearchPasswords(target)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no entry matches %q", target)
+	}
+
+	ids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids, nil
+}
+
+// HistoryCommand handles the :history command, listing, revealing or rolling
+// back the replaced passwords of an entry
+type HistoryCommand struct {
+	PasswordService *services.PasswordService
+	Target          string
+	Action          string // list, reveal or rollback
+	Version         int
+}
+
+func (c *HistoryCommand) Execute(ctx context.Context) (any, error) {
+	id, err := resolveEntry(c.PasswordService, c.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.Action {
+	case "reveal":
+		password, err := c.PasswordService.GetHistoricPassword(id, c.Version)
+		if err != nil {
+			return nil, err
+		}
+		defer password.Destroy()
+		return password.Reveal()
+	case "rollback":
+		if err := c.PasswordService.RollbackPassword(id, c.Version); err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Restored password version %d, the replaced password is now version 1", c.Version), nil
+	}
+
+	history, err := c.PasswordService.PasswordHistory(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return "No previous passwords", nil
+	}
+
+	versions := make([]string, 0, len(history))
+	for _, version := range history {
+		versions = append(versions, fmt.Sprintf("%d: %s", version.Version, version.ReplacedAt))
+	}
+	return "Replaced passwords, newest first: " + strings.Join(versions, ", "), nil
+}
+
+// FieldCommand handles the :field command, listing, setting, revealing or
+// removing the custom fields of an entry
+type FieldCommand struct {
+	PasswordService *services.PasswordService
+	Target          string
+	Action          string // list, set, conceal, reveal or remove
+	Field           services.CustomField
+}
+
+func (c *FieldCommand) Execute(ctx context.Context) (any, error) {
+	id, err := resolveEntry(c.PasswordService, c.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.Action {
+	case "set", "conceal":
+		if err := c.PasswordService.SetField(id, c.Field); err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Saved field %s", c.Field.Name), nil
+	case "reveal":
+		value, err := c.PasswordService.GetField(id, c.Field.Name)
+		if err != nil {
+			return nil, err
+		}
+		defer value.Destroy()
+		return value.Reveal()
+	case "remove":
+		if err := c.PasswordService.RemoveField(id, c.Field.Name); err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Removed field %s", c.Field.Name), nil
+	}
+
+	fields, err := c.PasswordService.EntryFields(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return "No custom fields", nil
+	}
+
+	items := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field.Concealed {
+			items = append(items, field.Name+" (concealed)")
+		} else {
+			items = append(items, field.Name+"="+field.Value)
+		}
+	}
+	return "Fields: " + strings.Join(items, "; "), nil
+}
+
+// TagCommand handles the :tag and :untag commands, adding a tag to or removing it
+// from one entry or every entry a query matches
+type TagCommand struct {
+	PasswordService *services.PasswordService
+	Tag             string
+	Target          string
+	Remove          bool
+}
+
+func (c *TagCommand) Execute(ctx context.Context) (any, error) {
+	ids, err := resolveEntries(c.PasswordService, c.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Remove {
+		n, err := c.PasswordService.UntagEntries(c.Tag, ids)
+		if err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Removed #%s from %d entries", strings.TrimPrefix(c.Tag, "#"), n), nil
+	}
+
+	n, err := c.PasswordService.TagEntries(c.Tag, ids)
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Tagged %d entries #%s", n, strings.TrimPrefix(c.Tag, "#")), nil
+}
+
+// TagsCommand handles the :tags command, listing the tags in use
+type TagsCommand struct {
+	PasswordService *services.PasswordService
+}
+
+func (c *TagsCommand) Execute(ctx context.Context) (any, error) {
+	tags, err := c.PasswordService.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return "No tags yet", nil
+	}
+
+	items := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		items = append(items, fmt.Sprintf("#%s (%d)", tag.Name, tag.Entries))
+	}
+	return "Tags: " + strings.Join(items, ", "), nil
+}
+
+// QueryCommand handles the :query command, listing, saving or removing the
+// saved searches recalled as @name
+type QueryCommand struct {
+	PasswordService *services.PasswordService
+	Action          string // list, save or remove
+	Name            string
+	Query           string
+}
+
+func (c *QueryCommand) Execute(ctx context.Context) (any, error) {
+	switch c.Action {
+	case "save":
+		if err := c.PasswordService.SaveQuery(c.Name, c.Query); err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Saved @%s", strings.TrimPrefix(c.Name, "@")), nil
+	case "remove":
+		if err := c.PasswordService.DeleteQuery(c.Name); err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Removed @%s", strings.TrimPrefix(c.Name, "@")), nil
+	}
+
+	queries, err := c.PasswordService.SavedQueries()
+	if err != nil {
+		return nil, err
+	}
+	if len(queries) == 0 {
+		return "No saved queries", nil
+	}
+
+	items := make([]string, 0, len(queries))
+	for _, q := range queries {
+		items = append(items, fmt.Sprintf("@%s = %s", q.Name, q.Query))
+	}
+	return "Saved queries: " + strings.Join(items, "; "), nil
+}
+
+// HistoryLimitCommand handles the :history-limit command
+type HistoryLimitCommand struct {
+	PasswordService *services.PasswordService
+	Limit           *int // nil shows the current limit
+}
+
+func (c *HistoryLimitCommand) Execute(ctx context.Context) (any, error) {
+	if c.Limit != nil {
+		if err := c.PasswordService.SetHistoryLimit(*c.Limit); err != nil {
+			return nil, err
+		}
+	}
+
+	limit, err := c.PasswordService.HistoryLimit()
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		return "Replaced passwords are not kept", nil
+	}
+	return fmt.Sprintf("The last %d replaced passwords of each entry are kept", limit), nil
+}
+
+// TrashCommand handles the :trash command, listing the deleted entries
+type TrashCommand struct {
+	PasswordService *services.PasswordService
+}
+
+func (c *TrashCommand) Execute(ctx context.Context) (any, error) {
+	entries, err := c.PasswordService.TrashedPasswords()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return "The trash is empty", nil
+	}
+
+	items := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		item := fmt.Sprintf("%d: %s (%s) deleted %s", entry.ID, entry.ServiceName, entry.Username, entry.DeletedAt)
+		if entry.PurgeAt != "" {
+			item += ", purged " + entry.PurgeAt
+		}
+		items = append(items, item)
+	}
+	return "Trash: " + strings.Join(items, "; "), nil
+}
+
+// RestoreCommand handles the :restore command
+type RestoreCommand struct {
+	PasswordService *services.PasswordService
+	ID              int
+}
+
+func (c *RestoreCommand) Execute(ctx context.Context) (any, error) {
+	if err := c.PasswordService.RestorePassword(c.ID); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Restored entry %d", c.ID), nil
+}
+
+// PurgeCommand handles the :purge command, emptying the trash
+type PurgeCommand struct {
+	PasswordService *services.PasswordService
+}
+
+func (c *PurgeCommand) Execute(ctx context.Context) (any, error) {
+	purged, err := c.PasswordService.EmptyTrash()
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Permanently deleted %d entries", purged), nil
+}
+
+// TrashDaysCommand handles the :trash-days command
+type TrashDaysCommand struct {
+	PasswordService *services.PasswordService
+	Days            *int // nil shows the current retention
+}
+
+func (c *TrashDaysCommand) Execute(ctx context.Context) (any, error) {
+	if c.Days != nil {
+		if err := c.PasswordService.SetTrashRetentionDays(*c.Days); err != nil {
+			return nil, err
+		}
+	}
+
+	days, err := c.PasswordService.TrashRetentionDays()
+	if err != nil {
+		return nil, err
+	}
+	if days == 0 {
+		return "Deleted entries stay in the trash until it is emptied with :purge", nil
+	}
+	return fmt.Sprintf("Deleted entries are purged after %d days", days), nil
+}
+
 type ImportCommand struct {
 	PasswordService *services.PasswordService
 	FilePath        string
@@ -54,12 +419,15 @@ func (c *ImportCommand) Execute(ctx context.Context) (any, error) {
 	return c.PasswordService.ImportPasswordFromCSV(c.FilePath)
 }
 
+// ExportCommand handles the :export command, Tags limits the export to the
+// entries carrying all of them
 type ExportCommand struct {
 	PasswordService *services.PasswordService
+	Tags            []string
 }
 
 func (c *ExportCommand) Execute(ctx context.Context) (any, error) {
-	return nil, c.PasswordService.ExportPasswordToCSV()
+	return nil, c.PasswordService.ExportPasswordToCSV(c.Tags...)
 }
 
 type ResetApp struct {
@@ -70,7 +438,7 @@ type ResetApp struct {
 func (c *ResetApp) Execute(ctx context.Context) (any, error) {
 	err := c.PasswordSvc.ResetApp()
 	if err != nil {
-		fmt.Errorf("error reseting %w", err)
+		return nil, fmt.Errorf("error reseting %w", err)
 	}
 	err = c.Paths.ResetAll()
 	if err != nil {
@@ -78,3 +446,265 @@ func (c *ResetApp) Execute(ctx context.Context) (any, error) {
 	}
 	return "Succesfull application reset, restart the application", nil
 }
+
+// PasswdCommand handles the :passwd command
+type PasswdCommand struct {
+	AuthService     *services.AuthService
+	OldPassword     string
+	NewPassword     string
+	ConfirmPassword string
+}
+
+func (c *PasswdCommand) Execute(ctx context.Context) (any, error) {
+	removed, err := c.AuthService.ChangeMasterPassword(c.OldPassword, c.NewPassword, c.ConfirmPassword)
+	if err != nil {
+		return nil, err
+	}
+	if len(removed) == 0 {
+		return "Master password changed, unlock with the new password", nil
+	}
+
+	summaries := make([]string, len(removed))
+	for i, slot := range removed {
+		summaries[i] = slot.String()
+	}
+	return fmt.Sprintf("Master password changed, unlock with the new password. Removed key slots: %s", strings.Join(summaries, "; ")), nil
+}
+
+// KeySlotCommand handles the :keyslot command
+type KeySlotCommand struct {
+	AuthService *services.AuthService
+	Action      string // list, add or remove
+	SlotType    string
+	Argument    string // password or keyfile path for add
+	SlotID      int
+}
+
+func (c *KeySlotCommand) Execute(ctx context.Context) (any, error) {
+	switch c.Action {
+	case "add":
+		return c.add()
+	case "remove":
+		if err := c.AuthService.RemoveKeySlot(c.SlotID); err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Removed key slot #%d", c.SlotID), nil
+	default:
+		slots, err := c.AuthService.KeySlots()
+		if err != nil {
+			return nil, err
+		}
+		summaries := make([]string, len(slots))
+		for i, slot := range slots {
+			summaries[i] = slot.String()
+		}
+		return strings.Join(summaries, "; "), nil
+	}
+}
+
+func (c *KeySlotCommand) add() (any, error) {
+	switch c.SlotType {
+	case crypto.SlotRecovery:
+		recoveryKey, err := c.AuthService.AddRecoveryKeySlot()
+		if err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Recovery key (write it down, it is not shown again): %s", recoveryKey), nil
+	case crypto.SlotKeyfile:
+		slot, err := c.AuthService.AddKeyfileKeySlot(c.Argument)
+		if err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Added key slot #%d for keyfile %s", slot.ID, c.Argument), nil
+	default:
+		slot, err := c.AuthService.AddPasswordKeySlot(c.Argument)
+		if err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Added password key slot #%d", slot.ID), nil
+	}
+}
+
+// KDFCommand handles the :kdf command. Without a password it only reports
+// the current parameters, otherwise it raises them to Params.
+type KDFCommand struct {
+	AuthService *services.AuthService
+	Password    string
+	Params      crypto.KDFParams
+}
+
+func (c *KDFCommand) Execute(ctx context.Context) (any, error) {
+	if c.Password == "" {
+		return fmt.Sprintf("KDF: %s", c.AuthService.KDFParams()), nil
+	}
+
+	if err := c.AuthService.UpdateKDFParams(c.Password, c.Params); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("KDF updated: %s", c.Params), nil
+}
+
+// CipherCommand handles the :cipher command. Without a name it only reports the
+// current cipher, otherwise it switches new ciphertexts to Name. Either way the
+// ciphertexts that are not envelopes of the current cipher are upgraded.
+type CipherCommand struct {
+	AuthService     *services.AuthService
+	PasswordService *services.PasswordService
+	Name            string
+}
+
+func (c *CipherCommand) Execute(ctx context.Context) (any, error) {
+	if c.Name != "" {
+		if err := c.AuthService.SetCipher(c.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.PasswordService.UpgradeEncryption(); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Cipher: %s, upgrading older entries in the background", c.AuthService.Cipher()), nil
+}
+
+// SecurityCommand handles the :security command, reporting the process
+// protections applied at startup
+type SecurityCommand struct {
+	Report *hardening.Report
+}
+
+func (c *SecurityCommand) Execute(ctx context.Context) (any, error) {
+	if c.Report == nil {
+		return nil, fmt.Errorf("process protections were not applied")
+	}
+	return c.Report.String(), nil
+}
+
+// RecoveryKitCommand handles the :recovery-kit command. It generates a new
+// recovery key, revoking the previous one, and writes the emergency sheet to Path.
+type RecoveryKitCommand struct {
+	AuthService *services.AuthService
+	Paths       *paths.Paths
+	Path        string
+}
+
+func (c *RecoveryKitCommand) Execute(ctx context.Context) (any, error) {
+	recoveryKey, err := c.AuthService.RegenerateRecoveryKey()
+	if err != nil {
+		return nil, err
+	}
+
+	kit := recoverykit.Kit{
+		RecoveryKey:  recoveryKey,
+		DatabasePath: c.Paths.Database(),
+		ConfigPath:   c.Paths.Config(),
+		BackupDir:    c.Paths.BackupDir(),
+		CreatedAt:    time.Now(),
+	}
+	if err := recoverykit.Write(c.Path, kit); err != nil {
+		return nil, fmt.Errorf("the new recovery key is active but the kit could not be written, run :recovery-kit again: %w", err)
+	}
+
+	return fmt.Sprintf("Recovery kit written to %s, print it and delete the file. Older recovery keys are revoked", c.Path), nil
+}
+
+// SplitKeyCommand handles the :split-key command. It splits a new unlock secret
+// into Count Shamir shares, any Threshold of which recover the vault, and writes
+// one sheet per share into Dir.
+type SplitKeyCommand struct {
+	AuthService *services.AuthService
+	Threshold   int
+	Count       int
+	Dir         string
+}
+
+func (c *SplitKeyCommand) Execute(ctx context.Context) (any, error) {
+	shares, err := c.AuthService.SplitKey(c.Threshold, c.Count)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := recoverykit.WriteShares(c.Dir, shares, c.Threshold, time.Now()); err != nil {
+		return nil, fmt.Errorf("the new shares are active but could not be written, run :split-key again: %w", err)
+	}
+
+	return fmt.Sprintf("%d shares written to %s, any %d of them recover the vault. Hand them out and delete the files, older shares are revoked", c.Count, c.Dir, c.Threshold), nil
+}
+
+// LockoutCommand handles the :lockout command, showing or changing the action
+// taken after too many failed unlock attempts
+type LockoutCommand struct {
+	AuthService *services.AuthService
+	Policy      *crypto.LockoutPolicy // nil shows the current policy
+}
+
+func (c *LockoutCommand) Execute(ctx context.Context) (any, error) {
+	if c.Policy != nil {
+		if err := c.AuthService.SetLockoutPolicy(*c.Policy); err != nil {
+			return nil, err
+		}
+	}
+	return fmt.Sprintf("Lockout policy: %s", c.AuthService.LockoutPolicy()), nil
+}
+
+// AutoLockCommand handles the :autolock command, showing or changing how long
+// the unlocked vault may stay idle before it locks
+type AutoLockCommand struct {
+	AuthService *services.AuthService
+	Timeout     *time.Duration // nil shows the current timeout, 0 disables the auto-lock
+}
+
+func (c *AutoLockCommand) Execute(ctx context.Context) (any, error) {
+	if c.Timeout != nil {
+		if err := c.AuthService.SetIdleTimeout(*c.Timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := c.AuthService.IdleTimeout()
+	if timeout == 0 {
+		return "Auto-lock: off", nil
+	}
+	return fmt.Sprintf("Auto-lock: after %s idle", timeout), nil
+}
+
+// PINCommand handles the :pin command, setting or discarding the quick unlock PIN
+type PINCommand struct {
+	AuthService *services.AuthService
+	Action      string // show, set or off
+	PIN         string
+	Window      time.Duration
+}
+
+func (c *PINCommand) Execute(ctx context.Context) (any, error) {
+	switch c.Action {
+	case "set":
+		if err := c.AuthService.EnableQuickUnlock(c.PIN, c.Window); err != nil {
+			return nil, err
+		}
+	case "off":
+		c.AuthService.DisableQuickUnlock()
+		return "PIN discarded, the master password is required to unlock", nil
+	}
+
+	expires := c.AuthService.QuickUnlockExpiry()
+	if expires.IsZero() {
+		return "No PIN set", nil
+	}
+	return fmt.Sprintf("PIN unlocks the vault until %s", expires.Format("2006-01-02 15:04")), nil
+}
+
+// StrengthCommand handles the :strength command, showing or changing the strength
+// score new master passwords need
+type StrengthCommand struct {
+	AuthService *services.AuthService
+	MinScore    *int // nil shows the current minimum
+}
+
+func (c *StrengthCommand) Execute(ctx context.Context) (any, error) {
+	if c.MinScore != nil {
+		if err := c.AuthService.SetMinStrength(*c.MinScore); err != nil {
+			return nil, err
+		}
+	}
+	return fmt.Sprintf("Master passwords need a strength score of %d of %d", c.AuthService.MinStrength(), strength.MaxScore), nil
+}
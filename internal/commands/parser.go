@@ -2,14 +2,20 @@ package commands
 
 import (
 	"fmt"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"svimpass/internal/crypto"
+	"svimpass/internal/hardening"
 	"svimpass/internal/paths"
 	"svimpass/internal/services"
+	"svimpass/internal/strength"
 )
 
 // ParseCommand parses user input into executable commands
-func ParseCommand(input string, passwordSvc *services.PasswordService, paths *paths.Paths) (Command, error) {
+func ParseCommand(input string, authSvc *services.AuthService, passwordSvc *services.PasswordService, paths *paths.Paths, security *hardening.Report) (Command, error) {
 	input = strings.TrimSpace(input)
 
 	// Remove the : prefix
@@ -33,12 +39,56 @@ func ParseCommand(input string, passwordSvc *services.PasswordService, paths *pa
 		return parseAddCommand(args, passwordSvc)
 	case "addgen":
 		return parseAddGenCommand(args, passwordSvc)
+	case "edit":
+		return parseEditCommand(args, passwordSvc)
+	case "history":
+		return parseHistoryCommand(args, passwordSvc)
+	case "history-limit":
+		return parseHistoryLimitCommand(args, passwordSvc)
+	case "field":
+		return parseFieldCommand(args, passwordSvc)
+	case "tag", "untag":
+		return parseTagCommand(args, command == "untag", passwordSvc)
+	case "tags":
+		return &TagsCommand{PasswordService: passwordSvc}, nil
+	case "query":
+		return parseQueryCommand(args, passwordSvc)
+	case "trash":
+		return &TrashCommand{PasswordService: passwordSvc}, nil
+	case "trash-days":
+		return parseTrashDaysCommand(args, passwordSvc)
+	case "restore":
+		return parseRestoreCommand(args, passwordSvc)
+	case "purge":
+		return &PurgeCommand{PasswordService: passwordSvc}, nil
 	case "import":
 		return parseImportCommand(args, passwordSvc)
 	case "export":
-		return parseExportCommand(passwordSvc)
+		return parseExportCommand(args, passwordSvc)
 	case "reset!":
 		return ParseResetCommand(paths, passwordSvc)
+	case "kdf":
+		return parseKDFCommand(args, authSvc)
+	case "passwd":
+		return parsePasswdCommand(args, authSvc)
+	case "keyslot":
+		return parseKeySlotCommand(args, authSvc)
+	case "cipher":
+		return parseCipherCommand(args, authSvc, passwordSvc)
+	case "recovery-kit":
+		return parseRecoveryKitCommand(args, authSvc, paths)
+	case "strength":
+		return parseStrengthCommand(args, authSvc)
+	case "pin":
+		return parsePINCommand(args, authSvc)
+	case "autolock":
+		return parseAutoLockCommand(args, authSvc)
+	case "lockout":
+		return parseLockoutCommand(args, authSvc)
+	case "split-key":
+		return parseSplitKeyCommand(args, authSvc)
+	case "security":
+		return &SecurityCommand{Report: security}, nil
 
 	default:
 		return nil, fmt.Errorf("unknown command: %s", command)
@@ -46,6 +96,22 @@ func ParseCommand(input string, passwordSvc *services.PasswordService, paths *pa
 }
 
 func parseAddCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
+	// Format: [type:]parts, service;username;notes for logins
+	req, err := services.ParseNewEntry(args)
+	if err != nil {
+		return nil, err
+	}
+	if req.ServiceName == "" {
+		return nil, fmt.Errorf("usage: :add %s", services.AddUsage(req.Type))
+	}
+
+	return &AddCommand{
+		PasswordService: passwordSvc,
+		Request:         req,
+	}, nil
+}
+
+func parseAddGenCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
 	// Split by semicolon - format: service;username;notes
 	parts := strings.Split(args, ";")
 	for i, part := range parts {
@@ -53,7 +119,7 @@ func parseAddCommand(args string, passwordSvc *services.PasswordService) (Comman
 	}
 
 	if len(parts) < 2 {
-		return nil, fmt.Errorf("usage: :add service;username;notes")
+		return nil, fmt.Errorf("usage: :addgen service;username;notes")
 	}
 
 	serviceName := parts[0]
@@ -67,47 +133,237 @@ func parseAddCommand(args string, passwordSvc *services.PasswordService) (Comman
 		return nil, fmt.Errorf("service name and username are required")
 	}
 
-	// Note: For :add command, the frontend doesn't seem to provide a password
-	// This might need to be handled differently - maybe prompt for password?
-	return &AddCommand{
+	return &AddGenCommand{
 		PasswordService: passwordSvc,
 		ServiceName:     serviceName,
 		Username:        username,
-		Password:        "", // This might need special handling
 		Notes:           notes,
 	}, nil
 }
 
-func parseAddGenCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
-	// Split by semicolon - format: service;username;notes
-	parts := strings.Split(args, ";")
-	for i, part := range parts {
-		parts[i] = strings.TrimSpace(part)
+func parseEditCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
+	// Format: <id|query> field=value;field=value - password values are not trimmed
+	usage := fmt.Errorf("usage: :edit <id|query> service=...;username=...;password=...;notes=...")
+
+	target, assignments, ok := strings.Cut(strings.TrimSpace(args), " ")
+	if !ok || target == "" {
+		return nil, usage
 	}
 
-	if len(parts) < 2 {
-		return nil, fmt.Errorf("usage: :addgen service;username;notes")
+	var patch services.UpdateEntryRequest
+	for _, part := range strings.Split(assignments, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, usage
+		}
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "service", "servicename":
+			value = strings.TrimSpace(value)
+			patch.ServiceName = &value
+		case "username", "user":
+			value = strings.TrimSpace(value)
+			patch.Username = &value
+		case "password":
+			patch.Password = &value
+		case "notes":
+			value = strings.TrimSpace(value)
+			patch.Notes = &value
+		default:
+			return nil, fmt.Errorf("unknown field: %s", strings.TrimSpace(key))
+		}
 	}
 
-	serviceName := parts[0]
-	username := parts[1]
-	notes := ""
-	if len(parts) > 2 {
-		notes = parts[2]
+	if patch.ServiceName == nil && patch.Username == nil && patch.Password == nil && patch.Notes == nil {
+		return nil, usage
 	}
 
-	if serviceName == "" || username == "" {
-		return nil, fmt.Errorf("service name and username are required")
+	return &EditCommand{
+		PasswordService: passwordSvc,
+		Target:          target,
+		Patch:           patch,
+	}, nil
+}
+
+func parseHistoryCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
+	// Format: <id|query> [reveal N | rollback [N]]
+	usage := fmt.Errorf("usage: :history <id|query> [reveal N | rollback [N]]")
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 || len(fields) > 3 {
+		return nil, usage
 	}
 
-	return &AddGenCommand{
+	cmd := &HistoryCommand{
 		PasswordService: passwordSvc,
-		ServiceName:     serviceName,
-		Username:        username,
-		Notes:           notes,
+		Target:          fields[0],
+		Action:          "list",
+	}
+	if len(fields) == 1 {
+		return cmd, nil
+	}
+
+	cmd.Action = strings.ToLower(fields[1])
+	switch {
+	case cmd.Action == "rollback" && len(fields) == 2:
+		cmd.Version = 1
+	case (cmd.Action == "rollback" || cmd.Action == "reveal") && len(fields) == 3:
+		version, err := strconv.Atoi(fields[2])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid version: %s", fields[2])
+		}
+		cmd.Version = version
+	default:
+		return nil, usage
+	}
+
+	return cmd, nil
+}
+
+func parseFieldCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
+	// Format: <id|query> [set name=value | conceal name=value | reveal name | remove name]
+	usage := fmt.Errorf("usage: :field <id|query> [set name=value | conceal name=value | reveal name | remove name]")
+
+	target, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	if target == "" {
+		return nil, usage
+	}
+
+	cmd := &FieldCommand{
+		PasswordService: passwordSvc,
+		Target:          target,
+		Action:          "list",
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return cmd, nil
+	}
+
+	action, rest, _ := strings.Cut(rest, " ")
+	cmd.Action = strings.ToLower(action)
+	switch cmd.Action {
+	case "set", "conceal":
+		// The value is kept as typed, it may be a secret
+		name, value, ok := strings.Cut(rest, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, usage
+		}
+		cmd.Field = services.CustomField{
+			Name:      strings.TrimSpace(name),
+			Value:     value,
+			Concealed: cmd.Action == "conceal",
+		}
+	case "reveal", "remove":
+		name := strings.TrimSpace(rest)
+		if name == "" {
+			return nil, usage
+		}
+		cmd.Field.Name = name
+	default:
+		return nil, usage
+	}
+
+	return cmd, nil
+}
+
+func parseTagCommand(args string, remove bool, passwordSvc *services.PasswordService) (Command, error) {
+	// Format: tag <id|query>, a query tags every entry it matches
+	tag, target, _ := strings.Cut(strings.TrimSpace(args), " ")
+	target = strings.TrimSpace(target)
+	if tag == "" || target == "" {
+		if remove {
+			return nil, fmt.Errorf("usage: :untag tag <id|query>")
+		}
+		return nil, fmt.Errorf("usage: :tag tag <id|query>")
+	}
+
+	return &TagCommand{
+		PasswordService: passwordSvc,
+		Tag:             tag,
+		Target:          target,
+		Remove:          remove,
 	}, nil
 }
 
+func parseQueryCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
+	// Format: [save name query | remove name]
+	usage := fmt.Errorf("usage: :query [save name query | remove name]")
+
+	cmd := &QueryCommand{PasswordService: passwordSvc, Action: "list"}
+
+	action, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	if action == "" {
+		return cmd, nil
+	}
+
+	cmd.Action = strings.ToLower(action)
+	name, text, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	cmd.Name = name
+	cmd.Query = strings.TrimSpace(text)
+
+	switch cmd.Action {
+	case "save":
+		if name == "" || cmd.Query == "" {
+			return nil, usage
+		}
+	case "remove":
+		if name == "" {
+			return nil, usage
+		}
+	default:
+		return nil, usage
+	}
+
+	return cmd, nil
+}
+
+func parseHistoryLimitCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
+	cmd := &HistoryLimitCommand{PasswordService: passwordSvc}
+
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return cmd, nil
+	}
+
+	limit, err := strconv.Atoi(args)
+	if err != nil || limit < 0 {
+		return nil, fmt.Errorf("usage: :history-limit [number of versions, 0 keeps none]")
+	}
+	cmd.Limit = &limit
+
+	return cmd, nil
+}
+
+func parseRestoreCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(args))
+	if err != nil {
+		return nil, fmt.Errorf("usage: :restore id, see :trash for the ids")
+	}
+
+	return &RestoreCommand{PasswordService: passwordSvc, ID: id}, nil
+}
+
+func parseTrashDaysCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
+	cmd := &TrashDaysCommand{PasswordService: passwordSvc}
+
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return cmd, nil
+	}
+
+	days, err := strconv.Atoi(args)
+	if err != nil || days < 0 {
+		return nil, fmt.Errorf("usage: :trash-days [days, 0 keeps entries until :purge]")
+	}
+	cmd.Days = &days
+
+	return cmd, nil
+}
+
 func parseImportCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
 	filepath := strings.TrimSpace(args)
 
@@ -121,8 +377,16 @@ func parseImportCommand(args string, passwordSvc *services.PasswordService) (Com
 	}, nil
 }
 
-func parseExportCommand(passwordSvc *services.PasswordService) (Command, error) {
-	return &ExportCommand{PasswordService: passwordSvc}, nil
+func parseExportCommand(args string, passwordSvc *services.PasswordService) (Command, error) {
+	// Format: [#tag ...], exporting only the entries carrying every tag
+	tags := strings.Fields(args)
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, "#") || len(tag) == 1 {
+			return nil, fmt.Errorf("usage: :export [#tag ...]")
+		}
+	}
+
+	return &ExportCommand{PasswordService: passwordSvc, Tags: tags}, nil
 }
 
 func ParseResetCommand(paths *paths.Paths, passwordSvc *services.PasswordService) (Command, error) {
@@ -131,3 +395,289 @@ func ParseResetCommand(paths *paths.Paths, passwordSvc *services.PasswordService
 		PasswordSvc: passwordSvc,
 	}, nil
 }
+
+func parsePasswdCommand(args string, authSvc *services.AuthService) (Command, error) {
+	// Format: old;new;confirm - passwords are not trimmed, spaces are significant
+	parts := strings.Split(args, ";")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("usage: :passwd old;new;confirm")
+	}
+
+	return &PasswdCommand{
+		AuthService:     authSvc,
+		OldPassword:     parts[0],
+		NewPassword:     parts[1],
+		ConfirmPassword: parts[2],
+	}, nil
+}
+
+func parseKeySlotCommand(args string, authSvc *services.AuthService) (Command, error) {
+	// Format: list | add password <password> | add recovery | add keyfile <path> | remove <id>
+	usage := fmt.Errorf("usage: :keyslot list | add password|recovery|keyfile [value] | remove id")
+
+	fields := strings.SplitN(strings.TrimSpace(args), " ", 3)
+	action := strings.ToLower(fields[0])
+
+	switch action {
+	case "", "list":
+		return &KeySlotCommand{AuthService: authSvc, Action: "list"}, nil
+	case "add":
+		if len(fields) < 2 {
+			return nil, usage
+		}
+		slotType := strings.ToLower(fields[1])
+		argument := ""
+		if len(fields) > 2 {
+			argument = fields[2]
+		}
+
+		switch slotType {
+		case crypto.SlotPassword:
+			if argument == "" {
+				return nil, fmt.Errorf("usage: :keyslot add password <password>")
+			}
+		case crypto.SlotKeyfile:
+			argument = strings.TrimSpace(argument)
+			if argument == "" {
+				return nil, fmt.Errorf("usage: :keyslot add keyfile /path/to/keyfile")
+			}
+		case crypto.SlotRecovery:
+		default:
+			return nil, usage
+		}
+
+		return &KeySlotCommand{
+			AuthService: authSvc,
+			Action:      action,
+			SlotType:    slotType,
+			Argument:    argument,
+		}, nil
+	case "remove":
+		if len(fields) != 2 {
+			return nil, usage
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(fields[1], "#"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key slot id: %s", fields[1])
+		}
+		return &KeySlotCommand{AuthService: authSvc, Action: action, SlotID: id}, nil
+	default:
+		return nil, usage
+	}
+}
+
+func parseCipherCommand(args string, authSvc *services.AuthService, passwordSvc *services.PasswordService) (Command, error) {
+	// Format: [aes-256-gcm|xchacha20-poly1305]
+	name := strings.ToLower(strings.TrimSpace(args))
+	switch name {
+	case "", crypto.CipherAESGCM, crypto.CipherXChaCha20Poly1305:
+	default:
+		return nil, fmt.Errorf("usage: :cipher [%s|%s]", crypto.CipherAESGCM, crypto.CipherXChaCha20Poly1305)
+	}
+
+	return &CipherCommand{
+		AuthService:     authSvc,
+		PasswordService: passwordSvc,
+		Name:            name,
+	}, nil
+}
+
+func parseRecoveryKitCommand(args string, authSvc *services.AuthService, paths *paths.Paths) (Command, error) {
+	// Format: /path/to/kit.html or /path/to/kit.txt
+	path := strings.TrimSpace(args)
+	if path == "" || !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("usage: :recovery-kit /absolute/path/to/kit.html (or .txt)")
+	}
+
+	return &RecoveryKitCommand{
+		AuthService: authSvc,
+		Paths:       paths,
+		Path:        path,
+	}, nil
+}
+
+func parseSplitKeyCommand(args string, authSvc *services.AuthService) (Command, error) {
+	// Format: threshold/count /absolute/dir, e.g. 3/5 /media/usb/shares
+	usage := fmt.Errorf("usage: :split-key threshold/count /absolute/path/to/dir, e.g. :split-key 3/5 /media/usb/shares")
+	fields := strings.Fields(args)
+	if len(fields) != 2 || !filepath.IsAbs(fields[1]) {
+		return nil, usage
+	}
+
+	thresholdText, countText, found := strings.Cut(fields[0], "/")
+	if !found {
+		return nil, usage
+	}
+	threshold, err := strconv.Atoi(thresholdText)
+	if err != nil {
+		return nil, usage
+	}
+	count, err := strconv.Atoi(countText)
+	if err != nil {
+		return nil, usage
+	}
+	if threshold < 2 || threshold > count || count > 255 {
+		return nil, fmt.Errorf("need 2 <= threshold <= count <= 255, got %d/%d", threshold, count)
+	}
+
+	return &SplitKeyCommand{
+		AuthService: authSvc,
+		Threshold:   threshold,
+		Count:       count,
+		Dir:         fields[1],
+	}, nil
+}
+
+func parseStrengthCommand(args string, authSvc *services.AuthService) (Command, error) {
+	// Format: [score], without arguments the minimum score is shown
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return &StrengthCommand{AuthService: authSvc}, nil
+	}
+
+	score, err := strconv.Atoi(args)
+	if err != nil || score < 0 || score > strength.MaxScore {
+		return nil, fmt.Errorf("usage: :strength [0-%d]", strength.MaxScore)
+	}
+	return &StrengthCommand{AuthService: authSvc, MinScore: &score}, nil
+}
+
+func parsePINCommand(args string, authSvc *services.AuthService) (Command, error) {
+	// Format: [off | pin [window]], e.g. 4711 8h, without arguments the PIN status is shown
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+		return &PINCommand{AuthService: authSvc, Action: "show"}, nil
+	case len(fields) == 1 && strings.ToLower(fields[0]) == "off":
+		return &PINCommand{AuthService: authSvc, Action: "off"}, nil
+	case len(fields) <= 2:
+		window := crypto.DefaultPINWindow
+		if len(fields) == 2 {
+			parsed, err := time.ParseDuration(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid PIN window: %s", fields[1])
+			}
+			window = parsed
+		}
+		return &PINCommand{AuthService: authSvc, Action: "set", PIN: fields[0], Window: window}, nil
+	default:
+		return nil, fmt.Errorf("usage: :pin [off | pin [window]], e.g. :pin 4711 8h")
+	}
+}
+
+func parseAutoLockCommand(args string, authSvc *services.AuthService) (Command, error) {
+	// Format: [off | duration], e.g. 10m or 1h30m, without arguments the timeout is shown
+	args = strings.ToLower(strings.TrimSpace(args))
+	switch args {
+	case "":
+		return &AutoLockCommand{AuthService: authSvc}, nil
+	case "off":
+		var off time.Duration
+		return &AutoLockCommand{AuthService: authSvc, Timeout: &off}, nil
+	}
+
+	timeout, err := time.ParseDuration(args)
+	if err != nil || timeout < time.Minute {
+		return nil, fmt.Errorf("usage: :autolock [off | duration of at least 1m, e.g. 10m or 1h]")
+	}
+	return &AutoLockCommand{AuthService: authSvc, Timeout: &timeout}, nil
+}
+
+func parseLockoutCommand(args string, authSvc *services.AuthService) (Command, error) {
+	// Format: [off | attempts lock|wipe], without arguments the policy is shown
+	fields := strings.Fields(strings.ToLower(args))
+	switch {
+	case len(fields) == 0:
+		return &LockoutCommand{AuthService: authSvc}, nil
+	case len(fields) == 1 && fields[0] == "off":
+		return &LockoutCommand{AuthService: authSvc, Policy: &crypto.LockoutPolicy{}}, nil
+	case len(fields) == 2:
+		attempts, err := strconv.Atoi(fields[0])
+		if err != nil || attempts < 1 {
+			return nil, fmt.Errorf("invalid attempt count: %s", fields[0])
+		}
+		return &LockoutCommand{
+			AuthService: authSvc,
+			Policy:      &crypto.LockoutPolicy{MaxFailures: attempts, Action: fields[1]},
+		}, nil
+	default:
+		return nil, fmt.Errorf("usage: :lockout [off | attempts %s|%s], e.g. :lockout 10 %s", crypto.LockoutLock, crypto.LockoutWipe, crypto.LockoutLock)
+	}
+}
+
+func parseKDFCommand(args string, authSvc *services.AuthService) (Command, error) {
+	// Format: password;time=N;memory=N[MiB|GiB];threads=N
+	// Without arguments the current parameters are shown
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return &KDFCommand{AuthService: authSvc}, nil
+	}
+
+	usage := fmt.Errorf("usage: :kdf master-password;time=3;memory=64MiB;threads=4")
+
+	parts := strings.Split(args, ";")
+	password := parts[0]
+	if password == "" || len(parts) < 2 {
+		return nil, usage
+	}
+
+	// Unspecified settings keep their current value
+	params := authSvc.KDFParams()
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, usage
+		}
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "time":
+			n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time: %s", value)
+			}
+			params.Time = uint32(n)
+		case "memory":
+			n, err := parseMemoryKiB(value)
+			if err != nil {
+				return nil, err
+			}
+			params.Memory = n
+		case "threads":
+			n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid threads: %s", value)
+			}
+			params.Threads = uint8(n)
+		default:
+			return nil, usage
+		}
+	}
+
+	return &KDFCommand{
+		AuthService: authSvc,
+		Password:    password,
+		Params:      params,
+	}, nil
+}
+
+// parseMemoryKiB parses a memory size in KiB, accepting MiB and GiB suffixes
+func parseMemoryKiB(value string) (uint32, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	multiplier := uint64(1)
+	switch {
+	case strings.HasSuffix(value, "gib"):
+		multiplier = 1024 * 1024
+		value = strings.TrimSuffix(value, "gib")
+	case strings.HasSuffix(value, "mib"):
+		multiplier = 1024
+		value = strings.TrimSuffix(value, "mib")
+	case strings.HasSuffix(value, "kib"):
+		value = strings.TrimSuffix(value, "kib")
+	}
+
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || n*multiplier > 1<<32-1 {
+		return 0, fmt.Errorf("invalid memory: %s", value)
+	}
+	return uint32(n * multiplier), nil
+}
@@ -0,0 +1,173 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/text/unicode/norm"
+)
+
+// BlindIndexVersion changes whenever the tokens of a value change, so stored
+// indexes built by an older version can be detected and rebuilt
+const BlindIndexVersion = "2"
+
+const (
+	blindIndexInfo = "svimpass blind index v1"
+	tokenSize      = 16 // truncated HMAC-SHA256
+	gramSize       = 3
+
+	minPrefixSize = 2  // shortest word prefix with a word token
+	maxPrefixSize = 32 // longer words only match up to this prefix
+)
+
+// BlindIndex computes keyed search tokens so encrypted fields can be searched
+// without the database ever seeing their plaintext. Tokens are HMACs of the
+// trigrams of a field, so a query matches an entry when every trigram of the
+// query is among the entry's tokens for that field.
+type BlindIndex struct {
+	key *SecureBuffer
+}
+
+// BlindIndex derives the search token key from the vault key
+func (ek *EncryptionKey) BlindIndex() (*BlindIndex, error) {
+	key, err := NewSecureBuffer(keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ek.key.With(func(vaultKey []byte) error {
+		return key.With(func(indexKey []byte) error {
+			_, err := io.ReadFull(hkdf.New(sha256.New, vaultKey, nil, []byte(blindIndexInfo)), indexKey)
+			return err
+		})
+	})
+	if err != nil {
+		key.Destroy()
+		return nil, fmt.Errorf("failed to derive blind index key: %w", err)
+	}
+
+	return &BlindIndex{key: key}, nil
+}
+
+// Destroy wipes the search token key from memory
+func (bi *BlindIndex) Destroy() {
+	bi.key.Destroy()
+}
+
+// Tokens returns the deduplicated tokens of every trigram of value. Values
+// shorter than a trigram produce no tokens and cannot be searched by index.
+func (bi *BlindIndex) Tokens(field, value string) [][]byte {
+	runes := []rune(NormalizeSearchText(value))
+	if len(runes) < gramSize {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var tokens [][]byte
+	for i := 0; i+gramSize <= len(runes); i++ {
+		gram := string(runes[i : i+gramSize])
+		if seen[gram] {
+			continue
+		}
+		seen[gram] = true
+		tokens = append(tokens, bi.token(field, gram))
+	}
+
+	return tokens
+}
+
+// ExactToken returns the token of the whole normalized value, for fields such as
+// tags that are only ever matched in full
+func (bi *BlindIndex) ExactToken(field, value string) []byte {
+	return bi.token(field, NormalizeSearchText(value))
+}
+
+// WordTokens returns a token for every prefix of every word of value, in order and
+// with repeats, so a full-text index can weigh how often a word occurs. Words are
+// runs of letters and digits in any script.
+func (bi *BlindIndex) WordTokens(field, value string) [][]byte {
+	var tokens [][]byte
+	for _, word := range SearchWords(value) {
+		runes := []rune(word)
+		if len(runes) > maxPrefixSize {
+			runes = runes[:maxPrefixSize]
+		}
+		for size := min(minPrefixSize, len(runes)); size <= len(runes); size++ {
+			tokens = append(tokens, bi.token(field, string(runes[:size])))
+		}
+	}
+	return tokens
+}
+
+// WordToken returns the token a searched word matches in WordTokens, it matches
+// every word starting with it
+func (bi *BlindIndex) WordToken(field, word string) []byte {
+	runes := []rune(NormalizeSearchText(word))
+	if len(runes) > maxPrefixSize {
+		runes = runes[:maxPrefixSize]
+	}
+	return bi.token(field, string(runes))
+}
+
+// token computes the keyed token of one trigram, scoped to a field; nil once
+// the index has been destroyed
+func (bi *BlindIndex) token(field, gram string) []byte {
+	var token []byte
+	bi.key.With(func(key []byte) error {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(field))
+		mac.Write([]byte{0})
+		mac.Write([]byte(gram))
+		token = mac.Sum(nil)[:tokenSize]
+		return nil
+	})
+	return token
+}
+
+// NormalizeSearchText folds and trims text before it is indexed or matched
+func NormalizeSearchText(text string) string {
+	return FoldText(strings.TrimSpace(text))
+}
+
+// FoldText folds the case and the accents of text, so "Ärger" and "ARGER" compare
+// equal. Each rune folds to exactly one rune, rune offsets into the folded text
+// are offsets into text.
+func FoldText(text string) string {
+	return strings.Map(foldRune, text)
+}
+
+// foldRune drops the accents of a precomposed letter and maps it to the lower
+// case of its upper case, which also merges forms such as the final sigma
+func foldRune(r rune) rune {
+	if r >= utf8.RuneSelf {
+		decomposed := norm.NFD.String(string(r))
+		base, size := utf8.DecodeRuneInString(decomposed)
+		if size < len(decomposed) && onlyMarks(decomposed[size:]) {
+			r = base
+		}
+	}
+	return unicode.ToLower(unicode.ToUpper(r))
+}
+
+// onlyMarks reports whether text holds nothing but combining marks
+func onlyMarks(text string) bool {
+	for _, r := range text {
+		if !unicode.Is(unicode.Mn, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchWords splits text into its folded words, runs of letters and digits
+func SearchWords(text string) []string {
+	return strings.FieldsFunc(FoldText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	})
+}
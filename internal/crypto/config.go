@@ -0,0 +1,498 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"svimpass/internal/strength"
+)
+
+const (
+	// configVersion is the current config format, the JSON document written by
+	// writeConfig. Version 1 is the single line
+	// salt_hex:encrypted_token_hex:initialized[:kdf fields[:generation]] format and
+	// version 2 the colon separated key slot format, both are still read.
+	configVersion = 3
+	// slotConfigVersion is the first version storing key slots
+	slotConfigVersion = 2
+	configMagic       = "svimpass"
+	configFormat      = "svimpass-config"
+)
+
+// DefaultIdleTimeout is how long an unlocked vault stays idle before it locks
+const DefaultIdleTimeout = 15 * time.Minute
+
+// readConfig reads and parses a config file of any known version
+func readConfig(path string) (*MasterPasswordConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, "{") {
+		return parseJSONConfig([]byte(text))
+	}
+	if strings.HasPrefix(text, configMagic+":") {
+		return parseSlotConfig(text)
+	}
+	return parseLegacyConfig(text)
+}
+
+// configEnvelope is the JSON config file. The checksum covers the compacted
+// config document, so a truncated or bit-flipped file is never mistaken for a
+// valid config.
+type configEnvelope struct {
+	Format   string          `json:"format"`
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"` // hex sha256 of the compacted config
+	Config   json.RawMessage `json:"config"`
+}
+
+// configDocument is the config as stored in the JSON format
+type configDocument struct {
+	Initialized bool           `json:"initialized"`
+	Generation  uint64         `json:"generation"`
+	Cipher      string         `json:"cipher"`
+	KeyfilePath string         `json:"keyfile_path,omitempty"`
+	IdleSeconds int            `json:"idle_timeout_seconds"`
+	MinStrength int            `json:"min_strength"`
+	Lockout     *lockoutPolicy `json:"lockout,omitempty"`
+	Slots       []KeySlot      `json:"slots"`
+}
+
+// lockoutPolicy is the JSON form of a LockoutPolicy
+type lockoutPolicy struct {
+	MaxFailures int    `json:"max_failures"`
+	Action      string `json:"action"`
+}
+
+// parseJSONConfig parses the version 3 format and verifies its checksum
+func parseJSONConfig(data []byte) (*MasterPasswordConfig, error) {
+	var envelope configEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode config file: %w", err)
+	}
+
+	if envelope.Format != configFormat {
+		return nil, fmt.Errorf("unknown config format: %q", envelope.Format)
+	}
+	if envelope.Version > configVersion {
+		return nil, fmt.Errorf("config version %d is newer than supported version %d", envelope.Version, configVersion)
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, envelope.Config); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	checksum, err := hex.DecodeString(envelope.Checksum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config checksum: %w", err)
+	}
+	sum := sha256.Sum256(compact.Bytes())
+	if subtle.ConstantTimeCompare(checksum, sum[:]) != 1 {
+		return nil, fmt.Errorf("config checksum mismatch")
+	}
+
+	var doc configDocument
+	if err := json.Unmarshal(compact.Bytes(), &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+
+	if _, err := cipherAlgorithm(doc.Cipher); err != nil {
+		return nil, err
+	}
+	if doc.IdleSeconds < 0 {
+		return nil, fmt.Errorf("invalid idle timeout: %d", doc.IdleSeconds)
+	}
+	if doc.MinStrength < 0 || doc.MinStrength > strength.MaxScore {
+		return nil, fmt.Errorf("invalid minimum password strength: %d", doc.MinStrength)
+	}
+
+	config := &MasterPasswordConfig{
+		Version:       envelope.Version,
+		IsInitialized: doc.Initialized,
+		Generation:    doc.Generation,
+		Cipher:        doc.Cipher,
+		KeyfilePath:   doc.KeyfilePath,
+		IdleTimeout:   time.Duration(doc.IdleSeconds) * time.Second,
+		MinStrength:   doc.MinStrength,
+		Slots:         doc.Slots,
+	}
+
+	if doc.Lockout != nil {
+		config.Lockout = LockoutPolicy{MaxFailures: doc.Lockout.MaxFailures, Action: doc.Lockout.Action}
+		if err := validateLockout(config.Lockout); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, slot := range config.Slots {
+		if err := validateSlot(slot); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.IsInitialized && len(config.Slots) == 0 {
+		return nil, fmt.Errorf("config has no key slots")
+	}
+
+	return config, nil
+}
+
+// parseSlotConfig parses the version 2 format:
+//
+//	svimpass:2:initialized:generation[:cipher]
+//	[keyfile:path]
+//	[lockout:max_failures:action]
+//	[idle:seconds]
+//	[strength:min_score]
+//	slot:id:type:kdf:time:memory:threads:salt_hex:wrapped_key_hex
+func parseSlotConfig(text string) (*MasterPasswordConfig, error) {
+	lines := strings.Split(text, "\n")
+
+	header := splitConfig(strings.TrimSpace(lines[0]))
+	if len(header) != 4 && len(header) != 5 {
+		return nil, fmt.Errorf("invalid config header")
+	}
+
+	version, err := strconv.Atoi(header[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config version: %w", err)
+	}
+	if version != slotConfigVersion {
+		return nil, fmt.Errorf("unsupported config version %d", version)
+	}
+
+	generation, err := strconv.ParseUint(header[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key generation: %w", err)
+	}
+
+	config := &MasterPasswordConfig{
+		Version:       version,
+		IsInitialized: header[2] == "true",
+		Generation:    generation,
+		IdleTimeout:   DefaultIdleTimeout, // configs written before the auto-lock have no idle line
+		MinStrength:   strength.DefaultMinScore,
+	}
+
+	// Configs written before the cipher was configurable use AES-GCM
+	if len(header) == 5 {
+		if _, err := cipherAlgorithm(header[4]); err != nil {
+			return nil, err
+		}
+		config.Cipher = header[4]
+	}
+
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// The path is taken verbatim, it can contain colons
+		if path, ok := strings.CutPrefix(line, "keyfile:"); ok {
+			config.KeyfilePath = path
+			continue
+		}
+
+		if seconds, ok := strings.CutPrefix(line, "idle:"); ok {
+			timeout, err := strconv.Atoi(seconds)
+			if err != nil || timeout < 0 {
+				return nil, fmt.Errorf("invalid idle timeout: %s", seconds)
+			}
+			config.IdleTimeout = time.Duration(timeout) * time.Second
+			continue
+		}
+
+		if score, ok := strings.CutPrefix(line, "strength:"); ok {
+			minStrength, err := strconv.Atoi(score)
+			if err != nil || minStrength < 0 || minStrength > strength.MaxScore {
+				return nil, fmt.Errorf("invalid minimum password strength: %s", score)
+			}
+			config.MinStrength = minStrength
+			continue
+		}
+
+		if strings.HasPrefix(line, "lockout:") {
+			policy, err := parseLockoutLine(line)
+			if err != nil {
+				return nil, err
+			}
+			config.Lockout = policy
+			continue
+		}
+
+		slot, err := parseSlotLine(line)
+		if err != nil {
+			return nil, err
+		}
+		config.Slots = append(config.Slots, slot)
+	}
+
+	if config.IsInitialized && len(config.Slots) == 0 {
+		return nil, fmt.Errorf("config has no key slots")
+	}
+
+	return config, nil
+}
+
+// parseLockoutLine parses the lockout policy line of the version 2 format
+func parseLockoutLine(line string) (LockoutPolicy, error) {
+	parts := splitConfig(line)
+	if len(parts) != 3 {
+		return LockoutPolicy{}, fmt.Errorf("invalid lockout policy format")
+	}
+
+	maxFailures, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return LockoutPolicy{}, fmt.Errorf("invalid lockout attempt count: %s", parts[1])
+	}
+
+	policy := LockoutPolicy{MaxFailures: maxFailures, Action: parts[2]}
+	if err := validateLockout(policy); err != nil {
+		return LockoutPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// validateLockout checks a lockout policy read from the config
+func validateLockout(policy LockoutPolicy) error {
+	if policy.MaxFailures < 1 {
+		return fmt.Errorf("invalid lockout attempt count: %d", policy.MaxFailures)
+	}
+
+	switch policy.Action {
+	case LockoutLock, LockoutWipe:
+	default:
+		return fmt.Errorf("unknown lockout action: %s", policy.Action)
+	}
+
+	return nil
+}
+
+// parseSlotLine parses a single slot line of the version 2 format
+func parseSlotLine(line string) (KeySlot, error) {
+	parts := splitConfig(line)
+	if len(parts) != 9 || parts[0] != "slot" {
+		return KeySlot{}, fmt.Errorf("invalid key slot format")
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return KeySlot{}, fmt.Errorf("failed to decode key slot id: %w", err)
+	}
+
+	if !knownSlotType(parts[2]) {
+		return KeySlot{}, fmt.Errorf("unknown key slot type: %s", parts[2])
+	}
+
+	kdf, err := parseKDFFields(parts[3:7])
+	if err != nil {
+		return KeySlot{}, err
+	}
+
+	salt, err := hex.DecodeString(parts[7])
+	if err != nil {
+		return KeySlot{}, fmt.Errorf("failed to decode key slot salt: %w", err)
+	}
+
+	wrappedKey, err := hex.DecodeString(parts[8])
+	if err != nil {
+		return KeySlot{}, fmt.Errorf("failed to decode wrapped key: %w", err)
+	}
+
+	return KeySlot{
+		ID:         id,
+		Type:       parts[2],
+		KDF:        kdf,
+		Salt:       salt,
+		WrappedKey: wrappedKey,
+	}, nil
+}
+
+// knownSlotType reports whether a config may contain slots of type slotType
+func knownSlotType(slotType string) bool {
+	switch slotType {
+	case SlotPassword, SlotRecovery, SlotKeyfile, SlotShares:
+		return true
+	}
+	return false
+}
+
+// validateSlot checks a key slot decoded from the JSON format
+func validateSlot(slot KeySlot) error {
+	if !knownSlotType(slot.Type) {
+		return fmt.Errorf("unknown key slot type: %s", slot.Type)
+	}
+	if err := slot.KDF.Validate(); err != nil {
+		return fmt.Errorf("invalid kdf parameters in config: %w", err)
+	}
+	if len(slot.Salt) == 0 || len(slot.WrappedKey) == 0 {
+		return fmt.Errorf("key slot %d is incomplete", slot.ID)
+	}
+	return nil
+}
+
+// parseLegacyConfig parses the version 1 format:
+// salt_hex:encrypted_token_hex:initialized[:kdf:time:memory:threads[:generation]]
+// Configs with only three fields predate the KDF parameters and use legacy PBKDF2
+func parseLegacyConfig(text string) (*MasterPasswordConfig, error) {
+	parts := splitConfig(text)
+	if len(parts) != 3 && len(parts) != 7 && len(parts) != 8 {
+		return nil, fmt.Errorf("invalid config file format")
+	}
+
+	salt, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode salt: %w", err)
+	}
+
+	encryptedToken, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encrypted token: %w", err)
+	}
+
+	isInitialized := parts[2] == "true"
+
+	kdf := legacyKDFParams()
+	if len(parts) >= 7 {
+		kdf, err = parseKDFFields(parts[3:7])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var generation uint64
+	if len(parts) == 8 {
+		generation, err = strconv.ParseUint(parts[7], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key generation: %w", err)
+		}
+	}
+
+	return &MasterPasswordConfig{
+		Version:        1,
+		Salt:           salt,
+		EncryptedToken: encryptedToken,
+		IsInitialized:  isInitialized,
+		KDF:            kdf,
+		Generation:     generation,
+		IdleTimeout:    DefaultIdleTimeout,
+		MinStrength:    strength.DefaultMinScore,
+	}, nil
+}
+
+// parseKDFFields parses the algorithm:time:memory:threads fields of the config
+func parseKDFFields(fields []string) (KDFParams, error) {
+	timeCost, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return KDFParams{}, fmt.Errorf("failed to decode kdf time: %w", err)
+	}
+	memory, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return KDFParams{}, fmt.Errorf("failed to decode kdf memory: %w", err)
+	}
+	threads, err := strconv.ParseUint(fields[3], 10, 8)
+	if err != nil {
+		return KDFParams{}, fmt.Errorf("failed to decode kdf threads: %w", err)
+	}
+
+	params := KDFParams{
+		Algorithm: fields[0],
+		Time:      uint32(timeCost),
+		Memory:    uint32(memory),
+		Threads:   uint8(threads),
+	}
+	if err := params.Validate(); err != nil {
+		return KDFParams{}, fmt.Errorf("invalid kdf parameters in config: %w", err)
+	}
+
+	return params, nil
+}
+
+// writeConfig atomically replaces the config file at path with the current format
+func writeConfig(path string, config *MasterPasswordConfig) error {
+	data, err := encodeConfig(config)
+	if err != nil {
+		return err
+	}
+
+	// Write with restricted permissions (only owner can read/write)
+	if err := writeFileAtomic(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// encodeConfig renders config as a checksummed version 3 JSON document
+func encodeConfig(config *MasterPasswordConfig) ([]byte, error) {
+	doc := configDocument{
+		Initialized: config.IsInitialized,
+		Generation:  config.Generation,
+		Cipher:      config.Cipher,
+		KeyfilePath: config.KeyfilePath,
+		IdleSeconds: int(config.IdleTimeout / time.Second),
+		MinStrength: config.MinStrength,
+		Slots:       config.Slots,
+	}
+	if doc.Cipher == "" {
+		doc.Cipher = CipherAESGCM
+	}
+	if config.Lockout.MaxFailures > 0 {
+		doc.Lockout = &lockoutPolicy{MaxFailures: config.Lockout.MaxFailures, Action: config.Lockout.Action}
+	}
+	if doc.Slots == nil {
+		doc.Slots = []KeySlot{}
+	}
+
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+
+	data, err := json.MarshalIndent(configEnvelope{
+		Format:   configFormat,
+		Version:  configVersion,
+		Checksum: hex.EncodeToString(sum[:]),
+		Config:   raw,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// splitConfig splits the config string by colons
+func splitConfig(config string) []string {
+	parts := make([]string, 0, 3)
+	current := ""
+
+	for _, char := range config {
+		if char == ':' {
+			parts = append(parts, current)
+			current = ""
+		} else {
+			current += string(char)
+		}
+	}
+
+	if current != "" {
+		parts = append(parts, current)
+	}
+
+	return parts
+}
@@ -0,0 +1,332 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"svimpass/internal/strength"
+)
+
+func TestReadConfigVersions(t *testing.T) {
+	argon := DefaultKDFParams()
+	kdf := fmt.Sprintf("%s:%d:%d:%d", argon.Algorithm, argon.Time, argon.Memory, argon.Threads)
+	slot := testSlot(2, SlotRecovery)
+	slotLine := fmt.Sprintf("slot:2:%s:%s:%x:%x", SlotRecovery, kdf, slot.Salt, slot.WrappedKey)
+
+	jsonConfig, err := encodeConfig(&MasterPasswordConfig{
+		IsInitialized: true,
+		Generation:    4,
+		Cipher:        CipherXChaCha20Poly1305,
+		KeyfilePath:   "/media/usb/key:file",
+		Lockout:       LockoutPolicy{MaxFailures: 5, Action: LockoutWipe},
+		IdleTimeout:   5 * time.Minute,
+		MinStrength:   2,
+		Slots:         []KeySlot{slot},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want MasterPasswordConfig
+	}{
+		{
+			name: "version 1 before kdf parameters",
+			text: "0a0b:0c0d:true",
+			want: MasterPasswordConfig{
+				Version:        1,
+				IsInitialized:  true,
+				Salt:           []byte{0x0a, 0x0b},
+				EncryptedToken: []byte{0x0c, 0x0d},
+				KDF:            legacyKDFParams(),
+				IdleTimeout:    DefaultIdleTimeout,
+				MinStrength:    strength.DefaultMinScore,
+			},
+		},
+		{
+			name: "version 1 with kdf parameters",
+			text: "0a0b:0c0d:true:" + kdf,
+			want: MasterPasswordConfig{
+				Version:        1,
+				IsInitialized:  true,
+				Salt:           []byte{0x0a, 0x0b},
+				EncryptedToken: []byte{0x0c, 0x0d},
+				KDF:            argon,
+				IdleTimeout:    DefaultIdleTimeout,
+				MinStrength:    strength.DefaultMinScore,
+			},
+		},
+		{
+			name: "version 1 with generation",
+			text: "0a0b:0c0d:false:" + kdf + ":3\n",
+			want: MasterPasswordConfig{
+				Version:        1,
+				Generation:     3,
+				Salt:           []byte{0x0a, 0x0b},
+				EncryptedToken: []byte{0x0c, 0x0d},
+				KDF:            argon,
+				IdleTimeout:    DefaultIdleTimeout,
+				MinStrength:    strength.DefaultMinScore,
+			},
+		},
+		{
+			name: "version 2 before the cipher",
+			text: "svimpass:2:true:3\n" + slotLine + "\n",
+			want: MasterPasswordConfig{
+				Version:       2,
+				IsInitialized: true,
+				Generation:    3,
+				IdleTimeout:   DefaultIdleTimeout,
+				MinStrength:   strength.DefaultMinScore,
+				Slots:         []KeySlot{slot},
+			},
+		},
+		{
+			name: "version 2 with every line",
+			text: strings.Join([]string{
+				"svimpass:2:true:3:" + CipherXChaCha20Poly1305,
+				"keyfile:/media/usb/key:file",
+				"lockout:5:" + LockoutWipe,
+				"idle:300",
+				"strength:2",
+				slotLine,
+			}, "\n"),
+			want: MasterPasswordConfig{
+				Version:       2,
+				IsInitialized: true,
+				Generation:    3,
+				Cipher:        CipherXChaCha20Poly1305,
+				KeyfilePath:   "/media/usb/key:file",
+				Lockout:       LockoutPolicy{MaxFailures: 5, Action: LockoutWipe},
+				IdleTimeout:   5 * time.Minute,
+				MinStrength:   2,
+				Slots:         []KeySlot{slot},
+			},
+		},
+		{
+			name: "version 3",
+			text: string(jsonConfig),
+			want: MasterPasswordConfig{
+				Version:       3,
+				IsInitialized: true,
+				Generation:    4,
+				Cipher:        CipherXChaCha20Poly1305,
+				KeyfilePath:   "/media/usb/key:file",
+				Lockout:       LockoutPolicy{MaxFailures: 5, Action: LockoutWipe},
+				IdleTimeout:   5 * time.Minute,
+				MinStrength:   2,
+				Slots:         []KeySlot{slot},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(tt.text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := readConfig(path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: parsed as\n%+v\nwant\n%+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestReadConfigRejectsMalformed(t *testing.T) {
+	argon := DefaultKDFParams()
+	kdf := fmt.Sprintf("%s:%d:%d:%d", argon.Algorithm, argon.Time, argon.Memory, argon.Threads)
+	slot := testSlot(1, SlotPassword)
+	slotLine := fmt.Sprintf("slot:1:%s:%s:%x:%x", SlotPassword, kdf, slot.Salt, slot.WrappedKey)
+
+	valid, err := encodeConfig(&MasterPasswordConfig{IsInitialized: true, Generation: 2, Slots: []KeySlot{slot}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"version 1 field count", "0a0b:0c0d:true:" + argon.Algorithm},
+		{"version 1 salt not hex", "zz:0c0d:true"},
+		{"version 1 invalid kdf", "0a0b:0c0d:true:" + argon.Algorithm + ":0:0:0"},
+		{"version 1 bad generation", "0a0b:0c0d:true:" + kdf + ":x"},
+		{"version 2 unsupported version", "svimpass:9:true:3\n" + slotLine},
+		{"version 2 short header", "svimpass:2:true\n" + slotLine},
+		{"version 2 unknown cipher", "svimpass:2:true:3:rot13\n" + slotLine},
+		{"version 2 no slots", "svimpass:2:true:3\n"},
+		{"version 2 unknown slot type", "svimpass:2:true:3\n" + strings.Replace(slotLine, SlotPassword, "fingerprint", 1)},
+		{"version 2 truncated slot", "svimpass:2:true:3\n" + slotLine[:len(slotLine)-len(fmt.Sprintf("%x", slot.WrappedKey))-1]},
+		{"version 2 bad lockout", "svimpass:2:true:3\nlockout:0:lock\n" + slotLine},
+		{"version 2 bad idle timeout", "svimpass:2:true:3\nidle:-1\n" + slotLine},
+		{"version 2 bad strength", "svimpass:2:true:3\nstrength:9\n" + slotLine},
+		{"version 3 bad checksum", string(withGeneration(t, valid, 3))},
+		{"version 3 checksum not hex", string(withEnvelope(t, valid, func(envelope *configEnvelope) { envelope.Checksum = "zz" }))},
+		{"version 3 unknown format", string(withEnvelope(t, valid, func(envelope *configEnvelope) { envelope.Format = "other" }))},
+		{"version 3 newer version", string(withEnvelope(t, valid, func(envelope *configEnvelope) { envelope.Version = configVersion + 1 }))},
+		{"version 3 truncated", string(valid[:len(valid)/2])},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(tt.text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if config, err := readConfig(path); err == nil {
+			t.Errorf("%s: accepted as %+v", tt.name, config)
+		}
+	}
+}
+
+func TestParseJSONConfigChecksum(t *testing.T) {
+	valid, err := encodeConfig(&MasterPasswordConfig{IsInitialized: true, Generation: 2, Slots: []KeySlot{testSlot(1, SlotPassword)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The checksum covers the compacted document, so reformatting keeps it valid
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, valid, "", "\t"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseJSONConfig(indented.Bytes()); err != nil {
+		t.Errorf("reformatted config rejected: %v", err)
+	}
+
+	flipped := withEnvelope(t, valid, func(envelope *configEnvelope) {
+		// Still hex, so only the comparison can reject it
+		digit := "0"
+		if envelope.Checksum[0] == '0' {
+			digit = "1"
+		}
+		envelope.Checksum = digit + envelope.Checksum[1:]
+	})
+	if _, err := parseJSONConfig(flipped); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("flipped checksum: got %v, want a checksum mismatch", err)
+	}
+}
+
+func TestLoadConfigRestoresCopy(t *testing.T) {
+	config := &MasterPasswordConfig{IsInitialized: true, Generation: 5, Slots: []KeySlot{testSlot(1, SlotPassword)}}
+	copyData, err := encodeConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config []byte // nil leaves no config file
+	}{
+		{"missing", nil},
+		{"empty", []byte{}},
+		{"truncated", copyData[:len(copyData)/2]},
+		{"bad checksum", withGeneration(t, copyData, 6)},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		mpm := &MasterPasswordManager{
+			configPath: filepath.Join(dir, "config.json"),
+			copyPath:   filepath.Join(dir, "config.copy.json"),
+		}
+		if err := os.WriteFile(mpm.copyPath, copyData, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if tt.config != nil {
+			if err := os.WriteFile(mpm.configPath, tt.config, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := mpm.loadConfig(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := mpm.currentConfig(); got.Generation != 5 || !reflect.DeepEqual(got.Slots, config.Slots) {
+			t.Errorf("%s: restored %+v", tt.name, got)
+		}
+		if restored, err := os.ReadFile(mpm.configPath); err != nil || !bytes.Equal(restored, copyData) {
+			t.Errorf("%s: config file not restored from the copy: %v", tt.name, err)
+		}
+	}
+}
+
+func TestLoadConfigRejectsDamagedCopy(t *testing.T) {
+	dir := t.TempDir()
+	mpm := &MasterPasswordManager{
+		configPath: filepath.Join(dir, "config.json"),
+		copyPath:   filepath.Join(dir, "config.copy.json"),
+	}
+	if err := os.WriteFile(mpm.configPath, []byte("svimpass:2:true"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mpm.copyPath, []byte(`{"format":"svimpass-config"`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mpm.loadConfig(); err == nil {
+		t.Fatalf("damaged config and copy accepted as %+v", mpm.currentConfig())
+	}
+}
+
+// testSlot returns a slot with made up salt and wrapped key, parsing never unwraps it
+func testSlot(id int, slotType string) KeySlot {
+	return KeySlot{
+		ID:         id,
+		Type:       slotType,
+		KDF:        DefaultKDFParams(),
+		Salt:       bytes.Repeat([]byte{byte(id)}, saltSize),
+		WrappedKey: bytes.Repeat([]byte{0xab}, 60),
+	}
+}
+
+// withGeneration changes the generation of a version 3 config, keeping its checksum
+func withGeneration(t *testing.T, data []byte, generation uint64) []byte {
+	t.Helper()
+
+	return withEnvelope(t, data, func(envelope *configEnvelope) {
+		var doc configDocument
+		if err := json.Unmarshal(envelope.Config, &doc); err != nil {
+			t.Fatal(err)
+		}
+		doc.Generation = generation
+
+		config, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		envelope.Config = config
+	})
+}
+
+// withEnvelope re-encodes a version 3 config after change modified its envelope
+func withEnvelope(t *testing.T, data []byte, change func(envelope *configEnvelope)) []byte {
+	t.Helper()
+
+	var envelope configEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	change(&envelope)
+
+	changed, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changed
+}
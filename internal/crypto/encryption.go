@@ -1,40 +1,106 @@
-// Package crypto provides functions for deriving encryption keys,
-// generating salts, and performing AES-GCM encryption and decryption.
+// Package crypto provides functions for deriving encryption keys with Argon2id,
+// generating salts, and performing AES-GCM or XChaCha20-Poly1305 encryption and decryption.
 package crypto
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
-	"crypto/sha256"
 	"fmt"
 	"io"
-
-	"golang.org/x/crypto/pbkdf2"
+	"sync"
+	"sync/atomic"
 )
 
 const (
-	saltSize   = 32
-	keySize    = 32 // this should be AES-256
-	iterations = 1000
+	saltSize = 32
+	keySize  = 32 // this should be AES-256
 )
 
 type EncryptionKey struct {
-	key  []byte
+	key  *SecureBuffer
 	salt []byte
+	alg  atomic.Uint32 // envelope algorithm of new ciphertexts, AES-GCM when unset, see SetCipher
+
+	legacyMu    sync.Mutex
+	legacy      bool // entries may still hold legacy blobs, see AllowLegacy
+	legacyAfter int
+}
+
+// AllowLegacy lets DecryptField and DecryptSecret accept legacy blobs, which carry
+// no binding, for entries with an ID above afterID: those not upgraded to
+// envelopes yet. Keys refuse legacy blobs until this is called.
+func (ek *EncryptionKey) AllowLegacy(afterID int) {
+	ek.legacyMu.Lock()
+	defer ek.legacyMu.Unlock()
+	ek.legacy = true
+	ek.legacyAfter = afterID
+}
+
+// LegacyUpgraded narrows AllowLegacy to the entries after lastID, as an upgrade
+// rewrites them to envelopes. It never allows legacy blobs on its own.
+func (ek *EncryptionKey) LegacyUpgraded(lastID int) {
+	ek.legacyMu.Lock()
+	defer ek.legacyMu.Unlock()
+	ek.legacyAfter = max(ek.legacyAfter, lastID)
+}
+
+// RefuseLegacy makes ek accept envelopes only, once no legacy blob is left
+func (ek *EncryptionKey) RefuseLegacy() {
+	ek.legacyMu.Lock()
+	defer ek.legacyMu.Unlock()
+	ek.legacy = false
 }
 
-func DeriveKey(masterPassword string, salt []byte) *EncryptionKey {
+// legacyAllowed reports whether a legacy blob of entryID may be decrypted
+func (ek *EncryptionKey) legacyAllowed(entryID int) bool {
+	ek.legacyMu.Lock()
+	defer ek.legacyMu.Unlock()
+	return ek.legacy && entryID > ek.legacyAfter
+}
+
+// DeriveKey derives the encryption key from the master password using the given KDF parameters
+func DeriveKey(masterPassword string, salt []byte, params KDFParams) (*EncryptionKey, error) {
 	if salt == nil {
 		salt = generateSalt()
 	}
 
-	key := pbkdf2.Key([]byte(masterPassword), salt, iterations, keySize, sha256.New)
+	password := []byte(masterPassword)
+	defer Wipe(password)
+
+	return newEncryptionKey(deriveKeyBytes(password, salt, params), salt)
+}
 
-	return &EncryptionKey{
-		key:  key,
-		salt: salt,
+// newVaultKey generates the random data encryption key that protects the vault
+func newVaultKey() (*EncryptionKey, error) {
+	key, err := NewSecureBuffer(keySize)
+	if err != nil {
+		return nil, err
+	}
+	err = key.With(func(b []byte) error {
+		_, err := rand.Read(b)
+		return err
+	})
+	if err != nil {
+		key.Destroy()
+		return nil, fmt.Errorf("failed to generate vault key: %w", err)
 	}
+	return &EncryptionKey{key: key}, nil
+}
+
+// newEncryptionKey moves key into secure memory, wiping the original
+func newEncryptionKey(key, salt []byte) (*EncryptionKey, error) {
+	secureKey, err := SecureBufferFrom(key)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptionKey{key: secureKey, salt: salt}, nil
+}
+
+// Destroy wipes the key from memory, the key cannot be used afterwards
+func (ek *EncryptionKey) Destroy() {
+	if ek == nil {
+		return
+	}
+	ek.key.Destroy()
 }
 
 func generateSalt() []byte {
@@ -49,17 +115,44 @@ func (ek *EncryptionKey) GetSalt() []byte {
 	return ek.salt
 }
 
+// Cipher returns the name of the cipher new ciphertexts are encrypted with
+func (ek *EncryptionKey) Cipher() string {
+	return cipherName(ek.algorithm())
+}
+
+// SetCipher selects the cipher new ciphertexts are encrypted with. It may be called
+// while other goroutines encrypt with ek, they switch with their next ciphertext.
+func (ek *EncryptionKey) SetCipher(name string) error {
+	alg, err := cipherAlgorithm(name)
+	if err != nil {
+		return err
+	}
+	ek.alg.Store(uint32(alg))
+	return nil
+}
+
+// Encrypt encrypts plaintext into an envelope that is not bound to an entry
 func (ek *EncryptionKey) Encrypt(plaintext string) ([]byte, error) {
+	return ek.EncryptField(plaintext, 0, "")
+}
+
+// EncryptField encrypts plaintext into an envelope bound to a field of an entry,
+// so the ciphertext cannot be moved to another row or column unnoticed
+func (ek *EncryptionKey) EncryptField(plaintext string, entryID int, field string) ([]byte, error) {
 	if plaintext == "" {
 		return nil, fmt.Errorf("your password cannot be blank")
 	}
 
-	block, err := aes.NewCipher(ek.key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create a cipher %w", err)
-	}
-	// Create GCM mode
-	gcm, err := cipher.NewGCM(block)
+	plaintextBytes := []byte(plaintext)
+	defer Wipe(plaintextBytes)
+
+	return ek.sealEnvelope(plaintextBytes, entryID, field)
+}
+
+// seal encrypts raw bytes as a bare AES-GCM nonce||ciphertext, the format of
+// wrapped key slots and of entries written before envelopes
+func (ek *EncryptionKey) seal(plaintext []byte) ([]byte, error) {
+	gcm, err := ek.aead(algAESGCM)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
@@ -71,30 +164,87 @@ func (ek *EncryptionKey) Encrypt(plaintext string) ([]byte, error) {
 	}
 
 	// encrypt the data
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
 
 	return ciphertext, nil
 }
 
+// Decrypt decrypts a ciphertext produced by Encrypt or a legacy nonce||ciphertext
+// blob, such as the verification token of a version 1 config
 func (ek *EncryptionKey) Decrypt(ciphertext []byte) (string, error) {
-	if len(ciphertext) == 0 {
-		return "", fmt.Errorf("the cipher text must not be empty")
+	plaintext, err := ek.decrypt(ciphertext, 0, "", true)
+	if err != nil {
+		return "", err
 	}
-	block, err := aes.NewCipher(ek.key)
+	defer Wipe(plaintext)
+
+	return string(plaintext), nil
+}
+
+// DecryptField decrypts a ciphertext produced by EncryptField for the same entry and
+// field. Legacy nonce||ciphertext blobs, which carry no binding, are only accepted
+// for the entries AllowLegacy allows them for.
+func (ek *EncryptionKey) DecryptField(ciphertext []byte, entryID int, field string) (string, error) {
+	plaintext, err := ek.decryptField(ciphertext, entryID, field)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return "", err
 	}
+	defer Wipe(plaintext)
+
+	return string(plaintext), nil
+}
 
-	// Create GCM mode
-	gcm, err := cipher.NewGCM(block)
+// DecryptSecret works like DecryptField but returns the plaintext in a SecureBuffer,
+// for secrets that should not linger in memory as an unwipeable string
+func (ek *EncryptionKey) DecryptSecret(ciphertext []byte, entryID int, field string) (*SecureBuffer, error) {
+	plaintext, err := ek.decryptField(ciphertext, entryID, field)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
+	}
+
+	return SecureBufferFrom(plaintext)
+}
+
+// decryptField opens an envelope, or a legacy blob of an entry still allowed to hold one
+func (ek *EncryptionKey) decryptField(ciphertext []byte, entryID int, field string) ([]byte, error) {
+	return ek.decrypt(ciphertext, entryID, field, ek.legacyAllowed(entryID))
+}
+
+// decrypt opens an envelope, or a legacy blob when legacy is set
+func (ek *EncryptionKey) decrypt(ciphertext []byte, entryID int, field string, legacy bool) ([]byte, error) {
+	if isEnvelope(ciphertext) {
+		plaintext, err := ek.openEnvelope(ciphertext, entryID, field)
+		if err == nil || !legacy {
+			return plaintext, err
+		}
+
+		// A legacy nonce can start with the envelope magic by chance
+		if plaintext, legacyErr := ek.open(ciphertext); legacyErr == nil {
+			return plaintext, nil
+		}
+		return nil, err
+	}
+
+	if !legacy {
+		return nil, fmt.Errorf("refusing unbound legacy ciphertext of entry %d", entryID)
+	}
+	return ek.open(ciphertext)
+}
+
+// open decrypts a nonce||ciphertext blob produced by seal
+func (ek *EncryptionKey) open(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return nil, fmt.Errorf("the cipher text must not be empty")
+	}
+	gcm, err := ek.aead(algAESGCM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
 
 	// Extract nonce and encrypted data
 	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short")
+		return nil, fmt.Errorf("ciphertext too short")
 	}
 
 	nonce, encryptedData := ciphertext[:nonceSize], ciphertext[nonceSize:]
@@ -102,10 +252,8 @@ func (ek *EncryptionKey) Decrypt(ciphertext []byte) (string, error) {
 	// Decrypt the data
 	plaintext, err := gcm.Open(nil, nonce, encryptedData, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt: %w", err)
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
 	}
 
-	return string(plaintext), nil
+	return plaintext, nil
 }
-
-// TODO: ZEROout all the stata from the memory for security
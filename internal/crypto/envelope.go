@@ -0,0 +1,204 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Ciphers available for new envelopes
+const (
+	CipherAESGCM            = "aes-256-gcm"
+	CipherXChaCha20Poly1305 = "xchacha20-poly1305"
+)
+
+// Envelope layout: magic(3) || version(1) || algorithm(1) || nonce || ciphertext.
+// The header, the entry ID and the field name are bound as associated data, and
+// the plaintext is padded so the ciphertext length only reveals a size bucket.
+const (
+	envelopeMagic      = "SVP"
+	envelopeVersion    = 1
+	envelopeHeaderSize = len(envelopeMagic) + 2
+
+	algAESGCM            byte = 1
+	algXChaCha20Poly1305 byte = 2
+
+	// Plaintexts are padded to the smallest bucket that fits, and to multiples
+	// of the largest bucket beyond it
+	minPaddingBucket = 32
+	maxPaddingBucket = 256
+)
+
+// cipherAlgorithm returns the envelope algorithm byte of a cipher name
+func cipherAlgorithm(name string) (byte, error) {
+	switch name {
+	case CipherAESGCM:
+		return algAESGCM, nil
+	case CipherXChaCha20Poly1305:
+		return algXChaCha20Poly1305, nil
+	default:
+		return 0, fmt.Errorf("unknown cipher %q, use %s or %s", name, CipherAESGCM, CipherXChaCha20Poly1305)
+	}
+}
+
+// cipherName returns the cipher name of an envelope algorithm byte
+func cipherName(alg byte) string {
+	switch alg {
+	case algXChaCha20Poly1305:
+		return CipherXChaCha20Poly1305
+	default:
+		return CipherAESGCM
+	}
+}
+
+// algorithm returns the envelope algorithm new ciphertexts are sealed with
+func (ek *EncryptionKey) algorithm() byte {
+	if alg := byte(ek.alg.Load()); alg != 0 {
+		return alg
+	}
+	return algAESGCM
+}
+
+// aead returns the AEAD of the given envelope algorithm keyed with ek. The AEAD
+// expands its own copy of the key, so it stays usable if ek is destroyed meanwhile.
+func (ek *EncryptionKey) aead(alg byte) (cipher.AEAD, error) {
+	var aead cipher.AEAD
+	err := ek.key.With(func(key []byte) error {
+		switch alg {
+		case algAESGCM:
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				return fmt.Errorf("failed to create a cipher %w", err)
+			}
+			aead, err = cipher.NewGCM(block)
+			return err
+		case algXChaCha20Poly1305:
+			var err error
+			aead, err = chacha20poly1305.NewX(key)
+			return err
+		default:
+			return fmt.Errorf("unknown envelope algorithm %d", alg)
+		}
+	})
+	return aead, err
+}
+
+// sealEnvelope encrypts plaintext into an envelope bound to entryID and field
+func (ek *EncryptionKey) sealEnvelope(plaintext []byte, entryID int, field string) ([]byte, error) {
+	alg := ek.algorithm()
+	aead, err := ek.aead(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	header := []byte{envelopeMagic[0], envelopeMagic[1], envelopeMagic[2], envelopeVersion, alg}
+
+	envelope := make([]byte, len(header)+aead.NonceSize(), len(header)+aead.NonceSize()+paddedSize(len(plaintext))+aead.Overhead())
+	copy(envelope, header)
+	nonce := envelope[len(header):]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	padded := pad(plaintext)
+	defer Wipe(padded)
+
+	return aead.Seal(envelope, nonce, padded, envelopeAD(header, entryID, field)), nil
+}
+
+// openEnvelope decrypts an envelope produced by sealEnvelope for the same entryID and field
+func (ek *EncryptionKey) openEnvelope(envelope []byte, entryID int, field string) ([]byte, error) {
+	if !isEnvelope(envelope) {
+		return nil, fmt.Errorf("not an envelope")
+	}
+	if envelope[len(envelopeMagic)] != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", envelope[len(envelopeMagic)])
+	}
+
+	header := envelope[:envelopeHeaderSize]
+	aead, err := ek.aead(header[len(header)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(envelope) < envelopeHeaderSize+aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce := envelope[envelopeHeaderSize : envelopeHeaderSize+aead.NonceSize()]
+	encryptedData := envelope[envelopeHeaderSize+aead.NonceSize():]
+
+	padded, err := aead.Open(nil, nonce, encryptedData, envelopeAD(header, entryID, field))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	plaintext, err := unpad(padded)
+	if err != nil {
+		Wipe(padded)
+		return nil, err
+	}
+	// Wipe the padding, the plaintext shares the rest of the buffer
+	Wipe(padded[len(plaintext):])
+	return plaintext, nil
+}
+
+// NeedsUpgrade reports whether ciphertext is a legacy blob or an envelope using
+// another cipher or version than the one ek encrypts with
+func (ek *EncryptionKey) NeedsUpgrade(ciphertext []byte) bool {
+	if !isEnvelope(ciphertext) {
+		return true
+	}
+	return ciphertext[len(envelopeMagic)] != envelopeVersion ||
+		ciphertext[envelopeHeaderSize-1] != ek.algorithm()
+}
+
+// isEnvelope reports whether ciphertext starts with an envelope header
+func isEnvelope(ciphertext []byte) bool {
+	return len(ciphertext) >= envelopeHeaderSize && bytes.HasPrefix(ciphertext, []byte(envelopeMagic))
+}
+
+// envelopeAD builds the associated data header || entry ID || field name
+func envelopeAD(header []byte, entryID int, field string) []byte {
+	ad := make([]byte, 0, len(header)+8+len(field))
+	ad = append(ad, header...)
+	ad = binary.BigEndian.AppendUint64(ad, uint64(entryID))
+	return append(ad, field...)
+}
+
+// paddedSize returns the size of plaintext after pad
+func paddedSize(n int) int {
+	// At least one byte of padding is always added
+	n++
+	for bucket := minPaddingBucket; bucket <= maxPaddingBucket; bucket *= 2 {
+		if n <= bucket {
+			return bucket
+		}
+	}
+	return (n + maxPaddingBucket - 1) / maxPaddingBucket * maxPaddingBucket
+}
+
+// pad applies ISO/IEC 7816-4 padding: a 0x80 byte followed by zeros up to the bucket size
+func pad(plaintext []byte) []byte {
+	padded := make([]byte, paddedSize(len(plaintext)))
+	copy(padded, plaintext)
+	padded[len(plaintext)] = 0x80
+	return padded
+}
+
+// unpad removes the padding added by pad
+func unpad(padded []byte) ([]byte, error) {
+	i := len(padded) - 1
+	for i >= 0 && padded[i] == 0 {
+		i--
+	}
+	if i < 0 || padded[i] != 0x80 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return padded[:i], nil
+}
@@ -0,0 +1,193 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	plaintexts := []string{
+		"p",
+		"correct horse battery staple",
+		strings.Repeat("x", minPaddingBucket-1),
+		strings.Repeat("x", minPaddingBucket),
+		strings.Repeat("x", maxPaddingBucket),
+		strings.Repeat("ü", maxPaddingBucket+1),
+	}
+
+	for _, cipherName := range []string{CipherAESGCM, CipherXChaCha20Poly1305} {
+		key := testKey(t)
+		if err := key.SetCipher(cipherName); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, plaintext := range plaintexts {
+			envelope, err := key.EncryptField(plaintext, 42, "password")
+			if err != nil {
+				t.Fatalf("%s: encrypt %d bytes: %v", cipherName, len(plaintext), err)
+			}
+			if !isEnvelope(envelope) || key.NeedsUpgrade(envelope) {
+				t.Fatalf("%s: %d bytes not sealed in a current envelope", cipherName, len(plaintext))
+			}
+			// Random bytes can match a short plaintext by chance
+			if len(plaintext) > 8 && bytes.Contains(envelope, []byte(plaintext)) {
+				t.Fatalf("%s: %d bytes sealed in the clear", cipherName, len(plaintext))
+			}
+
+			got, err := key.DecryptField(envelope, 42, "password")
+			if err != nil {
+				t.Fatalf("%s: decrypt %d bytes: %v", cipherName, len(plaintext), err)
+			}
+			if got != plaintext {
+				t.Fatalf("%s: %d bytes decrypted as %d bytes", cipherName, len(plaintext), len(got))
+			}
+
+			secret, err := key.DecryptSecret(envelope, 42, "password")
+			if err != nil {
+				t.Fatalf("%s: decrypt secret of %d bytes: %v", cipherName, len(plaintext), err)
+			}
+			revealed, err := secret.Reveal()
+			secret.Destroy()
+			if err != nil || revealed != plaintext {
+				t.Fatalf("%s: secret of %d bytes decrypted wrong: %v", cipherName, len(plaintext), err)
+			}
+		}
+	}
+}
+
+func TestEnvelopeOpensAfterCipherChange(t *testing.T) {
+	key := testKey(t)
+	envelope, err := key.EncryptField("secret", 1, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := key.SetCipher(CipherXChaCha20Poly1305); err != nil {
+		t.Fatal(err)
+	}
+	if !key.NeedsUpgrade(envelope) {
+		t.Error("envelope of the previous cipher not marked for upgrade")
+	}
+	if got, err := key.DecryptField(envelope, 1, "password"); err != nil || got != "secret" {
+		t.Errorf("envelope of the previous cipher: got %q, %v", got, err)
+	}
+}
+
+func TestEnvelopeRejectsSwappedAssociatedData(t *testing.T) {
+	for _, cipherName := range []string{CipherAESGCM, CipherXChaCha20Poly1305} {
+		key := testKey(t)
+		if err := key.SetCipher(cipherName); err != nil {
+			t.Fatal(err)
+		}
+		envelope, err := key.EncryptField("secret", 7, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		otherAlg := algXChaCha20Poly1305
+		if cipherName == CipherXChaCha20Poly1305 {
+			otherAlg = algAESGCM
+		}
+		otherVersion := bytes.Clone(envelope)
+		otherVersion[len(envelopeMagic)]++
+		relabeled := bytes.Clone(envelope)
+		relabeled[envelopeHeaderSize-1] = otherAlg
+		tampered := bytes.Clone(envelope)
+		tampered[len(tampered)-1] ^= 1
+
+		tests := []struct {
+			name     string
+			envelope []byte
+			entryID  int
+			field    string
+		}{
+			{"other entry", envelope, 8, "password"},
+			{"other field", envelope, 7, "username"},
+			{"field moved into the entry ID", envelope, 0, "password\x00"},
+			{"unbound", envelope, 0, ""},
+			{"other version", otherVersion, 7, "password"},
+			{"other algorithm", relabeled, 7, "password"},
+			{"tampered ciphertext", tampered, 7, "password"},
+			{"truncated", envelope[:envelopeHeaderSize+4], 7, "password"},
+		}
+
+		for _, tt := range tests {
+			if got, err := key.DecryptField(tt.envelope, tt.entryID, tt.field); err == nil {
+				t.Errorf("%s, %s: decrypted as %q", cipherName, tt.name, got)
+			}
+		}
+	}
+}
+
+func TestEnvelopeRejectsOtherKey(t *testing.T) {
+	envelope, err := testKey(t).EncryptField("secret", 1, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := testKey(t).DecryptField(envelope, 1, "password"); err == nil {
+		t.Errorf("opened with another key as %q", got)
+	}
+}
+
+func TestEnvelopeLegacyBlobs(t *testing.T) {
+	key := testKey(t)
+	blob, err := key.seal([]byte("legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := key.DecryptField(blob, 3, "password"); err == nil {
+		t.Error("legacy blob accepted before AllowLegacy")
+	}
+
+	key.AllowLegacy(0)
+	if got, err := key.DecryptField(blob, 3, "password"); err != nil || got != "legacy" {
+		t.Errorf("legacy blob after AllowLegacy: got %q, %v", got, err)
+	}
+
+	key.LegacyUpgraded(3)
+	if _, err := key.DecryptField(blob, 3, "password"); err == nil {
+		t.Error("legacy blob accepted for an upgraded entry")
+	}
+	if _, err := key.DecryptField(blob, 4, "password"); err != nil {
+		t.Errorf("legacy blob of an entry not upgraded yet: %v", err)
+	}
+
+	key.RefuseLegacy()
+	if _, err := key.DecryptField(blob, 4, "password"); err == nil {
+		t.Error("legacy blob accepted after RefuseLegacy")
+	}
+}
+
+func TestPadding(t *testing.T) {
+	for n := 0; n <= 2*maxPaddingBucket+1; n++ {
+		plaintext := bytes.Repeat([]byte{0}, n)
+		padded := pad(plaintext)
+		if len(padded) != paddedSize(n) || len(padded) <= n {
+			t.Fatalf("%d bytes padded to %d", n, len(padded))
+		}
+
+		got, err := unpad(padded)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Fatalf("%d bytes unpadded to %d bytes: %v", n, len(got), err)
+		}
+	}
+
+	if _, err := unpad(make([]byte, minPaddingBucket)); err == nil {
+		t.Error("padding without its marker accepted")
+	}
+}
+
+// testKey returns a random vault key that is destroyed when the test ends
+func testKey(t *testing.T) *EncryptionKey {
+	t.Helper()
+
+	key, err := newVaultKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(key.Destroy)
+	return key
+}
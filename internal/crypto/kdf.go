@@ -0,0 +1,116 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Supported key derivation algorithms
+const (
+	KDFArgon2id = "argon2id"
+	KDFPBKDF2   = "pbkdf2-sha256"
+)
+
+const (
+	// Argon2id defaults follow the second recommended option of RFC 9106
+	defaultArgonTime    = 3
+	defaultArgonMemory  = 64 * 1024 // KiB
+	defaultArgonThreads = 4
+
+	// Limits accepted when raising the parameters with :kdf
+	maxArgonTime    = 64
+	maxArgonMemory  = 4 * 1024 * 1024 // KiB
+	maxArgonThreads = 64
+
+	// Vaults created before Argon2id used PBKDF2-SHA256 with this iteration count
+	legacyPBKDF2Iterations = 1000
+)
+
+// KDFParams describes how the master key is derived from the master password.
+// For PBKDF2 only Time is used and holds the iteration count.
+type KDFParams struct {
+	Algorithm string `json:"algorithm"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"` // KiB, Argon2id only
+	Threads   uint8  `json:"threads"`
+}
+
+// DefaultKDFParams returns the parameters used for new and upgraded vaults
+func DefaultKDFParams() KDFParams {
+	return KDFParams{
+		Algorithm: KDFArgon2id,
+		Time:      defaultArgonTime,
+		Memory:    defaultArgonMemory,
+		Threads:   defaultArgonThreads,
+	}
+}
+
+// legacyKDFParams returns the parameters of configs written before the KDF was recorded
+func legacyKDFParams() KDFParams {
+	return KDFParams{
+		Algorithm: KDFPBKDF2,
+		Time:      legacyPBKDF2Iterations,
+	}
+}
+
+// Validate checks that the parameters are usable
+func (p KDFParams) Validate() error {
+	switch p.Algorithm {
+	case KDFArgon2id:
+		if p.Time < 1 || p.Time > maxArgonTime {
+			return fmt.Errorf("argon2id time must be between 1 and %d", maxArgonTime)
+		}
+		if p.Threads < 1 || p.Threads > maxArgonThreads {
+			return fmt.Errorf("argon2id threads must be between 1 and %d", maxArgonThreads)
+		}
+		if p.Memory < 8*uint32(p.Threads) || p.Memory > maxArgonMemory {
+			return fmt.Errorf("argon2id memory must be between %d and %d KiB", 8*uint32(p.Threads), maxArgonMemory)
+		}
+	case KDFPBKDF2:
+		if p.Time < 1 {
+			return fmt.Errorf("pbkdf2 iterations must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown key derivation algorithm: %s", p.Algorithm)
+	}
+	return nil
+}
+
+// WeakerThan reports whether p is cheaper than other in any dimension
+func (p KDFParams) WeakerThan(other KDFParams) bool {
+	if p.Algorithm != other.Algorithm {
+		return p.Algorithm != KDFArgon2id
+	}
+	return p.Time < other.Time || p.Memory < other.Memory || p.Threads < other.Threads
+}
+
+// upgradedKDFParams returns the element-wise maximum of p and the defaults
+func upgradedKDFParams(p KDFParams) KDFParams {
+	upgraded := DefaultKDFParams()
+	if p.Algorithm != KDFArgon2id {
+		return upgraded
+	}
+	upgraded.Time = max(upgraded.Time, p.Time)
+	upgraded.Memory = max(upgraded.Memory, p.Memory)
+	upgraded.Threads = max(upgraded.Threads, p.Threads)
+	return upgraded
+}
+
+// String returns a human readable summary of the parameters
+func (p KDFParams) String() string {
+	if p.Algorithm == KDFPBKDF2 {
+		return fmt.Sprintf("%s (iterations=%d)", p.Algorithm, p.Time)
+	}
+	return fmt.Sprintf("%s (time=%d, memory=%d KiB, threads=%d)", p.Algorithm, p.Time, p.Memory, p.Threads)
+}
+
+// deriveKeyBytes runs the configured KDF over the password
+func deriveKeyBytes(password, salt []byte, params KDFParams) []byte {
+	if params.Algorithm == KDFPBKDF2 {
+		return pbkdf2.Key(password, salt, int(params.Time), keySize, sha256.New)
+	}
+	return argon2.IDKey(password, salt, params.Time, params.Memory, params.Threads, keySize)
+}
@@ -0,0 +1,182 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Key slot types. Every slot wraps the same random vault key with a key
+// derived from a different secret, similar to LUKS key slots.
+const (
+	SlotPassword = "password"
+	SlotRecovery = "recovery"
+	SlotKeyfile  = "keyfile"
+	SlotShares   = "shares" // Secret split into Shamir shares by SplitKey
+)
+
+const (
+	recoveryKeySize = 32
+	keyfileSize     = 64
+)
+
+// KeySlot holds the vault key wrapped with a key derived from one unlock secret
+type KeySlot struct {
+	ID         int       `json:"id"`
+	Type       string    `json:"type"`
+	KDF        KDFParams `json:"kdf"`
+	Salt       []byte    `json:"salt"`
+	WrappedKey []byte    `json:"wrapped_key"`
+}
+
+// String returns a human readable summary of the slot
+func (ks KeySlot) String() string {
+	return fmt.Sprintf("#%d %s %s", ks.ID, ks.Type, ks.KDF)
+}
+
+// newKeySlot wraps vaultKey with a key derived from secret
+func newKeySlot(id int, slotType string, secret []byte, params KDFParams, vaultKey *EncryptionKey) (KeySlot, error) {
+	slotKey, err := deriveSlotKey(secret, generateSalt(), params)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	defer slotKey.Destroy()
+
+	var wrappedKey []byte
+	err = vaultKey.key.With(func(key []byte) error {
+		wrappedKey, err = slotKey.seal(key)
+		return err
+	})
+	if err != nil {
+		return KeySlot{}, fmt.Errorf("failed to wrap vault key: %w", err)
+	}
+
+	return KeySlot{
+		ID:         id,
+		Type:       slotType,
+		KDF:        params,
+		Salt:       slotKey.salt,
+		WrappedKey: wrappedKey,
+	}, nil
+}
+
+// unwrap returns the vault key if secret belongs to the slot
+func (ks KeySlot) unwrap(secret []byte) (*EncryptionKey, error) {
+	slotKey, err := deriveSlotKey(secret, ks.Salt, ks.KDF)
+	if err != nil {
+		return nil, err
+	}
+	defer slotKey.Destroy()
+
+	key, err := slotKey.open(ks.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEncryptionKey(key, nil)
+}
+
+// deriveSlotKey derives the key wrapping the vault key in a slot
+func deriveSlotKey(secret, salt []byte, params KDFParams) (*EncryptionKey, error) {
+	return newEncryptionKey(deriveKeyBytes(secret, salt, params), salt)
+}
+
+// generateRecoveryKey returns a random recovery key and its printable form, a
+// 24 word BIP39 mnemonic whose last word carries a checksum against typos
+func generateRecoveryKey() ([]byte, string, error) {
+	secret := make([]byte, recoveryKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate recovery key: %w", err)
+	}
+
+	mnemonic, err := bip39.NewMnemonic(secret)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode recovery key: %w", err)
+	}
+
+	return secret, mnemonic, nil
+}
+
+// parseRecoveryKey decodes a recovery key printed by generateRecoveryKey. Keys
+// generated before the word list, printed as dash separated hex groups, are accepted too.
+func parseRecoveryKey(recoveryKey string) ([]byte, error) {
+	// 24 words never fit in the 64 characters of a hex key, so the formats cannot collide
+	cleaned := strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(recoveryKey))
+	if secret, err := hex.DecodeString(cleaned); err == nil && len(secret) == recoveryKeySize {
+		return secret, nil
+	}
+
+	words := strings.Fields(strings.ToLower(recoveryKey))
+	secret, err := bip39.EntropyFromMnemonic(strings.Join(words, " "))
+	if err != nil || len(secret) != recoveryKeySize {
+		return nil, fmt.Errorf("invalid recovery key, check the spelling and order of the words")
+	}
+
+	return secret, nil
+}
+
+// passwordSecret returns the secret a password slot is derived from: the password
+// followed by the hash of the keyfile when one is required as a second factor
+func passwordSecret(password, keyfilePath string) ([]byte, error) {
+	if keyfilePath == "" {
+		return []byte(password), nil
+	}
+
+	if _, err := os.Stat(keyfilePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("the required keyfile %s is missing, connect the drive holding it", keyfilePath)
+	}
+
+	keyfileHash, err := readKeyfile(keyfilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(keyfileHash)
+
+	secret := make([]byte, 0, len(password)+len(keyfileHash))
+	secret = append(secret, password...)
+	return append(secret, keyfileHash...), nil
+}
+
+// readKeyfile returns the secret derived from the contents of a keyfile
+func readKeyfile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("keyfile is empty")
+	}
+
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+// ensureKeyfile creates a random keyfile at path unless one already exists
+func ensureKeyfile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	data := make([]byte, keyfileSize)
+	if _, err := rand.Read(data); err != nil {
+		return fmt.Errorf("failed to generate keyfile: %w", err)
+	}
+
+	// O_EXCL so an existing keyfile is never overwritten
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create keyfile: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to write keyfile: %w", err)
+	}
+
+	return file.Sync()
+}
@@ -1,41 +1,81 @@
 package crypto
 
 import (
-	"encoding/hex"
+	"bytes"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"svimpass/internal/paths"
+	"svimpass/internal/strength"
 )
 
-const (
-	verificationToken = "PASSWORD_MANAGER_VERIFICATION_TOKEN_2024"
-	configFileName    = ".password-manager-config"
-)
+const verificationToken = "PASSWORD_MANAGER_VERIFICATION_TOKEN_2024"
+
+var errNoMatchingSlot = errors.New("no key slot matches")
 
-// MasterPasswordConfig holds the configuration for master password verification
+// MasterPasswordConfig holds the key slots protecting the vault key
 type MasterPasswordConfig struct {
-	Salt           []byte `json:"salt"`
-	EncryptedToken []byte `json:"encrypted_token"`
-	IsInitialized  bool   `json:"is_initialized"`
+	Version       int           `json:"version"`
+	IsInitialized bool          `json:"is_initialized"`
+	Generation    uint64        `json:"generation"`             // bumped every time the vault is re-encrypted
+	Cipher        string        `json:"cipher"`                 // cipher of new ciphertexts, AES-GCM when empty
+	KeyfilePath   string        `json:"keyfile_path,omitempty"` // keyfile password slots require, if any
+	Lockout       LockoutPolicy `json:"lockout"`                // action after too many failed unlocks
+	IdleTimeout   time.Duration `json:"idle_timeout"`           // unlocked vault locks after this much inactivity, 0 never
+	MinStrength   int           `json:"min_strength"`           // strength score new master passwords need
+	Slots         []KeySlot     `json:"slots"`
+
+	// Version 1 configs derived the vault key directly from the master password
+	// and are migrated to key slots on the next unlock
+	Salt           []byte    `json:"salt,omitempty"`
+	EncryptedToken []byte    `json:"encrypted_token,omitempty"`
+	KDF            KDFParams `json:"kdf"`
 }
 
-// MasterPasswordManager handles master password setup and verification
+// Vault is the encrypted store whose contents have to follow the vault key
+type Vault interface {
+	// ReencryptEntries rewrites every stored ciphertext and records the new key
+	// generation in a single transaction, no legacy blob is left afterwards
+	ReencryptEntries(generation uint64, reencrypt func(entryID int, field string, ciphertext []byte) ([]byte, error)) error
+	// KeyGeneration returns the key generation the vault is currently encrypted with
+	KeyGeneration() (uint64, error)
+	// Backup writes a consistent snapshot of the vault to destPath
+	Backup(destPath string) error
+	// Wipe deletes every entry, used when the lockout policy destroys the vault
+	Wipe() error
+	// LegacyCiphertexts reports whether entries may still hold legacy blobs, and that
+	// only the entries after upgradedThrough can
+	LegacyCiphertexts() (pending bool, upgradedThrough int, err error)
+}
+
+// MasterPasswordManager handles the vault key and the key slots unlocking it
 type MasterPasswordManager struct {
 	configPath string
-	config     *MasterPasswordConfig
+	copyPath   string // checksummed copy of the config next to the database, restored if the config is damaged
+	backupDir  string
+	config     *MasterPasswordConfig // active config, never modified in place, see updateConfig
+	configMu   sync.Mutex            // guards the config pointer
+	updateMu   sync.Mutex            // held by config updates from reading the config to activating the next one
+	vault      Vault
+	throttleMu sync.Mutex   // serializes unlock attempts so the failure count cannot be raced
+	quick      *quickUnlock // in-memory PIN slot, guarded by throttleMu
 }
 
-// NewMasterPasswordManager creates a new master password manager (legacy)
+// NewMasterPasswordManager creates a master password manager on the legacy config in
+// the home directory. The app imports that config into the XDG layout at startup.
 func NewMasterPasswordManager() (*MasterPasswordManager, error) {
-	homeDir, err := os.UserHomeDir()
+	configPath, err := paths.LegacyConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get home directory: %w", err)
 	}
 
-	configPath := filepath.Join(homeDir, configFileName)
-
 	manager := &MasterPasswordManager{
 		configPath: configPath,
 	}
@@ -54,6 +94,8 @@ func NewMasterPasswordManagerWithPaths(appPaths *paths.Paths) (*MasterPasswordMa
 
 	manager := &MasterPasswordManager{
 		configPath: configPath,
+		copyPath:   appPaths.ConfigCopy(),
+		backupDir:  appPaths.BackupDir(),
 	}
 
 	// Load existing config or create new one
@@ -64,194 +106,1217 @@ func NewMasterPasswordManagerWithPaths(appPaths *paths.Paths) (*MasterPasswordMa
 	return manager, nil
 }
 
+// AttachVault registers the store that is re-encrypted whenever the vault key changes
+// and finishes any re-encryption that was interrupted before the config was updated
+func (mpm *MasterPasswordManager) AttachVault(vault Vault) error {
+	mpm.vault = vault
+	return mpm.recoverPendingConfig()
+}
+
+// currentConfig returns the active config, which callers must not modify
+func (mpm *MasterPasswordManager) currentConfig() *MasterPasswordConfig {
+	mpm.configMu.Lock()
+	defer mpm.configMu.Unlock()
+	return mpm.config
+}
+
+// setConfig makes config the active one, the caller holds updateMu
+func (mpm *MasterPasswordManager) setConfig(config *MasterPasswordConfig) {
+	mpm.configMu.Lock()
+	defer mpm.configMu.Unlock()
+	mpm.config = config
+}
+
+// updateConfig passes a copy of the active config to change and saves the result.
+// updateMu is held from the copy to the save, so concurrent updates cannot undo
+// each other, while readers keep using the active config in the meantime.
+func (mpm *MasterPasswordManager) updateConfig(change func(next *MasterPasswordConfig) error) error {
+	mpm.updateMu.Lock()
+	defer mpm.updateMu.Unlock()
+
+	next := *mpm.currentConfig()
+	next.Slots = slices.Clone(next.Slots)
+	if err := change(&next); err != nil {
+		return err
+	}
+
+	return mpm.replaceConfig(&next)
+}
+
 // IsInitialized returns true if the master password has been set up
 func (mpm *MasterPasswordManager) IsInitialized() bool {
-	return mpm.config.IsInitialized
+	return mpm.currentConfig().IsInitialized
 }
 
-// SetupMasterPassword sets up the master password for the first time
-func (mpm *MasterPasswordManager) SetupMasterPassword(masterPassword string) (*EncryptionKey, error) {
-	if mpm.config.IsInitialized {
+// SetupMasterPassword generates the vault key and protects it with a master password slot.
+// With a keyfile path the keyfile becomes a second factor every password slot requires,
+// a random keyfile is created at that path if none exists yet.
+func (mpm *MasterPasswordManager) SetupMasterPassword(masterPassword, keyfilePath string) (*EncryptionKey, error) {
+	mpm.updateMu.Lock()
+	defer mpm.updateMu.Unlock()
+
+	current := mpm.currentConfig()
+	if current.IsInitialized {
 		return nil, fmt.Errorf("master password already initialized")
 	}
 
-	// Generate a random salt
-	salt := generateSalt()
+	if keyfilePath != "" {
+		if !filepath.IsAbs(keyfilePath) {
+			return nil, fmt.Errorf("keyfile path must be absolute")
+		}
+		if err := ensureKeyfile(keyfilePath); err != nil {
+			return nil, err
+		}
+	}
 
-	// Derive encryption key
-	encKey := DeriveKey(masterPassword, salt)
+	secret, err := passwordSecret(masterPassword, keyfilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(secret)
 
-	// Encrypt the verification token
-	encryptedToken, err := encKey.Encrypt(verificationToken)
+	vaultKey, err := newVaultKey()
 	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt verification token: %w", err)
+		return nil, err
 	}
 
-	// Update config
-	mpm.config.Salt = salt
-	mpm.config.EncryptedToken = encryptedToken
-	mpm.config.IsInitialized = true
+	slot, err := newKeySlot(1, SlotPassword, secret, DefaultKDFParams(), vaultKey)
+	if err != nil {
+		vaultKey.Destroy()
+		return nil, err
+	}
 
-	// Save config
-	if err := mpm.saveConfig(); err != nil {
-		return nil, fmt.Errorf("failed to save config: %w", err)
+	config := &MasterPasswordConfig{
+		Version:       configVersion,
+		IsInitialized: true,
+		Generation:    current.Generation,
+		Cipher:        CipherAESGCM,
+		KeyfilePath:   keyfilePath,
+		IdleTimeout:   DefaultIdleTimeout,
+		MinStrength:   current.MinStrength,
+		Slots:         []KeySlot{slot},
 	}
 
-	return encKey, nil
+	if err := mpm.replaceConfig(config); err != nil {
+		vaultKey.Destroy()
+		return nil, err
+	}
+
+	return vaultKey, mpm.applyCipher(vaultKey)
 }
 
-// VerifyMasterPassword verifies the master password and returns the encryption key if correct
+// VerifyMasterPassword verifies the master password and returns the vault key if correct.
+// Legacy configs are migrated to key slots and slots using weaker KDF parameters than the
+// defaults are re-wrapped on the way. Failed attempts are throttled.
 func (mpm *MasterPasswordManager) VerifyMasterPassword(masterPassword string) (*EncryptionKey, error) {
-	if !mpm.config.IsInitialized {
+	var vaultKey *EncryptionKey
+	err := mpm.throttled(false, func() (err error) {
+		vaultKey, err = mpm.verifyMasterPassword(masterPassword)
+		return err
+	})
+	return vaultKey, err
+}
+
+// verifyMasterPassword does the work of VerifyMasterPassword without throttling
+func (mpm *MasterPasswordManager) verifyMasterPassword(masterPassword string) (*EncryptionKey, error) {
+	config := mpm.currentConfig()
+	if !config.IsInitialized {
 		return nil, fmt.Errorf("master password not initialized")
 	}
 
-	// Derive key using stored salt
-	encKey := DeriveKey(masterPassword, mpm.config.Salt)
+	if config.Version < slotConfigVersion {
+		legacyKey, err := verifyLegacy(config, masterPassword)
+		if err != nil {
+			return nil, wrongSecretError{err}
+		}
+
+		vaultKey, err := mpm.migrateToKeySlots(masterPassword, legacyKey)
+		if err != nil {
+			// The legacy key still decrypts the vault, the migration is retried on the next unlock
+			fmt.Printf("Warning: failed to migrate vault to key slots: %v\n", err)
+			return legacyKey, nil
+		}
+		legacyKey.Destroy()
+		return vaultKey, nil
+	}
+
+	secret, err := mpm.passwordSecret(masterPassword)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(secret)
+
+	slot, vaultKey, err := mpm.unlockSlot(SlotPassword, secret)
+	if err != nil {
+		return nil, wrongSecretError{mpm.invalidPasswordError("invalid master password")}
+	}
+
+	if slot.KDF.WeakerThan(DefaultKDFParams()) {
+		err := mpm.rewrapSlot(slot, secret, upgradedKDFParams(slot.KDF), vaultKey)
+		if err != nil {
+			// The old slot still works, the upgrade is retried on the next unlock
+			fmt.Printf("Warning: failed to upgrade key derivation parameters: %v\n", err)
+		}
+	}
+
+	return vaultKey, nil
+}
+
+// UnlockWithRecoveryKey returns the vault key and the recovery key slot it was unwrapped from.
+// Failed attempts are throttled, but a recovery key is still accepted after a lockout.
+func (mpm *MasterPasswordManager) UnlockWithRecoveryKey(recoveryKey string) (KeySlot, *EncryptionKey, error) {
+	var slot KeySlot
+	var vaultKey *EncryptionKey
+	err := mpm.throttled(true, func() (err error) {
+		slot, vaultKey, err = mpm.unlockWithRecoveryKey(recoveryKey)
+		return err
+	})
+	return slot, vaultKey, err
+}
+
+func (mpm *MasterPasswordManager) unlockWithRecoveryKey(recoveryKey string) (KeySlot, *EncryptionKey, error) {
+	secret, err := parseRecoveryKey(recoveryKey)
+	if err != nil {
+		return KeySlot{}, nil, err
+	}
+	defer Wipe(secret)
+
+	slot, vaultKey, err := mpm.unlockSlot(SlotRecovery, secret)
+	if err != nil {
+		return KeySlot{}, nil, wrongSecretError{fmt.Errorf("invalid recovery key")}
+	}
+
+	return slot, vaultKey, nil
+}
+
+// UnlockWithShares rebuilds the secret split by SplitKey from enough shares and returns
+// the vault key and the shares slot it was unwrapped from. Like recovery keys, shares
+// are throttled but still accepted after a lockout.
+func (mpm *MasterPasswordManager) UnlockWithShares(texts []string) (KeySlot, *EncryptionKey, error) {
+	var slot KeySlot
+	var vaultKey *EncryptionKey
+	err := mpm.throttled(true, func() (err error) {
+		slot, vaultKey, err = mpm.unlockWithShares(texts)
+		return err
+	})
+	return slot, vaultKey, err
+}
+
+func (mpm *MasterPasswordManager) unlockWithShares(texts []string) (KeySlot, *EncryptionKey, error) {
+	shares := make([]Share, 0, len(texts))
+	for i, text := range texts {
+		share, err := ParseShare(text)
+		if err != nil {
+			return KeySlot{}, nil, fmt.Errorf("share %d: %w", i+1, err)
+		}
+		shares = append(shares, share)
+	}
+
+	secret, err := combineShares(shares)
+	if err != nil {
+		return KeySlot{}, nil, err
+	}
+	defer Wipe(secret)
+
+	slot, vaultKey, err := mpm.unlockSlot(SlotShares, secret)
+	if err != nil {
+		return KeySlot{}, nil, wrongSecretError{fmt.Errorf("the shares do not unlock this vault, they may have been revoked")}
+	}
+
+	return slot, vaultKey, nil
+}
+
+// RecoverMasterPassword sets a new master password after an unlock with the recovery
+// key or the shares of recoverySlotID. Every password slot is replaced by one for the
+// new password, and the recovery slot is revoked since its secret has been used. The
+// backed up configs still holding the replaced slots are deleted.
+func (mpm *MasterPasswordManager) RecoverMasterPassword(vaultKey *EncryptionKey, recoverySlotID int, newPassword string) error {
+	if err := mpm.requireKeySlots(); err != nil {
+		return err
+	}
+	if newPassword == "" {
+		return fmt.Errorf("new password cannot be empty")
+	}
+
+	secret, err := mpm.passwordSecret(newPassword)
+	if err != nil {
+		return err
+	}
+	defer Wipe(secret)
+
+	if err := mpm.backup("recovery"); err != nil {
+		return fmt.Errorf("failed to back up vault: %w", err)
+	}
+
+	return mpm.revokeSlots(func(next *MasterPasswordConfig) error {
+		slot, err := newKeySlot(nextSlotID(next.Slots), SlotPassword, secret, DefaultKDFParams(), vaultKey)
+		if err != nil {
+			return err
+		}
+
+		next.Slots = slices.DeleteFunc(next.Slots, func(existing KeySlot) bool {
+			return existing.Type == SlotPassword || existing.ID == recoverySlotID
+		})
+		next.Slots = append(next.Slots, slot)
+		return nil
+	})
+}
+
+// UnlockWithKeyfile returns the vault key using a keyfile slot, failed attempts are throttled
+func (mpm *MasterPasswordManager) UnlockWithKeyfile(path string) (*EncryptionKey, error) {
+	var vaultKey *EncryptionKey
+	err := mpm.throttled(false, func() (err error) {
+		vaultKey, err = mpm.unlockWithKeyfile(path)
+		return err
+	})
+	return vaultKey, err
+}
+
+func (mpm *MasterPasswordManager) unlockWithKeyfile(path string) (*EncryptionKey, error) {
+	secret, err := readKeyfile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(secret)
+
+	_, vaultKey, err := mpm.unlockSlot(SlotKeyfile, secret)
+	if err != nil {
+		return nil, wrongSecretError{fmt.Errorf("invalid keyfile")}
+	}
+
+	return vaultKey, nil
+}
+
+// throttledPasswordSlot unlocks the master password slot with secret, counting a
+// wrong password towards the throttle like a failed unlock
+func (mpm *MasterPasswordManager) throttledPasswordSlot(secret []byte, message string) (KeySlot, *EncryptionKey, error) {
+	var slot KeySlot
+	var vaultKey *EncryptionKey
+	err := mpm.throttled(false, func() (err error) {
+		slot, vaultKey, err = mpm.unlockSlot(SlotPassword, secret)
+		if err != nil {
+			return wrongSecretError{mpm.invalidPasswordError(message)}
+		}
+		return nil
+	})
+	return slot, vaultKey, err
+}
+
+// unlockSlot tries every slot of the given type with secret
+func (mpm *MasterPasswordManager) unlockSlot(slotType string, secret []byte) (KeySlot, *EncryptionKey, error) {
+	if err := mpm.requireKeySlots(); err != nil {
+		return KeySlot{}, nil, err
+	}
+
+	for _, slot := range mpm.currentConfig().Slots {
+		if slot.Type != slotType {
+			continue
+		}
+		if vaultKey, err := slot.unwrap(secret); err == nil {
+			if err := mpm.applyCipher(vaultKey); err != nil {
+				vaultKey.Destroy()
+				return KeySlot{}, nil, err
+			}
+			return slot, vaultKey, nil
+		}
+	}
+
+	return KeySlot{}, nil, errNoMatchingSlot
+}
+
+// verifyLegacy derives the key of a version 1 config and checks the verification token
+func verifyLegacy(config *MasterPasswordConfig, masterPassword string) (*EncryptionKey, error) {
+	// Derive key using stored salt and parameters
+	encKey, err := DeriveKey(masterPassword, config.Salt, config.KDF)
+	if err != nil {
+		return nil, err
+	}
 
 	// Try to decrypt the verification token
-	decryptedToken, err := encKey.Decrypt(mpm.config.EncryptedToken)
+	decryptedToken, err := encKey.Decrypt(config.EncryptedToken)
 	if err != nil {
+		encKey.Destroy()
 		return nil, fmt.Errorf("invalid master password")
 	}
 
 	// Verify the token matches
 	if decryptedToken != verificationToken {
+		encKey.Destroy()
 		return nil, fmt.Errorf("invalid master password")
 	}
 
-	// Clear the decrypted token from memory
-
 	return encKey, nil
 }
 
-// ChangeMasterPassword changes the master password
-func (mpm *MasterPasswordManager) ChangeMasterPassword(oldPassword, newPassword string) (*EncryptionKey, error) {
+// requireKeySlots fails for configs that have not been migrated to key slots yet
+func (mpm *MasterPasswordManager) requireKeySlots() error {
+	if mpm.currentConfig().Version < slotConfigVersion {
+		return fmt.Errorf("the vault has not been migrated to key slots yet, unlock it with the master password first")
+	}
+	return nil
+}
+
+// RequiredKeyfile returns where the keyfile password slots require is expected,
+// or "" if the master password alone unlocks the vault
+func (mpm *MasterPasswordManager) RequiredKeyfile() string {
+	return mpm.currentConfig().KeyfilePath
+}
+
+// passwordSecret returns the secret of a password slot, mixing in the required keyfile
+func (mpm *MasterPasswordManager) passwordSecret(password string) ([]byte, error) {
+	return passwordSecret(password, mpm.currentConfig().KeyfilePath)
+}
+
+// invalidPasswordError names the keyfile as a possible cause when one is required
+func (mpm *MasterPasswordManager) invalidPasswordError(message string) error {
+	if keyfilePath := mpm.currentConfig().KeyfilePath; keyfilePath != "" {
+		return fmt.Errorf("%s or wrong keyfile %s", message, keyfilePath)
+	}
+	return errors.New(message)
+}
+
+// KDFParams returns the key derivation parameters of the master password slot
+func (mpm *MasterPasswordManager) KDFParams() KDFParams {
+	config := mpm.currentConfig()
+	if config.Version < slotConfigVersion {
+		return config.KDF
+	}
+	for _, slot := range config.Slots {
+		if slot.Type == SlotPassword {
+			return slot.KDF
+		}
+	}
+	return KDFParams{}
+}
+
+// UpdateKDFParams re-wraps the master password slot with stronger parameters
+func (mpm *MasterPasswordManager) UpdateKDFParams(masterPassword string, params KDFParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+
+	secret, err := mpm.passwordSecret(masterPassword)
+	if err != nil {
+		return err
+	}
+	defer Wipe(secret)
+
+	slot, vaultKey, err := mpm.throttledPasswordSlot(secret, "invalid master password")
+	if err != nil {
+		return err
+	}
+	defer vaultKey.Destroy()
+
+	if params.WeakerThan(slot.KDF) {
+		return fmt.Errorf("key derivation parameters can only be raised, current: %s", slot.KDF)
+	}
+
+	return mpm.rewrapSlot(slot, secret, params, vaultKey)
+}
+
+// ChangeMasterPassword replaces the vault key with a new one, protected by a slot for
+// the new master password, and re-encrypts the entries. The other slots and the PIN
+// wrap the old key, so they no longer unlock the vault and the removed slots are
+// returned. verified runs once the old password is checked, before the vault changes.
+func (mpm *MasterPasswordManager) ChangeMasterPassword(oldPassword, newPassword string, verified func()) ([]KeySlot, error) {
+	if err := mpm.requireKeySlots(); err != nil {
+		return nil, err
+	}
+	if newPassword == "" {
+		return nil, fmt.Errorf("new password cannot be empty")
+	}
+	if mpm.vault == nil {
+		return nil, fmt.Errorf("no vault attached to re-encrypt")
+	}
+
+	oldSecret, err := mpm.passwordSecret(oldPassword)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(oldSecret)
+
+	newSecret, err := mpm.passwordSecret(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(newSecret)
+
 	// First verify the old password
-	_, err := mpm.VerifyMasterPassword(oldPassword)
+	generation := mpm.currentConfig().Generation
+	slot, oldKey, err := mpm.throttledPasswordSlot(oldSecret, "invalid old password")
+	if err != nil {
+		return nil, err
+	}
+	defer oldKey.Destroy()
+
+	verified()
+	mpm.DisableQuickUnlock()
+
+	mpm.updateMu.Lock()
+	defer mpm.updateMu.Unlock()
+
+	current := mpm.currentConfig()
+	if current.Generation != generation {
+		return nil, fmt.Errorf("the vault key changed meanwhile, try again")
+	}
+
+	if err := mpm.backup("passwd"); err != nil {
+		return nil, fmt.Errorf("failed to back up vault: %w", err)
+	}
+
+	// The old key must read the legacy blobs an upgrade has not rewritten yet
+	pending, upgradedThrough, err := mpm.vault.LegacyCiphertexts()
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		oldKey.AllowLegacy(upgradedThrough)
+	} else {
+		oldKey.RefuseLegacy()
+	}
+
+	vaultKey, err := newVaultKey()
+	if err != nil {
+		return nil, err
+	}
+	defer vaultKey.Destroy()
+	if err := mpm.applyCipher(vaultKey); err != nil {
+		return nil, err
+	}
+
+	passwordSlot, err := newKeySlot(slot.ID, SlotPassword, newSecret, upgradedKDFParams(slot.KDF), vaultKey)
+	if err != nil {
+		return nil, err
+	}
+
+	next := *current
+	next.Generation++
+	next.Slots = []KeySlot{passwordSlot}
+	if err := mpm.reencryptVault(&next, oldKey, vaultKey); err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(slices.Clone(current.Slots), func(existing KeySlot) bool {
+		return existing.ID == slot.ID
+	}), nil
+}
+
+// Cipher returns the cipher new ciphertexts are encrypted with
+func (mpm *MasterPasswordManager) Cipher() string {
+	if cipher := mpm.currentConfig().Cipher; cipher != "" {
+		return cipher
+	}
+	return CipherAESGCM
+}
+
+// SetCipher saves the cipher new ciphertexts are encrypted with and applies it to
+// vaultKey. Existing ciphertexts keep their cipher until they are upgraded.
+func (mpm *MasterPasswordManager) SetCipher(vaultKey *EncryptionKey, name string) error {
+	if err := mpm.requireKeySlots(); err != nil {
+		return err
+	}
+	if _, err := cipherAlgorithm(name); err != nil {
+		return err
+	}
+
+	err := mpm.updateConfig(func(next *MasterPasswordConfig) error {
+		next.Cipher = name
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("invalid old password: %w", err)
+		return err
 	}
 
-	// Generate new salt
-	newSalt := generateSalt()
+	return mpm.applyCipher(vaultKey)
+}
+
+// applyCipher makes vaultKey encrypt with the configured cipher
+func (mpm *MasterPasswordManager) applyCipher(vaultKey *EncryptionKey) error {
+	return vaultKey.SetCipher(mpm.Cipher())
+}
 
-	// Derive new encryption key
-	newEncKey := DeriveKey(newPassword, newSalt)
+// KeySlots returns the configured key slots
+func (mpm *MasterPasswordManager) KeySlots() []KeySlot {
+	return slices.Clone(mpm.currentConfig().Slots)
+}
 
-	// Encrypt verification token with new key
-	encryptedToken, err := newEncKey.Encrypt(verificationToken)
+// AddPasswordSlot adds another password able to unlock the vault
+func (mpm *MasterPasswordManager) AddPasswordSlot(vaultKey *EncryptionKey, password string) (KeySlot, error) {
+	if password == "" {
+		return KeySlot{}, fmt.Errorf("password cannot be empty")
+	}
+	secret, err := mpm.passwordSecret(password)
 	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt verification token: %w", err)
+		return KeySlot{}, err
 	}
+	defer Wipe(secret)
 
-	// Update config
-	mpm.config.Salt = newSalt
-	mpm.config.EncryptedToken = encryptedToken
+	return mpm.addSlot(SlotPassword, secret, vaultKey)
+}
 
-	// Save config
-	if err := mpm.saveConfig(); err != nil {
-		return nil, fmt.Errorf("failed to save config: %w", err)
+// AddRecoverySlot generates a recovery key, adds a slot for it and returns its printable form
+func (mpm *MasterPasswordManager) AddRecoverySlot(vaultKey *EncryptionKey) (string, error) {
+	secret, recoveryKey, err := generateRecoveryKey()
+	if err != nil {
+		return "", err
 	}
 
-	return newEncKey, nil
+	defer Wipe(secret)
+
+	if _, err := mpm.addSlot(SlotRecovery, secret, vaultKey); err != nil {
+		return "", err
+	}
+
+	return recoveryKey, nil
 }
 
-// loadConfig loads the configuration from disk
-func (mpm *MasterPasswordManager) loadConfig() error {
-	// Check if config file exists
-	if _, err := os.Stat(mpm.configPath); os.IsNotExist(err) {
-		// Create new config
-		mpm.config = &MasterPasswordConfig{
-			IsInitialized: false,
+// RegenerateRecoveryKey replaces every recovery slot with one for a new recovery
+// key, revoking the old keys in the config and its backups, and returns the
+// printable form of the new key
+func (mpm *MasterPasswordManager) RegenerateRecoveryKey(vaultKey *EncryptionKey) (string, error) {
+	if err := mpm.requireKeySlots(); err != nil {
+		return "", err
+	}
+
+	secret, recoveryKey, err := generateRecoveryKey()
+	if err != nil {
+		return "", err
+	}
+	defer Wipe(secret)
+
+	err = mpm.revokeSlots(func(next *MasterPasswordConfig) error {
+		slot, err := newKeySlot(nextSlotID(next.Slots), SlotRecovery, secret, DefaultKDFParams(), vaultKey)
+		if err != nil {
+			return err
+		}
+
+		next.Slots = slices.DeleteFunc(next.Slots, func(existing KeySlot) bool {
+			return existing.Type == SlotRecovery
+		})
+		next.Slots = append(next.Slots, slot)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return recoveryKey, nil
+}
+
+// SplitKey splits a new random unlock secret into count shares, any threshold of
+// which unlock the vault. The shares slot replaces the one of any earlier split,
+// revoking its shares in the config and its backups, and the printable shares are
+// returned.
+func (mpm *MasterPasswordManager) SplitKey(vaultKey *EncryptionKey, threshold, count int) ([]string, error) {
+	if err := mpm.requireKeySlots(); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, shareSecret)
+	defer Wipe(secret)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate the secret to split: %w", err)
+	}
+
+	shares, err := splitSecret(secret, threshold, count)
+	if err != nil {
+		return nil, err
+	}
+
+	var slot KeySlot
+	err = mpm.revokeSlots(func(next *MasterPasswordConfig) (err error) {
+		slot, err = newKeySlot(nextSlotID(next.Slots), SlotShares, secret, DefaultKDFParams(), vaultKey)
+		if err != nil {
+			return err
 		}
+
+		next.Slots = slices.DeleteFunc(next.Slots, func(existing KeySlot) bool {
+			return existing.Type == SlotShares
+		})
+		next.Slots = append(next.Slots, slot)
 		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make([]string, len(shares))
+	for i, share := range shares {
+		share.SlotID = slot.ID
+		texts[i] = share.String()
+		Wipe(share.Y)
+	}
+
+	return texts, nil
+}
+
+// AddKeyfileSlot adds a slot unlocked by the keyfile at path, creating a random keyfile if needed
+func (mpm *MasterPasswordManager) AddKeyfileSlot(vaultKey *EncryptionKey, path string) (KeySlot, error) {
+	if err := ensureKeyfile(path); err != nil {
+		return KeySlot{}, err
+	}
+
+	secret, err := readKeyfile(path)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	defer Wipe(secret)
+
+	return mpm.addSlot(SlotKeyfile, secret, vaultKey)
+}
+
+// addSlot wraps vaultKey with secret in a new slot and saves the config
+func (mpm *MasterPasswordManager) addSlot(slotType string, secret []byte, vaultKey *EncryptionKey) (KeySlot, error) {
+	if err := mpm.requireKeySlots(); err != nil {
+		return KeySlot{}, err
+	}
+
+	var slot KeySlot
+	err := mpm.updateConfig(func(next *MasterPasswordConfig) (err error) {
+		slot, err = newKeySlot(nextSlotID(next.Slots), slotType, secret, DefaultKDFParams(), vaultKey)
+		if err != nil {
+			return err
+		}
+
+		next.Slots = append(next.Slots, slot)
+		return nil
+	})
+	if err != nil {
+		return KeySlot{}, err
+	}
+
+	return slot, nil
+}
+
+// nextSlotID returns one more than the highest slot ID in use
+func nextSlotID(slots []KeySlot) int {
+	nextID := 1
+	for _, slot := range slots {
+		nextID = max(nextID, slot.ID+1)
+	}
+	return nextID
+}
+
+// RemoveKeySlot removes a slot, the last remaining slot can never be removed. The
+// slot is revoked, backed up configs still holding it are deleted.
+func (mpm *MasterPasswordManager) RemoveKeySlot(id int) error {
+	if err := mpm.requireKeySlots(); err != nil {
+		return err
+	}
+
+	return mpm.revokeSlots(func(next *MasterPasswordConfig) error {
+		index := slices.IndexFunc(next.Slots, func(slot KeySlot) bool { return slot.ID == id })
+		if index < 0 {
+			return fmt.Errorf("key slot %d not found", id)
+		}
+		if len(next.Slots) == 1 {
+			return fmt.Errorf("cannot remove the last key slot")
+		}
+
+		next.Slots = slices.Delete(next.Slots, index, index+1)
+		return nil
+	})
+}
+
+// revokeSlots saves the config like updateConfig, for changes removing slots that
+// must no longer unlock the vault. Backups keep a copy of the config, so the backed
+// up configs still holding the removed slots are purged afterwards.
+func (mpm *MasterPasswordManager) revokeSlots(change func(next *MasterPasswordConfig) error) error {
+	if err := mpm.updateConfig(change); err != nil {
+		return err
+	}
+
+	if err := mpm.purgeBackupConfigs(); err != nil {
+		return fmt.Errorf("the slot was removed, but a backup still holds it: %w", err)
+	}
+	return nil
+}
+
+// rewrapSlot replaces slot with one wrapping vaultKey under a new secret or new parameters
+func (mpm *MasterPasswordManager) rewrapSlot(slot KeySlot, secret []byte, params KDFParams, vaultKey *EncryptionKey) error {
+	rewrapped, err := newKeySlot(slot.ID, slot.Type, secret, params, vaultKey)
+	if err != nil {
+		return err
+	}
+
+	return mpm.updateConfig(func(next *MasterPasswordConfig) error {
+		for i := range next.Slots {
+			if next.Slots[i].ID == slot.ID {
+				next.Slots[i] = rewrapped
+			}
+		}
+		return nil
+	})
+}
+
+// replaceConfig atomically writes config and makes it the active one, the caller
+// holds updateMu
+func (mpm *MasterPasswordManager) replaceConfig(config *MasterPasswordConfig) error {
+	if err := writeConfig(mpm.configPath, config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	config.Version = configVersion
+	mpm.setConfig(config)
+	mpm.syncConfigCopy()
+	return nil
+}
+
+// syncConfigCopy mirrors the config file into the copy kept next to the database
+func (mpm *MasterPasswordManager) syncConfigCopy() {
+	if mpm.copyPath == "" {
+		return
 	}
 
-	// Read config file
 	data, err := os.ReadFile(mpm.configPath)
+	if err == nil {
+		err = writeFileAtomic(mpm.copyPath, data, 0o600)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
+		// A stale copy could bring back key slots that no longer open the vault
+		os.Remove(mpm.copyPath)
+		fmt.Printf("Warning: failed to update config copy: %v\n", err)
 	}
+}
 
-	// Parse the simple format: salt_hex:encrypted_token_hex:initialized
-	parts := splitConfig(string(data))
-	if len(parts) != 3 {
-		return fmt.Errorf("invalid config file format")
+// migrateToKeySlots moves a version 1 vault to a random vault key protected by a
+// master password slot. The entries are re-encrypted from the legacy key once.
+func (mpm *MasterPasswordManager) migrateToKeySlots(masterPassword string, legacyKey *EncryptionKey) (*EncryptionKey, error) {
+	if mpm.vault == nil {
+		return nil, fmt.Errorf("no vault attached to re-encrypt")
 	}
 
-	salt, err := hex.DecodeString(parts[0])
+	mpm.updateMu.Lock()
+	defer mpm.updateMu.Unlock()
+
+	current := mpm.currentConfig()
+	if current.Version >= slotConfigVersion {
+		return nil, fmt.Errorf("the vault has been migrated to key slots meanwhile")
+	}
+
+	if err := mpm.backup("keyslots"); err != nil {
+		return nil, fmt.Errorf("failed to back up vault: %w", err)
+	}
+
+	vaultKey, err := newVaultKey()
 	if err != nil {
-		return fmt.Errorf("failed to decode salt: %w", err)
+		return nil, err
 	}
 
-	encryptedToken, err := hex.DecodeString(parts[1])
+	secret := []byte(masterPassword)
+	defer Wipe(secret)
+
+	slot, err := newKeySlot(1, SlotPassword, secret, upgradedKDFParams(current.KDF), vaultKey)
 	if err != nil {
-		return fmt.Errorf("failed to decode encrypted token: %w", err)
+		vaultKey.Destroy()
+		return nil, err
+	}
+
+	next := &MasterPasswordConfig{
+		Version:       configVersion,
+		IsInitialized: true,
+		Generation:    current.Generation + 1,
+		Cipher:        CipherAESGCM,
+		IdleTimeout:   DefaultIdleTimeout,
+		MinStrength:   current.MinStrength,
+		Slots:         []KeySlot{slot},
+	}
+
+	// Every entry of a version 1 vault is a legacy blob
+	legacyKey.AllowLegacy(0)
+	if err := mpm.reencryptVault(next, legacyKey, vaultKey); err != nil {
+		vaultKey.Destroy()
+		return nil, err
+	}
+
+	return vaultKey, nil
+}
+
+// reencryptVault re-encrypts the vault from oldKey to newKey and activates next.
+// next is staged as a pending file tagged with the next key generation before the
+// vault transaction runs, and promoted only after the transaction committed. If the
+// process dies in between, AttachVault keeps whichever config matches the vault.
+// The caller holds updateMu.
+func (mpm *MasterPasswordManager) reencryptVault(next *MasterPasswordConfig, oldKey, newKey *EncryptionKey) error {
+	pendingPath := mpm.pendingConfigPath()
+	if err := writeConfig(pendingPath, next); err != nil {
+		return fmt.Errorf("failed to stage config: %w", err)
 	}
 
-	isInitialized := parts[2] == "true"
+	err := mpm.vault.ReencryptEntries(next.Generation, func(entryID int, field string, ciphertext []byte) ([]byte, error) {
+		plaintext, err := oldKey.DecryptField(ciphertext, entryID, field)
+		if err != nil {
+			return nil, err
+		}
+		return newKey.EncryptField(plaintext, entryID, field)
+	})
+	if err != nil {
+		os.Remove(pendingPath)
+		return fmt.Errorf("failed to re-encrypt vault: %w", err)
+	}
 
-	mpm.config = &MasterPasswordConfig{
-		Salt:           salt,
-		EncryptedToken: encryptedToken,
-		IsInitialized:  isInitialized,
+	// The vault is committed under the new key from here on
+	mpm.setConfig(next)
+	if err := renameDurable(pendingPath, mpm.configPath); err != nil {
+		fmt.Printf("Warning: failed to promote staged config, it will be recovered on next start: %v\n", err)
+		return nil
 	}
+	mpm.syncConfigCopy()
 
 	return nil
 }
 
-// saveConfig saves the configuration to disk
-func (mpm *MasterPasswordManager) saveConfig() error {
-	// Create simple format: salt_hex:encrypted_token_hex:initialized
-	saltHex := hex.EncodeToString(mpm.config.Salt)
-	tokenHex := hex.EncodeToString(mpm.config.EncryptedToken)
-	initialized := "false"
-	if mpm.config.IsInitialized {
-		initialized = "true"
+// backup snapshots the database and the config into a timestamped backup directory
+func (mpm *MasterPasswordManager) backup(reason string) error {
+	if mpm.backupDir == "" || mpm.vault == nil {
+		return nil
 	}
 
-	data := fmt.Sprintf("%s:%s:%s", saltHex, tokenHex, initialized)
+	dir := filepath.Join(mpm.backupDir, fmt.Sprintf("%s-%s", reason, time.Now().Format("20060102-150405")))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
 
-	// Write to file with restricted permissions (only owner can read/write)
-	err := os.WriteFile(mpm.configPath, []byte(data), 0o600)
+	if err := mpm.vault.Backup(filepath.Join(dir, "passwords.db")); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(mpm.configPath)
 	if err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	return os.WriteFile(filepath.Join(dir, filepath.Base(mpm.configPath)), data, 0o600)
+}
+
+// purgeBackupConfigs deletes the configs in the backups that wrap the live vault key.
+// Their slots may have been revoked since, and the live config opens the database
+// backups of the same generation. Configs of older generations are kept, they only
+// unwrap the retired key their own database backup is encrypted with.
+func (mpm *MasterPasswordManager) purgeBackupConfigs() error {
+	if mpm.backupDir == "" {
+		return nil
+	}
+
+	mpm.updateMu.Lock()
+	defer mpm.updateMu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(mpm.backupDir, "*", "*"))
+	if err != nil {
+		return err
+	}
+
+	generation := mpm.currentConfig().Generation
+	for _, path := range paths {
+		if strings.HasPrefix(filepath.Base(path), "passwords.db") {
+			continue
+		}
+
+		// Anything that is not a config holding slots cannot unwrap the key
+		config, err := readConfig(path)
+		if err != nil || len(config.Slots) == 0 || config.Generation != generation {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove backed up config: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// throttlePath returns where the failed unlock attempts are counted
+func (mpm *MasterPasswordManager) throttlePath() string {
+	return mpm.configPath + ".throttle"
+}
+
+// throttled runs one unlock attempt once the delay earned by earlier failures has
+// passed. A wrong secret is counted and may trigger the lockout policy, a success
+// clears the count. Recovery secrets are accepted after a lockout, others are not.
+func (mpm *MasterPasswordManager) throttled(recovery bool, attempt func() error) error {
+	mpm.throttleMu.Lock()
+	defer mpm.throttleMu.Unlock()
+
+	state := readThrottle(mpm.throttlePath())
+	if state.LockedOut && !recovery {
+		return ErrLockedOut
+	}
+	if wait := state.retryAfter(time.Now()); wait > 0 {
+		return &ThrottleError{RetryAfter: wait}
+	}
+
+	err := attempt()
+	if err == nil {
+		if err := writeThrottle(mpm.throttlePath(), throttleState{}); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		return nil
+	}
+
+	var wrong wrongSecretError
+	if !errors.As(err, &wrong) {
+		return err
+	}
+
+	state.Failures++
+	state.LastFailure = time.Now()
+
+	policy := mpm.currentConfig().Lockout
+	if policy.MaxFailures > 0 && state.Failures >= policy.MaxFailures {
+		switch policy.Action {
+		case LockoutWipe:
+			if wipeErr := mpm.wipeVault(); wipeErr != nil {
+				return fmt.Errorf("lockout policy failed to wipe the vault: %w", wipeErr)
+			}
+			return ErrVaultWiped
+		case LockoutLock:
+			state.LockedOut = true
+		}
+	}
+
+	// Refuse to go on unthrottled if the count cannot be persisted
+	if writeErr := writeThrottle(mpm.throttlePath(), state); writeErr != nil {
+		return writeErr
+	}
+	if state.LockedOut && !recovery {
+		return ErrLockedOut
+	}
+
+	return err
+}
+
+// IdleTimeout returns how long the unlocked vault may stay idle before it locks, 0 means never
+func (mpm *MasterPasswordManager) IdleTimeout() time.Duration {
+	return mpm.currentConfig().IdleTimeout
+}
+
+// SetIdleTimeout changes how long the unlocked vault may stay idle, 0 disables the auto-lock
+func (mpm *MasterPasswordManager) SetIdleTimeout(timeout time.Duration) error {
+	if err := mpm.requireKeySlots(); err != nil {
+		return err
+	}
+	if timeout < 0 {
+		return fmt.Errorf("idle timeout cannot be negative")
+	}
+
+	return mpm.updateConfig(func(next *MasterPasswordConfig) error {
+		next.IdleTimeout = timeout.Truncate(time.Second)
+		return nil
+	})
+}
+
+// MinStrength returns the strength score a new master password needs
+func (mpm *MasterPasswordManager) MinStrength() int {
+	return mpm.currentConfig().MinStrength
+}
+
+// SetMinStrength changes the strength score new master passwords need, 0 accepts any password
+func (mpm *MasterPasswordManager) SetMinStrength(score int) error {
+	if err := mpm.requireKeySlots(); err != nil {
+		return err
+	}
+	if score < 0 || score > strength.MaxScore {
+		return fmt.Errorf("the strength score must be between 0 and %d", strength.MaxScore)
+	}
+
+	return mpm.updateConfig(func(next *MasterPasswordConfig) error {
+		next.MinStrength = score
+		return nil
+	})
+}
+
+// LockoutPolicy returns the action taken after too many failed unlock attempts
+func (mpm *MasterPasswordManager) LockoutPolicy() LockoutPolicy {
+	return mpm.currentConfig().Lockout
+}
+
+// SetLockoutPolicy changes the action taken after too many failed unlock attempts
+func (mpm *MasterPasswordManager) SetLockoutPolicy(policy LockoutPolicy) error {
+	if err := mpm.requireKeySlots(); err != nil {
+		return err
+	}
+
+	switch {
+	case policy.MaxFailures == 0:
+		policy.Action = ""
+	case policy.MaxFailures < freeAttempts:
+		return fmt.Errorf("the lockout policy needs at least %d attempts", freeAttempts)
+	case policy.Action != LockoutLock && policy.Action != LockoutWipe:
+		return fmt.Errorf("unknown lockout action %q, use %s or %s", policy.Action, LockoutLock, LockoutWipe)
+	}
+
+	return mpm.updateConfig(func(next *MasterPasswordConfig) error {
+		next.Lockout = policy
+		return nil
+	})
+}
+
+// wipeVault destroys the vault for the wipe policy: the entries, the backups and
+// finally the key slots, without which no copy of the ciphertexts can be decrypted.
+// The caller holds throttleMu.
+func (mpm *MasterPasswordManager) wipeVault() error {
+	if mpm.vault != nil {
+		if err := mpm.vault.Wipe(); err != nil {
+			return err
+		}
+	}
+	if mpm.backupDir != "" {
+		if err := os.RemoveAll(mpm.backupDir); err != nil {
+			return fmt.Errorf("failed to remove backups: %w", err)
+		}
+	}
+	if err := mpm.resetMasterPasswordLocked(); err != nil {
+		return err
+	}
+
+	return writeThrottle(mpm.throttlePath(), throttleState{})
+}
+
+// pendingConfigPath returns where a config is staged while the vault is re-encrypted
+func (mpm *MasterPasswordManager) pendingConfigPath() string {
+	return mpm.configPath + ".pending"
+}
+
+// recoverPendingConfig resolves a re-encryption that was interrupted: the staged
+// config is promoted if the vault committed its generation, and discarded otherwise
+func (mpm *MasterPasswordManager) recoverPendingConfig() error {
+	mpm.updateMu.Lock()
+	defer mpm.updateMu.Unlock()
+
+	pendingPath := mpm.pendingConfigPath()
+	if _, err := os.Stat(pendingPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	pending, err := readConfig(pendingPath)
+	if err != nil {
+		// Pending configs are written atomically, an unreadable one never got used
+		return os.Remove(pendingPath)
+	}
+
+	generation, err := mpm.vault.KeyGeneration()
+	if err != nil {
+		return fmt.Errorf("failed to read vault key generation: %w", err)
+	}
+
+	if pending.Generation != generation {
+		return os.Remove(pendingPath)
+	}
+
+	if err := renameDurable(pendingPath, mpm.configPath); err != nil {
+		return fmt.Errorf("failed to promote staged config: %w", err)
+	}
+	mpm.setConfig(pending)
+	mpm.syncConfigCopy()
+
 	return nil
 }
 
-// splitConfig splits the config string by colons
-func splitConfig(config string) []string {
-	parts := make([]string, 0, 3)
-	current := ""
+// loadConfig loads the configuration from disk. A missing or damaged config is
+// restored from the copy next to the database, and configs in the colon
+// separated format are rewritten as JSON.
+func (mpm *MasterPasswordManager) loadConfig() error {
+	mpm.updateMu.Lock()
+	defer mpm.updateMu.Unlock()
+
+	config, err := readConfig(mpm.configPath)
+	if err != nil {
+		restored, copyErr := mpm.readConfigCopy()
+		switch {
+		case restored != nil:
+			fmt.Printf("Warning: config file is missing or damaged, restoring it from %s\n", mpm.copyPath)
+			if err := mpm.restoreConfigCopy(); err != nil {
+				return err
+			}
+			config = restored
+		case copyErr != nil:
+			return fmt.Errorf("%w, config copy is unusable too: %v", err, copyErr)
+		case errors.Is(err, os.ErrNotExist):
+			// Create new config
+			mpm.setConfig(&MasterPasswordConfig{
+				Version:       configVersion,
+				IsInitialized: false,
+				MinStrength:   strength.DefaultMinScore,
+			})
+			return nil
+		default:
+			return err
+		}
+	}
 
-	for _, char := range config {
-		if char == ':' {
-			parts = append(parts, current)
-			current = ""
-		} else {
-			current += string(char)
+	mpm.setConfig(config)
+
+	if config.Version == slotConfigVersion {
+		if err := mpm.replaceConfig(config); err != nil {
+			// The colon separated config is still readable, the rewrite is retried on the next start
+			fmt.Printf("Warning: failed to migrate config to JSON: %v\n", err)
 		}
+		return nil
 	}
 
-	if current != "" {
-		parts = append(parts, current)
+	// Keep the copy in step with configs written by older releases or restored by hand
+	if mpm.copyPath != "" {
+		primary, _ := os.ReadFile(mpm.configPath)
+		if current, err := os.ReadFile(mpm.copyPath); err != nil || !bytes.Equal(current, primary) {
+			mpm.syncConfigCopy()
+		}
 	}
 
-	return parts
+	return nil
+}
+
+// readConfigCopy reads the config copy next to the database, it returns a nil
+// config and no error when there is no copy
+func (mpm *MasterPasswordManager) readConfigCopy() (*MasterPasswordConfig, error) {
+	if mpm.copyPath == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(mpm.copyPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return readConfig(mpm.copyPath)
+}
+
+// restoreConfigCopy replaces the config file with the copy next to the database
+func (mpm *MasterPasswordManager) restoreConfigCopy() error {
+	data, err := os.ReadFile(mpm.copyPath)
+	if err == nil {
+		err = writeFileAtomic(mpm.configPath, data, 0o600)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore config file: %w", err)
+	}
+	return nil
 }
 
 // ResetMasterPassword removes the master password configuration (emergency use only)
 func (mpm *MasterPasswordManager) ResetMasterPassword() error {
-	if err := os.Remove(mpm.configPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove config file: %w", err)
+	mpm.throttleMu.Lock()
+	defer mpm.throttleMu.Unlock()
+
+	return mpm.resetMasterPasswordLocked()
+}
+
+// resetMasterPasswordLocked does the work of ResetMasterPassword, the caller holds throttleMu
+func (mpm *MasterPasswordManager) resetMasterPasswordLocked() error {
+	mpm.updateMu.Lock()
+	defer mpm.updateMu.Unlock()
+
+	mpm.discardQuickUnlockLocked()
+	for _, path := range []string{mpm.configPath, mpm.pendingConfigPath(), mpm.copyPath} {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove config file: %w", err)
+		}
 	}
 
-	mpm.config = &MasterPasswordConfig{
+	mpm.setConfig(&MasterPasswordConfig{
+		Version:       configVersion,
 		IsInitialized: false,
-	}
+		MinStrength:   strength.DefaultMinScore,
+	})
 
 	return nil
 }
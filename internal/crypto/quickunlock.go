@@ -0,0 +1,119 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A quick unlock PIN re-wraps the vault key in memory after a full unlock, so the
+// vault can be unlocked again with the PIN until the window expires. The wrapped
+// key never touches the disk and is lost when the app exits.
+const (
+	minPINLength   = 4
+	maxPINFailures = 3
+	maxPINWindow   = 7 * 24 * time.Hour
+	slotPIN        = "pin" // type of the in-memory slot, never written to the config
+)
+
+// DefaultPINWindow is how long a PIN unlocks the vault when no window is given
+const DefaultPINWindow = 8 * time.Hour
+
+// ErrNoQuickUnlock is returned when no PIN is set, it expired or was discarded
+var ErrNoQuickUnlock = errors.New("no PIN is set, enter the master password")
+
+// quickUnlock is the vault key wrapped with a PIN derived key
+type quickUnlock struct {
+	slot     KeySlot
+	expires  time.Time
+	failures int
+}
+
+// EnableQuickUnlock wraps vaultKey with a key derived from pin, replacing any
+// earlier PIN. The PIN unlocks the vault until window has passed.
+func (mpm *MasterPasswordManager) EnableQuickUnlock(vaultKey *EncryptionKey, pin string, window time.Duration) error {
+	if len(pin) < minPINLength {
+		return fmt.Errorf("the PIN needs at least %d characters", minPINLength)
+	}
+	if window <= 0 || window > maxPINWindow {
+		return fmt.Errorf("the PIN window must be between 1s and %s", maxPINWindow)
+	}
+
+	secret := []byte(pin)
+	defer Wipe(secret)
+
+	slot, err := newKeySlot(0, slotPIN, secret, DefaultKDFParams(), vaultKey)
+	if err != nil {
+		return err
+	}
+
+	mpm.throttleMu.Lock()
+	defer mpm.throttleMu.Unlock()
+
+	mpm.discardQuickUnlockLocked()
+	mpm.quick = &quickUnlock{slot: slot, expires: time.Now().Add(window)}
+	return nil
+}
+
+// UnlockWithPIN returns the vault key wrapped by EnableQuickUnlock. The PIN is
+// discarded after maxPINFailures wrong attempts, once it expired, and while a
+// lockout keeps the master password from unlocking.
+func (mpm *MasterPasswordManager) UnlockWithPIN(pin string) (*EncryptionKey, error) {
+	mpm.throttleMu.Lock()
+	defer mpm.throttleMu.Unlock()
+
+	if mpm.quick == nil {
+		return nil, ErrNoQuickUnlock
+	}
+	if time.Now().After(mpm.quick.expires) || readThrottle(mpm.throttlePath()).LockedOut {
+		mpm.discardQuickUnlockLocked()
+		return nil, ErrNoQuickUnlock
+	}
+
+	secret := []byte(pin)
+	defer Wipe(secret)
+
+	vaultKey, err := mpm.quick.slot.unwrap(secret)
+	if err != nil {
+		mpm.quick.failures++
+		if mpm.quick.failures >= maxPINFailures {
+			mpm.discardQuickUnlockLocked()
+			return nil, fmt.Errorf("wrong PIN, the PIN has been discarded, enter the master password")
+		}
+		return nil, fmt.Errorf("wrong PIN, %d attempts left", maxPINFailures-mpm.quick.failures)
+	}
+
+	if err := mpm.applyCipher(vaultKey); err != nil {
+		vaultKey.Destroy()
+		return nil, err
+	}
+
+	mpm.quick.failures = 0
+	return vaultKey, nil
+}
+
+// QuickUnlockExpiry returns when the PIN expires, the zero time when no PIN is set
+func (mpm *MasterPasswordManager) QuickUnlockExpiry() time.Time {
+	mpm.throttleMu.Lock()
+	defer mpm.throttleMu.Unlock()
+
+	if mpm.quick == nil || time.Now().After(mpm.quick.expires) {
+		return time.Time{}
+	}
+	return mpm.quick.expires
+}
+
+// DisableQuickUnlock discards the PIN, only the full unlock paths remain
+func (mpm *MasterPasswordManager) DisableQuickUnlock() {
+	mpm.throttleMu.Lock()
+	defer mpm.throttleMu.Unlock()
+
+	mpm.discardQuickUnlockLocked()
+}
+
+func (mpm *MasterPasswordManager) discardQuickUnlockLocked() {
+	if mpm.quick != nil {
+		Wipe(mpm.quick.slot.WrappedKey)
+		mpm.quick = nil
+	}
+}
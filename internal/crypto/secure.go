@@ -0,0 +1,126 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ErrBufferDestroyed is returned when a buffer is read after Destroy
+var ErrBufferDestroyed = errors.New("secure buffer has been destroyed")
+
+// SecureBuffer holds key material or a decrypted secret in memory that is
+// allocated outside the Go heap where the platform allows it. The pages are
+// locked so they are never swapped, surrounded by inaccessible guard pages so
+// overflows fault instead of leaking into neighbouring memory, and wiped when
+// the buffer is destroyed. Go strings cannot be wiped, so secrets should stay
+// in a SecureBuffer until the last moment they are needed.
+type SecureBuffer struct {
+	mu     sync.Mutex
+	data   []byte
+	region []byte // whole allocation including guard pages, nil on the heap fallback
+	locked bool
+}
+
+// NewSecureBuffer allocates a zeroed buffer of size bytes
+func NewSecureBuffer(size int) (*SecureBuffer, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("secure buffer size must be positive")
+	}
+
+	sb, err := allocSecure(size)
+	if err != nil {
+		return nil, err
+	}
+
+	// Safety net for buffers that are dropped without Destroy
+	runtime.SetFinalizer(sb, (*SecureBuffer).Destroy)
+	return sb, nil
+}
+
+// SecureBufferFrom moves src into a new buffer and wipes src
+func SecureBufferFrom(src []byte) (*SecureBuffer, error) {
+	defer Wipe(src)
+
+	sb, err := NewSecureBuffer(len(src))
+	if err != nil {
+		return nil, err
+	}
+	copy(sb.data, src)
+	return sb, nil
+}
+
+// With runs fn with the contents of the buffer. The memory stays mapped until fn
+// returns, Destroy waits for it, so fn must not keep the slice or call back into
+// the buffer. A nil buffer holds nothing, fn gets nil; a destroyed buffer returns
+// ErrBufferDestroyed without calling fn.
+func (sb *SecureBuffer) With(fn func(b []byte) error) error {
+	if sb == nil {
+		return fn(nil)
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.data == nil {
+		return ErrBufferDestroyed
+	}
+	return fn(sb.data)
+}
+
+// Reveal copies the contents of the buffer into a string, which cannot be wiped,
+// for handing a secret over at the last moment
+func (sb *SecureBuffer) Reveal() (string, error) {
+	var text string
+	err := sb.With(func(b []byte) error {
+		text = string(b)
+		return nil
+	})
+	return text, err
+}
+
+// Len returns the size of the buffer, 0 once it has been destroyed
+func (sb *SecureBuffer) Len() int {
+	if sb == nil {
+		return 0
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return len(sb.data)
+}
+
+// Locked reports whether the buffer is locked in memory and cannot be swapped
+func (sb *SecureBuffer) Locked() bool {
+	if sb == nil {
+		return false
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.locked
+}
+
+// Destroy wipes and releases the buffer. It is safe to call more than once.
+func (sb *SecureBuffer) Destroy() {
+	if sb == nil {
+		return
+	}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.data == nil {
+		return
+	}
+	Wipe(sb.data)
+	freeSecure(sb)
+	sb.data = nil
+	sb.region = nil
+	sb.locked = false
+	runtime.SetFinalizer(sb, nil)
+}
+
+// Wipe overwrites b with zeros
+func Wipe(b []byte) {
+	clear(b)
+	// Keep the compiler from treating the writes as dead stores
+	runtime.KeepAlive(b)
+}
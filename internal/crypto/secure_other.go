@@ -0,0 +1,12 @@
+//go:build !unix
+
+package crypto
+
+// allocSecure falls back to the Go heap where page protection is not available,
+// the buffer is still wiped when it is destroyed
+func allocSecure(size int) (*SecureBuffer, error) {
+	return &SecureBuffer{data: make([]byte, size)}, nil
+}
+
+// freeSecure has nothing to release on the heap fallback
+func freeSecure(sb *SecureBuffer) {}
@@ -0,0 +1,54 @@
+//go:build unix
+
+package crypto
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocSecure maps guard page || data pages || guard page and locks the data
+// pages. The buffer ends right at the trailing guard page, so writes past its
+// end fault immediately.
+func allocSecure(size int) (*SecureBuffer, error) {
+	pageSize := os.Getpagesize()
+	dataPages := (size + pageSize - 1) / pageSize * pageSize
+
+	region, err := unix.Mmap(-1, 0, dataPages+2*pageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate secure memory: %w", err)
+	}
+
+	guardFront := region[:pageSize]
+	guardBack := region[pageSize+dataPages:]
+	if err := unix.Mprotect(guardFront, unix.PROT_NONE); err != nil {
+		unix.Munmap(region)
+		return nil, fmt.Errorf("failed to protect guard page: %w", err)
+	}
+	if err := unix.Mprotect(guardBack, unix.PROT_NONE); err != nil {
+		unix.Munmap(region)
+		return nil, fmt.Errorf("failed to protect guard page: %w", err)
+	}
+
+	inner := region[pageSize : pageSize+dataPages]
+	// mlock fails when RLIMIT_MEMLOCK is exhausted, the buffer is still usable then
+	locked := unix.Mlock(inner) == nil
+
+	return &SecureBuffer{
+		data:   inner[dataPages-size:],
+		region: region,
+		locked: locked,
+	}, nil
+}
+
+// freeSecure unlocks and unmaps the allocation of a wiped buffer
+func freeSecure(sb *SecureBuffer) {
+	pageSize := os.Getpagesize()
+	inner := sb.region[pageSize : len(sb.region)-pageSize]
+	if sb.locked {
+		unix.Munlock(inner)
+	}
+	unix.Munmap(sb.region)
+}
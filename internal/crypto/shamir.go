@@ -0,0 +1,200 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Shamir secret sharing over GF(2^8): every byte of the secret is the constant
+// term of a random polynomial of degree threshold-1, and share x holds the
+// values of those polynomials at x. Any threshold shares rebuild the secret
+// through Lagrange interpolation at 0, fewer reveal nothing about it.
+
+const (
+	sharePrefix   = "svimpass-share"
+	shareVersion  = 1
+	shareSecret   = 32
+	maxShares     = 255
+	checksumBytes = 4
+)
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(2^8) with the
+// AES polynomial x^8+x^4+x^3+x+1 and generator 3
+var gfExp, gfLog = gfTables()
+
+func gfTables() ([510]byte, [256]byte) {
+	var exp [510]byte
+	var log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+		// Multiply by the generator 3: x*2 xor x, reducing by the polynomial
+		doubled := x << 1
+		if x&0x80 != 0 {
+			doubled ^= 0x1b
+		}
+		x ^= doubled
+	}
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// Share is one of the parts a vault unlock secret was split into
+type Share struct {
+	SlotID    int // key slot the shares unlock, shares of different splits cannot be mixed
+	Threshold int
+	X         byte
+	Y         []byte
+}
+
+// splitSecret splits secret into n shares, any threshold of which rebuild it
+func splitSecret(secret []byte, threshold, n int) ([]Share, error) {
+	if threshold < 2 || threshold > n || n > maxShares {
+		return nil, fmt.Errorf("invalid split %d of %d, need 2 <= threshold <= shares <= %d", threshold, n, maxShares)
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{Threshold: threshold, X: byte(i + 1), Y: make([]byte, len(secret))}
+	}
+
+	coefficients := make([]byte, threshold)
+	defer Wipe(coefficients)
+	for b, value := range secret {
+		coefficients[0] = value
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate share polynomial: %w", err)
+		}
+
+		for i := range shares {
+			// Horner evaluation of the polynomial at x
+			var y byte
+			for c := threshold - 1; c >= 0; c-- {
+				y = gfMul(y, shares[i].X) ^ coefficients[c]
+			}
+			shares[i].Y[b] = y
+		}
+	}
+
+	return shares, nil
+}
+
+// combineShares rebuilds the secret from at least threshold shares of one split
+func combineShares(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no shares given")
+	}
+
+	first := shares[0]
+	if first.Threshold < 2 || first.Threshold > maxShares {
+		return nil, fmt.Errorf("invalid share threshold %d", first.Threshold)
+	}
+
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if share.SlotID != first.SlotID || share.Threshold != first.Threshold || len(share.Y) != len(first.Y) {
+			return nil, fmt.Errorf("the shares belong to different splits")
+		}
+		if share.X == 0 {
+			return nil, fmt.Errorf("invalid share index 0")
+		}
+		if seen[share.X] {
+			return nil, fmt.Errorf("share %d was given twice", share.X)
+		}
+		seen[share.X] = true
+	}
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("%d of %d required shares given", len(shares), first.Threshold)
+	}
+
+	shares = shares[:first.Threshold]
+	secret := make([]byte, len(first.Y))
+	for i, share := range shares {
+		// Lagrange basis polynomial of share i evaluated at 0
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gfMul(basis, gfDiv(other.X, other.X^share.X))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(share.Y[b], basis)
+		}
+	}
+
+	return secret, nil
+}
+
+// String encodes the share as text protected by a checksum:
+//
+//	svimpass-share:version:slot:threshold:x:y_hex:checksum_hex
+func (s Share) String() string {
+	body := fmt.Sprintf("%s:%d:%d:%d:%d:%s", sharePrefix, shareVersion, s.SlotID, s.Threshold, s.X, hex.EncodeToString(s.Y))
+	return body + ":" + shareChecksum(body)
+}
+
+// ParseShare decodes a share printed by Share.String, rejecting mistyped shares
+func ParseShare(text string) (Share, error) {
+	text = strings.TrimSpace(text)
+	separator := strings.LastIndex(text, ":")
+	if separator < 0 || !strings.HasPrefix(text, sharePrefix+":") {
+		return Share{}, fmt.Errorf("not a svimpass share")
+	}
+
+	body, checksum := text[:separator], text[separator+1:]
+	if !strings.EqualFold(checksum, shareChecksum(body)) {
+		return Share{}, fmt.Errorf("share checksum mismatch, check the share for typos")
+	}
+
+	parts := strings.Split(body, ":")
+	if len(parts) != 6 {
+		return Share{}, fmt.Errorf("invalid share format")
+	}
+	if parts[1] != strconv.Itoa(shareVersion) {
+		return Share{}, fmt.Errorf("unsupported share version %s", parts[1])
+	}
+
+	slotID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return Share{}, fmt.Errorf("invalid share slot: %w", err)
+	}
+	threshold, err := strconv.Atoi(parts[3])
+	if err != nil || threshold < 2 || threshold > maxShares {
+		return Share{}, fmt.Errorf("invalid share threshold %s", parts[3])
+	}
+	x, err := strconv.ParseUint(parts[4], 10, 8)
+	if err != nil || x == 0 {
+		return Share{}, fmt.Errorf("invalid share index %s", parts[4])
+	}
+	y, err := hex.DecodeString(parts[5])
+	if err != nil || len(y) != shareSecret {
+		return Share{}, fmt.Errorf("invalid share value")
+	}
+
+	return Share{SlotID: slotID, Threshold: threshold, X: byte(x), Y: y}, nil
+}
+
+// shareChecksum returns the truncated SHA-256 of the share body
+func shareChecksum(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:checksumBytes])
+}
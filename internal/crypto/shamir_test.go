@@ -0,0 +1,189 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestGFDivInvertsMul(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			product := gfMul(byte(a), byte(b))
+			if got := gfDiv(product, byte(b)); got != byte(a) {
+				t.Fatalf("gfDiv(gfMul(%d, %d), %d) = %d", a, b, b, got)
+			}
+		}
+	}
+}
+
+func TestSplitCombineRoundTrip(t *testing.T) {
+	tests := []struct {
+		threshold, shares int
+	}{
+		{2, 2},
+		{2, 3},
+		{3, 5},
+		{5, 5},
+		{4, 10},
+		{255, 255},
+	}
+
+	for _, tt := range tests {
+		secret := make([]byte, shareSecret)
+		if _, err := rand.Read(secret); err != nil {
+			t.Fatal(err)
+		}
+
+		shares, err := splitSecret(secret, tt.threshold, tt.shares)
+		if err != nil {
+			t.Fatalf("split %d of %d: %v", tt.threshold, tt.shares, err)
+		}
+
+		subsets := map[string][]Share{
+			"first":    shares[:tt.threshold],
+			"last":     shares[tt.shares-tt.threshold:],
+			"all":      shares,
+			"reversed": reversed(shares[:tt.threshold]),
+		}
+		for name, subset := range subsets {
+			// Shares go through their text form, as users paste them
+			parsed := make([]Share, len(subset))
+			for i, share := range subset {
+				if parsed[i], err = ParseShare(share.String()); err != nil {
+					t.Fatalf("split %d of %d: parse share %d: %v", tt.threshold, tt.shares, share.X, err)
+				}
+			}
+
+			got, err := combineShares(parsed)
+			if err != nil {
+				t.Fatalf("split %d of %d, %s shares: %v", tt.threshold, tt.shares, name, err)
+			}
+			if !bytes.Equal(got, secret) {
+				t.Fatalf("split %d of %d, %s shares: secret not rebuilt", tt.threshold, tt.shares, name)
+			}
+		}
+
+		if tt.threshold > 2 {
+			got, err := combineShares(shares[:tt.threshold-1])
+			if err == nil && bytes.Equal(got, secret) {
+				t.Fatalf("split %d of %d: rebuilt from too few shares", tt.threshold, tt.shares)
+			}
+		}
+	}
+}
+
+func TestSplitRejectsInvalidThresholds(t *testing.T) {
+	tests := []struct {
+		threshold, shares int
+	}{
+		{1, 3},
+		{0, 3},
+		{-1, 3},
+		{4, 3},
+		{2, 256},
+	}
+
+	for _, tt := range tests {
+		if _, err := splitSecret(make([]byte, shareSecret), tt.threshold, tt.shares); err == nil {
+			t.Errorf("split %d of %d accepted", tt.threshold, tt.shares)
+		}
+	}
+}
+
+func TestParseShareRejectsMalformed(t *testing.T) {
+	value := strings.Repeat("ab", shareSecret)
+	text := withChecksum("svimpass-share:1:7:2:1:" + value)
+	valid, err := ParseShare(text)
+	if err != nil {
+		t.Fatalf("valid share rejected: %v", err)
+	}
+	if valid.SlotID != 7 || valid.Threshold != 2 || valid.X != 1 {
+		t.Fatalf("valid share parsed as %+v", valid)
+	}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"other prefix", withChecksum("other-share:1:7:2:1:" + value)},
+		{"typo", strings.Replace(text, ":abab", ":abac", 1)},
+		{"bad checksum", "svimpass-share:1:7:2:1:" + value + ":00000000"},
+		{"negative threshold", withChecksum("svimpass-share:1:7:-1:1:" + value)},
+		{"threshold 0", withChecksum("svimpass-share:1:7:0:1:" + value)},
+		{"threshold 1", withChecksum("svimpass-share:1:7:1:1:" + value)},
+		{"threshold 256", withChecksum("svimpass-share:1:7:256:1:" + value)},
+		{"threshold not a number", withChecksum("svimpass-share:1:7:two:1:" + value)},
+		{"index 0", withChecksum("svimpass-share:1:7:2:0:" + value)},
+		{"index 256", withChecksum("svimpass-share:1:7:2:256:" + value)},
+		{"negative index", withChecksum("svimpass-share:1:7:2:-1:" + value)},
+		{"bad slot", withChecksum("svimpass-share:1:x:2:1:" + value)},
+		{"unknown version", withChecksum("svimpass-share:2:7:2:1:" + value)},
+		{"short value", withChecksum("svimpass-share:1:7:2:1:abab")},
+		{"value not hex", withChecksum("svimpass-share:1:7:2:1:" + strings.Repeat("zz", shareSecret))},
+		{"missing field", withChecksum("svimpass-share:1:7:2:" + value)},
+		{"extra field", withChecksum("svimpass-share:1:7:2:1:1:" + value)},
+	}
+
+	for _, tt := range tests {
+		if share, err := ParseShare(tt.text); err == nil {
+			t.Errorf("%s: accepted as %+v", tt.name, share)
+		}
+	}
+}
+
+func TestCombineRejectsInvalidShares(t *testing.T) {
+	shares, err := splitSecret(make([]byte, shareSecret), 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := splitSecret(make([]byte, shareSecret), 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other[1].SlotID = 9
+
+	negative := []Share{shares[0], shares[1]}
+	negative[0].Threshold, negative[1].Threshold = -1, -1
+	one := []Share{shares[0]}
+	one[0].Threshold = 1
+	zero := []Share{shares[0], shares[1]}
+	zero[1].X = 0
+	short := []Share{shares[0], shares[1]}
+	short[1].Y = short[1].Y[:4]
+
+	tests := []struct {
+		name   string
+		shares []Share
+	}{
+		{"none", nil},
+		{"too few", shares[:1]},
+		{"duplicate", []Share{shares[0], shares[0]}},
+		{"different splits", []Share{shares[0], other[1]}},
+		{"negative threshold", negative},
+		{"threshold 1", one},
+		{"index 0", zero},
+		{"different lengths", short},
+	}
+
+	for _, tt := range tests {
+		if _, err := combineShares(tt.shares); err == nil {
+			t.Errorf("%s: shares combined", tt.name)
+		}
+	}
+}
+
+// withChecksum appends a valid checksum to body, so the fields behind it are checked
+func withChecksum(body string) string {
+	return body + ":" + shareChecksum(body)
+}
+
+func reversed(shares []Share) []Share {
+	out := make([]Share, len(shares))
+	for i, share := range shares {
+		out[len(shares)-1-i] = share
+	}
+	return out
+}
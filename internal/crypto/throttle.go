@@ -0,0 +1,166 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failed unlock attempts are counted in a file next to the config, so that
+// restarting the app does not reset them. Each failure past freeAttempts doubles
+// the delay before the next attempt is accepted, up to maxThrottleDelay.
+const (
+	throttleMagic    = "svimpass-throttle"
+	freeAttempts     = 3
+	maxThrottleDelay = time.Hour
+)
+
+// Lockout policy actions taken after LockoutPolicy.MaxFailures consecutive failures
+const (
+	LockoutLock = "lock" // only a recovery key or key shares unlock the vault
+	LockoutWipe = "wipe" // the vault, its backups and its key slots are destroyed
+)
+
+// LockoutPolicy is the optional action taken after too many consecutive failed
+// unlock attempts, disabled when MaxFailures is 0
+type LockoutPolicy struct {
+	MaxFailures int
+	Action      string
+}
+
+// String returns a human readable summary of the policy
+func (lp LockoutPolicy) String() string {
+	if lp.MaxFailures == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%s after %d failed attempts", lp.Action, lp.MaxFailures)
+}
+
+// ErrLockedOut is returned for master password and keyfile unlocks once the lock policy triggered
+var ErrLockedOut = errors.New("too many failed attempts, the vault is locked, unlock it with a recovery key or key shares")
+
+// ErrVaultWiped is returned by the attempt that triggered the wipe policy
+var ErrVaultWiped = errors.New("too many failed attempts, the vault has been wiped")
+
+// ThrottleError is returned while failed attempts delay the next unlock attempt
+type ThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	seconds := int((e.RetryAfter + time.Second - 1) / time.Second)
+	return fmt.Sprintf("too many failed attempts, try again in %d seconds", seconds)
+}
+
+// wrongSecretError marks a wrong password, key or share. Only these failures are
+// counted, a missing keyfile or a typo caught by a checksum is not a guess.
+type wrongSecretError struct {
+	error
+}
+
+func (e wrongSecretError) Unwrap() error {
+	return e.error
+}
+
+// throttleState is the persisted count of consecutive failed unlock attempts
+type throttleState struct {
+	Failures    int
+	LastFailure time.Time
+	LockedOut   bool
+}
+
+// delay returns how long after the last failure the next attempt is accepted
+func (ts throttleState) delay() time.Duration {
+	if ts.Failures < freeAttempts {
+		return 0
+	}
+	shift := ts.Failures - freeAttempts
+	if shift >= 12 {
+		return maxThrottleDelay
+	}
+	return min(time.Second<<shift, maxThrottleDelay)
+}
+
+// retryAfter returns how long the caller has to wait before the next attempt
+func (ts throttleState) retryAfter(now time.Time) time.Duration {
+	// A clock set back does not shorten the delay
+	last := ts.LastFailure
+	if last.After(now) {
+		last = now
+	}
+	return last.Add(ts.delay()).Sub(now)
+}
+
+// readThrottle reads the throttle state at path. A missing file means no failures,
+// a corrupted one is treated as the longest delay rather than as a reset.
+func readThrottle(path string) throttleState {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return throttleState{}
+	}
+
+	state, parseErr := parseThrottle(strings.TrimSpace(string(data)))
+	if err != nil || parseErr != nil {
+		fmt.Printf("Warning: throttle state %s is unreadable, applying the longest delay\n", path)
+		return throttleState{Failures: freeAttempts + 12, LastFailure: time.Now()}
+	}
+
+	return state
+}
+
+// parseThrottle parses svimpass-throttle:failures:last_failure_unix:locked:checksum
+func parseThrottle(text string) (throttleState, error) {
+	separator := strings.LastIndex(text, ":")
+	if separator < 0 || text[separator+1:] != throttleChecksum(text[:separator]) {
+		return throttleState{}, fmt.Errorf("throttle checksum mismatch")
+	}
+
+	parts := strings.Split(text[:separator], ":")
+	if len(parts) != 4 || parts[0] != throttleMagic {
+		return throttleState{}, fmt.Errorf("invalid throttle format")
+	}
+
+	failures, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return throttleState{}, fmt.Errorf("invalid failure count: %w", err)
+	}
+	lastFailure, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return throttleState{}, fmt.Errorf("invalid failure time: %w", err)
+	}
+
+	return throttleState{
+		Failures:    failures,
+		LastFailure: time.Unix(lastFailure, 0),
+		LockedOut:   parts[3] == "true",
+	}, nil
+}
+
+// writeThrottle atomically replaces the throttle state, removing the file once it is clear
+func writeThrottle(path string, state throttleState) error {
+	if state.Failures == 0 && !state.LockedOut {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to clear throttle state: %w", err)
+		}
+		return nil
+	}
+
+	body := fmt.Sprintf("%s:%d:%d:%t", throttleMagic, state.Failures, state.LastFailure.Unix(), state.LockedOut)
+	if err := writeFileAtomic(path, []byte(body+":"+throttleChecksum(body)+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to write throttle state: %w", err)
+	}
+
+	return nil
+}
+
+// throttleChecksum returns the truncated SHA-256 of the throttle state, catching
+// torn or hand edited files
+func throttleChecksum(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:checksumBytes])
+}
@@ -2,16 +2,26 @@
 package csv
 
 import (
-	"encoding/csv"
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"svimpass/internal/crypto"
-	"svimpass/internal/database"
 )
 
-func ExportPasswordToCSV(db *database.DB, encKey *crypto.EncryptionKey) error {
+// ExportEntry is a decrypted entry to export, the password stays in secure memory
+type ExportEntry struct {
+	ServiceName string
+	Username    string
+	Password    *crypto.SecureBuffer
+	Notes       string
+}
+
+// ExportPasswordToCSV writes the decrypted entries to the Downloads folder.
+// Rows are encoded by hand instead of with encoding/csv so the passwords never
+// become strings and every row buffer can be wiped once it is written.
+func ExportPasswordToCSV(entries []ExportEntry) error {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return err
@@ -23,39 +33,65 @@ func ExportPasswordToCSV(db *database.DB, encKey *crypto.EncryptionKey) error {
 	}
 	defer file.Close()
 
-	entries, err := db.GetAllPasswordEntries()
-	if err != nil {
-		return fmt.Errorf("error getting the entries from the database %v", err)
-	}
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-	header := []string{"ServiceName", "Username", "Password", "Notes"}
-	err = writer.Write(header)
-	if err != nil {
+	header := [][]byte{[]byte("ServiceName"), []byte("Username"), []byte("Password"), []byte("Notes")}
+	if err := writeRow(file, header); err != nil {
 		return fmt.Errorf("error writing the header %w", err)
 	}
 
 	for _, entry := range entries {
-		password, err := encKey.Decrypt(entry.EncryptedPassword)
-		if err != nil {
-			return fmt.Errorf("error decrypting the password %v", err)
-		}
-		row := []string{
-			entry.ServiceName,
-			entry.Username,
-			password,
-			entry.Notes,
-		}
-		err = writer.Write(row)
+		err := entry.Password.With(func(password []byte) error {
+			return writeRow(file, [][]byte{
+				[]byte(entry.ServiceName),
+				[]byte(entry.Username),
+				password,
+				[]byte(entry.Notes),
+			})
+		})
 		if err != nil {
 			return fmt.Errorf(" error importing a row, returning %w", err)
 		}
 	}
-	// checking if any errors occured during flashing
-	if err := writer.Error(); err != nil {
-		return fmt.Errorf("an error occured while flashing the csv writer %w", err)
+
+	return file.Sync()
+}
+
+// writeRow encodes one CSV record, quoting fields like encoding/csv does, and
+// wipes the encoded row after writing it
+func writeRow(file *os.File, fields [][]byte) error {
+	// Sized for the worst case so append never leaves an unwiped copy behind
+	size := 1
+	for _, field := range fields {
+		size += 2*len(field) + 3
+	}
+	row := make([]byte, 0, size)
+	defer func() { crypto.Wipe(row) }()
+
+	for i, field := range fields {
+		if i > 0 {
+			row = append(row, ',')
+		}
+		row = appendField(row, field)
+	}
+	row = append(row, '\n')
+
+	_, err := file.Write(row)
+	return err
+}
+
+// appendField appends field to row, quoted when it contains separators, quotes,
+// line breaks or leading spaces
+func appendField(row, field []byte) []byte {
+	needsQuotes := bytes.ContainsAny(field, ",\"\r\n") || (len(field) > 0 && (field[0] == ' ' || field[0] == '\t'))
+	if !needsQuotes {
+		return append(row, field...)
 	}
 
-	return nil
+	row = append(row, '"')
+	for _, b := range field {
+		if b == '"' {
+			row = append(row, '"')
+		}
+		row = append(row, b)
+	}
+	return append(row, '"')
 }
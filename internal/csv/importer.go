@@ -6,21 +6,21 @@ import (
 	"io"
 	"os"
 	"strings"
-
-	"svimpass/internal/crypto"
-	"svimpass/internal/database"
 )
 
 type CSVEntry struct {
 	ServiceName string `json:"serviceName"`
 	Username    string `json:"username"`
 	Password    string `json:"password"`
+	Notes       string `json:"notes"`
 }
 
-func ImportPasswordFromCSV(db *database.DB, encKey *crypto.EncryptionKey, filepath string) (int, error) {
+// ReadPasswordCSV reads the valid rows of a password CSV file, the caller
+// encrypts and stores them
+func ReadPasswordCSV(filepath string) ([]CSVEntry, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
-		return -1, fmt.Errorf("Error opening the file: %w", err)
+		return nil, fmt.Errorf("Error opening the file: %w", err)
 	}
 	defer file.Close()
 	reader := csv.NewReader(file)
@@ -28,10 +28,10 @@ func ImportPasswordFromCSV(db *database.DB, encKey *crypto.EncryptionKey, filepa
 	// skipping the header row
 	_, err = reader.Read()
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 
-	successCounter := 0
+	var entries []CSVEntry
 	for {
 		row, err := reader.Read()
 		if err == io.EOF {
@@ -53,25 +53,17 @@ func ImportPasswordFromCSV(db *database.DB, encKey *crypto.EncryptionKey, filepa
 			continue
 		}
 
-		encryptedPassword, err := encKey.Encrypt(password)
-		if err != nil {
-			continue
-		}
-
-		entry := &database.PasswordEntry{
-			ServiceName:       serviceName,
-			Username:          username,
-			EncryptedPassword: encryptedPassword,
-			Notes:             "",
+		notes := ""
+		if len(row) > 3 {
+			notes = strings.TrimSpace(row[3])
 		}
 
-		err = db.CreatePasswordEntry(entry)
-		if err != nil {
-			continue
-		}
-
-		successCounter++
-
+		entries = append(entries, CSVEntry{
+			ServiceName: serviceName,
+			Username:    username,
+			Password:    password,
+			Notes:       notes,
+		})
 	}
-	return successCounter, nil
+	return entries, nil
 }
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GetCustomFields returns the custom fields of the given entries by entry ID, each
+// in the order the fields were added
+func (db *DB) GetCustomFields(entryIDs ...int) (map[int][]*CustomField, error) {
+	fields := make(map[int][]*CustomField)
+	if len(entryIDs) == 0 {
+		return fields, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(entryIDs)), ", ")
+	args := make([]any, 0, len(entryIDs))
+	for _, id := range entryIDs {
+		args = append(args, id)
+	}
+
+	rows, err := db.conn.Query(`
+	SELECT id, entry_id, encrypted_name, encrypted_value, concealed
+	FROM custom_fields WHERE entry_id IN (`+placeholders+`)
+	ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query custom fields: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		field := &CustomField{}
+		if err := rows.Scan(&field.ID, &field.EntryID, &field.EncryptedName, &field.EncryptedValue, &field.Concealed); err != nil {
+			return nil, fmt.Errorf("failed to scan custom field: %w", err)
+		}
+		fields[field.EntryID] = append(fields[field.EntryID], field)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return fields, nil
+}
+
+// SaveCustomField adds field to its entry, or replaces it when field.ID is set, and
+// marks the entry as updated. Ciphertexts are bound to the field ID, so a new field
+// is inserted first and seal fills in its encrypted name and value once the ID is known.
+func (db *DB) SaveCustomField(field *CustomField, seal func(field *CustomField) error) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := touchEntry(tx, field.EntryID, now); err != nil {
+		return err
+	}
+
+	if field.ID == 0 {
+		if err := insertCustomField(tx, field); err != nil {
+			return err
+		}
+	}
+	if err := seal(field); err != nil {
+		return err
+	}
+	if err := writeCustomField(tx, field); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCustomField removes a custom field of an entry and marks the entry as updated
+func (db *DB) DeleteCustomField(entryID, fieldID int) error {
+	// Concealed values must not linger in free pages
+	if _, err := db.conn.Exec(`PRAGMA secure_delete = ON`); err != nil {
+		return fmt.Errorf("failed to enable secure delete: %w", err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := touchEntry(tx, entryID, time.Now()); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM custom_fields WHERE id = ? AND entry_id = ?`, fieldID, entryID)
+	if err != nil {
+		return fmt.Errorf("failed to delete custom field: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("custom field not found")
+	}
+
+	return tx.Commit()
+}
+
+// touchEntry sets the updated_at of an entry outside the trash
+func touchEntry(tx *sql.Tx, entryID int, now time.Time) error {
+	result, err := tx.Exec(`UPDATE password_entries SET updated_at = ? WHERE id = ? AND deleted_at IS NULL`, now, entryID)
+	if err != nil {
+		return fmt.Errorf("failed to update password entry: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("password entry not found")
+	}
+
+	return nil
+}
+
+// insertCustomField inserts an empty row for field and sets its ID
+func insertCustomField(tx *sql.Tx, field *CustomField) error {
+	result, err := tx.Exec(`
+	INSERT INTO custom_fields (entry_id, encrypted_name, concealed) VALUES (?, X'', ?)
+	`, field.EntryID, field.Concealed)
+	if err != nil {
+		return fmt.Errorf("failed to create custom field: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	field.ID = int(id)
+	return nil
+}
+
+// writeCustomField stores the encrypted name and value of field
+func writeCustomField(tx *sql.Tx, field *CustomField) error {
+	result, err := tx.Exec(`
+	UPDATE custom_fields SET encrypted_name = ?, encrypted_value = ?, concealed = ?
+	WHERE id = ? AND entry_id = ?
+	`, field.EncryptedName, field.EncryptedValue, field.Concealed, field.ID, field.EntryID)
+	if err != nil {
+		return fmt.Errorf("failed to save custom field: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("custom field not found")
+	}
+
+	return nil
+}
+
+// rewriteCustomFields passes the custom field ciphertexts of an entry through
+// rewrite and updates the fields that changed
+func rewriteCustomFields(tx *sql.Tx, entryID int, rewrite func(entryID int, field string, ciphertext []byte) ([]byte, error)) (bool, error) {
+	rows, err := tx.Query(`SELECT id, encrypted_name, encrypted_value, concealed FROM custom_fields WHERE entry_id = ?`, entryID)
+	if err != nil {
+		return false, fmt.Errorf("failed to query custom fields: %w", err)
+	}
+
+	var fields []*CustomField
+	for rows.Next() {
+		field := &CustomField{EntryID: entryID}
+		if err := rows.Scan(&field.ID, &field.EncryptedName, &field.EncryptedValue, &field.Concealed); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan custom field: %w", err)
+		}
+		fields = append(fields, field)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return false, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	rows.Close()
+
+	changed := false
+	for _, field := range fields {
+		ciphertexts := []struct {
+			binding string
+			value   *[]byte
+		}{
+			{field.NameBinding(), &field.EncryptedName},
+			{field.ValueBinding(), &field.EncryptedValue},
+		}
+
+		fieldChanged := false
+		for _, ciphertext := range ciphertexts {
+			// Empty values are stored as NULL
+			if len(*ciphertext.value) == 0 {
+				continue
+			}
+			rewritten, err := rewrite(entryID, ciphertext.binding, *ciphertext.value)
+			if err != nil {
+				return false, fmt.Errorf("failed to re-encrypt custom field %d of password entry %d: %w", field.ID, entryID, err)
+			}
+			if !bytes.Equal(rewritten, *ciphertext.value) {
+				*ciphertext.value = rewritten
+				fieldChanged = true
+			}
+		}
+		if !fieldChanged {
+			continue
+		}
+
+		if err := writeCustomField(tx, field); err != nil {
+			return false, fmt.Errorf("failed to update custom field %d of password entry %d: %w", field.ID, entryID, err)
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
@@ -1,70 +1,126 @@
 package database
 
 import (
+	"bytes"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// ErrEntryModified is returned when an entry changed after the caller loaded it
+var ErrEntryModified = errors.New("entry was modified since it was loaded, reload it and try again")
+
 type DB struct {
-	conn *sql.DB
+	conn     *sql.DB
+	fullText bool // SQLite was built with FTS5, search results are ranked
 }
 
-// NewDB creates a new database connection and initializes the schema
+// NewDB creates a new database connection and migrates the schema
 func NewDB(dbPath string) (*DB, error) {
+	return NewDBWithBackupDir(dbPath, "")
+}
+
+// NewDBWithBackupDir creates a new database connection and migrates the schema,
+// backing the database up into backupDir before a migration changes it
+func NewDBWithBackupDir(dbPath, backupDir string) (*DB, error) {
 	conn, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	// A single connection serializes the background ciphertext upgrade with
+	// foreground writes instead of failing them with SQLITE_BUSY
+	conn.SetMaxOpenConns(1)
+
 	db := &DB{conn: conn}
 
-	if err := db.createTables(); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+	if err := db.migrate(backupDir); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
+	db.fullText = db.ensureFullTextIndex()
 
 	return db, nil
 }
 
-// createTables creates the necessary tables if they don't exist
-func (db *DB) createTables() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS password_entries (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		service_name TEXT NOT NULL,
-		username TEXT NOT NULL,
-		encrypted_password BLOB NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		notes TEXT DEFAULT ''
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_service_name ON password_entries(service_name);
-	CREATE INDEX IF NOT EXISTS idx_username ON password_entries(username);
-	`
+const entryColumns = `id, entry_type, encrypted_service_name, encrypted_username, encrypted_password, created_at, updated_at, encrypted_notes, deleted_at, last_used_at`
 
-	_, err := db.conn.Exec(query)
-	return err
+// scanPasswordEntry scans a row selected with entryColumns
+func scanPasswordEntry(row interface{ Scan(...any) error }) (*PasswordEntry, error) {
+	entry := &PasswordEntry{}
+	var deletedAt, lastUsedAt sql.NullTime
+	err := row.Scan(
+		&entry.ID,
+		&entry.Type,
+		&entry.EncryptedServiceName,
+		&entry.EncryptedUsername,
+		&entry.EncryptedPassword,
+		&entry.CreatedAt,
+		&entry.UpdatedAt,
+		&entry.EncryptedNotes,
+		&deletedAt,
+		&lastUsedAt,
+	)
+	entry.DeletedAt = deletedAt.Time
+	entry.LastUsedAt = lastUsedAt.Time
+	return entry, err
 }
 
-// CreatePasswordEntry creates a new password entry in the database
-func (db *DB) CreatePasswordEntry(entry *PasswordEntry) error {
-	query := `
-	INSERT INTO password_entries (service_name, username, encrypted_password, notes, created_at, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?)
-	`
+// scanPasswordEntries collects every row of a query selecting entryColumns
+func scanPasswordEntries(rows *sql.Rows) ([]*PasswordEntry, error) {
+	defer rows.Close()
+
+	var entries []*PasswordEntry
+	for rows.Next() {
+		entry, err := scanPasswordEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan password entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// replaceSearchTokens replaces the blind index tokens and the full-text row of an entry
+func (db *DB) replaceSearchTokens(tx *sql.Tx, entryID int, entry *PasswordEntry) error {
+	if _, err := tx.Exec(`DELETE FROM search_tokens WHERE entry_id = ?`, entryID); err != nil {
+		return fmt.Errorf("failed to clear search tokens: %w", err)
+	}
+
+	for _, token := range entry.SearchTokens {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO search_tokens (entry_id, token) VALUES (?, ?)`, entryID, token)
+		if err != nil {
+			return fmt.Errorf("failed to insert search token: %w", err)
+		}
+	}
+
+	return db.replaceFullText(tx, entryID, entry.FullText)
+}
+
+// CreatePasswordEntry creates a new password entry, its custom fields and its search tokens
+// in the database. Ciphertexts are bound to the entry and field IDs, so the rows are inserted
+// first and seal fills in the encrypted fields and search tokens of entry once the IDs are known.
+func (db *DB) CreatePasswordEntry(entry *PasswordEntry, seal func(entry *PasswordEntry) error) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
 	now := time.Now()
-	result, err := db.conn.Exec(query,
-		entry.ServiceName,
-		entry.Username,
-		entry.EncryptedPassword,
-		entry.Notes,
-		now,
-		now,
-	)
+	result, err := tx.Exec(`
+	INSERT INTO password_entries (entry_type, service_name, username, encrypted_password, created_at, updated_at)
+	VALUES (?, '', '', X'', ?, ?)
+	`, entry.Type, now, now)
 	if err != nil {
 		return fmt.Errorf("failed to create password entry: %w", err)
 	}
@@ -75,29 +131,50 @@ func (db *DB) CreatePasswordEntry(entry *PasswordEntry) error {
 	}
 
 	entry.ID = int(id)
+	for _, field := range entry.CustomFields {
+		field.EntryID = entry.ID
+		if err := insertCustomField(tx, field); err != nil {
+			return err
+		}
+	}
+	if err := seal(entry); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE password_entries
+	SET encrypted_service_name = ?, encrypted_username = ?, encrypted_password = ?, encrypted_notes = ?
+	WHERE id = ?
+	`, entry.EncryptedServiceName, entry.EncryptedUsername, entry.EncryptedPassword, entry.EncryptedNotes, entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create password entry: %w", err)
+	}
+
+	for _, field := range entry.CustomFields {
+		if err := writeCustomField(tx, field); err != nil {
+			return err
+		}
+	}
+
+	if err := db.replaceSearchTokens(tx, entry.ID, entry); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit password entry: %w", err)
+	}
+
 	entry.CreatedAt = now
 	entry.UpdatedAt = now
 
 	return nil
 }
 
-// GetPasswordEntry retrieves a password entry by ID
+// GetPasswordEntry retrieves a password entry outside the trash by ID
 func (db *DB) GetPasswordEntry(id int) (*PasswordEntry, error) {
-	query := `
-	SELECT id, service_name, username, encrypted_password, created_at, updated_at, notes
-	FROM password_entries WHERE id = ?
-	`
+	query := `SELECT ` + entryColumns + ` FROM password_entries WHERE id = ? AND deleted_at IS NULL`
 
-	entry := &PasswordEntry{}
-	err := db.conn.QueryRow(query, id).Scan(
-		&entry.ID,
-		&entry.ServiceName,
-		&entry.Username,
-		&entry.EncryptedPassword,
-		&entry.CreatedAt,
-		&entry.UpdatedAt,
-		&entry.Notes,
-	)
+	entry, err := scanPasswordEntry(db.conn.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("password entry not found")
@@ -108,95 +185,72 @@ func (db *DB) GetPasswordEntry(id int) (*PasswordEntry, error) {
 	return entry, nil
 }
 
-// GetAllPasswordEntries retrieves all password entries
+// GetAllPasswordEntries retrieves all password entries outside the trash. The
+// metadata is encrypted, so callers sort the entries after decrypting them.
 func (db *DB) GetAllPasswordEntries() ([]*PasswordEntry, error) {
-	query := `
-	SELECT id, service_name, username, encrypted_password, created_at, updated_at, notes
-	FROM password_entries ORDER BY service_name, username
-	`
+	query := `SELECT ` + entryColumns + ` FROM password_entries WHERE deleted_at IS NULL ORDER BY id`
 
 	rows, err := db.conn.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query password entries: %w", err)
 	}
-	defer rows.Close()
 
-	var entries []*PasswordEntry
-	for rows.Next() {
-		entry := &PasswordEntry{}
-		err := rows.Scan(
-			&entry.ID,
-			&entry.ServiceName,
-			&entry.Username,
-			&entry.EncryptedPassword,
-			&entry.CreatedAt,
-			&entry.UpdatedAt,
-			&entry.Notes,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan password entry: %w", err)
-		}
-		entries = append(entries, entry)
-	}
+	return scanPasswordEntries(rows)
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over rows: %w", err)
-	}
+// UpdatePasswordEntry updates an existing password entry and replaces its search tokens
+func (db *DB) UpdatePasswordEntry(entry *PasswordEntry) error {
+	return db.updatePasswordEntry(entry, nil)
+}
 
-	return entries, nil
+// UpdatePasswordEntryIfUnchanged updates an entry like UpdatePasswordEntry, but
+// fails with ErrEntryModified unless the entry was last updated at updatedAt
+func (db *DB) UpdatePasswordEntryIfUnchanged(entry *PasswordEntry, updatedAt time.Time) error {
+	return db.updatePasswordEntry(entry, &updatedAt)
 }
 
-// SearchPasswordEntries searches for password entries by service name or username
-func (db *DB) SearchPasswordEntries(searchTerm string) ([]*PasswordEntry, error) {
+// updatePasswordEntry updates an entry, checking its updated_at in the same
+// transaction when expected is set
+func (db *DB) updatePasswordEntry(entry *PasswordEntry, expected *time.Time) error {
 	query := `
-	SELECT id, service_name, username, encrypted_password, created_at, updated_at, notes
-	FROM password_entries 
-	WHERE service_name LIKE ? OR username LIKE ?
-	ORDER BY service_name, username
+	UPDATE password_entries 
+	SET encrypted_service_name = ?, encrypted_username = ?, encrypted_password = ?, encrypted_notes = ?, updated_at = ?
+	WHERE id = ?
 	`
 
-	searchPattern := "%" + searchTerm + "%"
-	rows, err := db.conn.Query(query, searchPattern, searchPattern)
+	tx, err := db.conn.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to search password entries: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var entries []*PasswordEntry
-	for rows.Next() {
-		entry := &PasswordEntry{}
-		err := rows.Scan(
-			&entry.ID,
-			&entry.ServiceName,
-			&entry.Username,
-			&entry.EncryptedPassword,
-			&entry.CreatedAt,
-			&entry.UpdatedAt,
-			&entry.Notes,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan password entry: %w", err)
-		}
-		entries = append(entries, entry)
+	var currentPassword []byte
+	var updatedAt time.Time
+	err = tx.QueryRow(`SELECT encrypted_password, updated_at FROM password_entries WHERE id = ? AND deleted_at IS NULL`, entry.ID).Scan(&currentPassword, &updatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("password entry not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get password entry: %w", err)
+	}
+	if expected != nil && !updatedAt.Equal(*expected) {
+		return ErrEntryModified
 	}
 
-	return entries, nil
-}
+	now := time.Now()
 
-// UpdatePasswordEntry updates an existing password entry
-func (db *DB) UpdatePasswordEntry(entry *PasswordEntry) error {
-	query := `
-	UPDATE password_entries 
-	SET service_name = ?, username = ?, encrypted_password = ?, notes = ?, updated_at = ?
-	WHERE id = ?
-	`
+	// The replaced password is kept so a botched rotation can be rolled back
+	if !bytes.Equal(currentPassword, entry.EncryptedPassword) {
+		if err := recordPasswordHistory(tx, entry.ID, currentPassword, now); err != nil {
+			return err
+		}
+	}
 
-	now := time.Now()
-	result, err := db.conn.Exec(query,
-		entry.ServiceName,
-		entry.Username,
+	result, err := tx.Exec(query,
+		entry.EncryptedServiceName,
+		entry.EncryptedUsername,
 		entry.EncryptedPassword,
-		entry.Notes,
+		entry.EncryptedNotes,
 		now,
 		entry.ID,
 	)
@@ -213,15 +267,22 @@ func (db *DB) UpdatePasswordEntry(entry *PasswordEntry) error {
 		return fmt.Errorf("password entry not found")
 	}
 
+	if err := db.replaceSearchTokens(tx, entry.ID, entry); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit password entry: %w", err)
+	}
+
 	entry.UpdatedAt = now
 	return nil
 }
 
-// DeletePasswordEntry deletes a password entry by ID
+// DeletePasswordEntry moves a password entry into the trash, it is left out of
+// every listing until it is restored and purged for good by PurgeTrash
 func (db *DB) DeletePasswordEntry(id int) error {
-	query := `DELETE FROM password_entries WHERE id = ?`
-
-	result, err := db.conn.Exec(query, id)
+	result, err := db.conn.Exec(`UPDATE password_entries SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, time.Now(), id)
 	if err != nil {
 		return fmt.Errorf("failed to delete password entry: %w", err)
 	}
@@ -238,6 +299,509 @@ func (db *DB) DeletePasswordEntry(id int) error {
 	return nil
 }
 
+// MigrateLegacyEntries encrypts the metadata of entries still stored in plaintext.
+// seal receives each legacy row and returns the entry with its encrypted fields and
+// search tokens set; all rows are migrated in a single transaction.
+func (db *DB) MigrateLegacyEntries(seal func(legacy *LegacyEntry) (*PasswordEntry, error)) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+	SELECT id, service_name, username, COALESCE(notes, '')
+	FROM password_entries WHERE encrypted_service_name IS NULL
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query legacy entries: %w", err)
+	}
+
+	var legacyEntries []*LegacyEntry
+	for rows.Next() {
+		legacy := &LegacyEntry{}
+		if err := rows.Scan(&legacy.ID, &legacy.ServiceName, &legacy.Username, &legacy.Notes); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan legacy entry: %w", err)
+		}
+		legacyEntries = append(legacyEntries, legacy)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	rows.Close()
+
+	for _, legacy := range legacyEntries {
+		entry, err := seal(legacy)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt entry %d: %w", legacy.ID, err)
+		}
+
+		_, err = tx.Exec(`
+		UPDATE password_entries
+		SET service_name = '', username = '', notes = '',
+			encrypted_service_name = ?, encrypted_username = ?, encrypted_notes = ?
+		WHERE id = ?
+		`, entry.EncryptedServiceName, entry.EncryptedUsername, entry.EncryptedNotes, legacy.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update entry %d: %w", legacy.ID, err)
+		}
+
+		if err := db.replaceSearchTokens(tx, legacy.ID, entry); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit migration: %w", err)
+	}
+
+	// Rewrite the file so the old plaintext does not linger in free pages
+	if len(legacyEntries) > 0 {
+		if _, err := db.conn.Exec(`VACUUM`); err != nil {
+			fmt.Printf("Warning: failed to vacuum database after migration: %v\n", err)
+		}
+	}
+
+	return len(legacyEntries), nil
+}
+
+// ReencryptEntries passes every stored ciphertext, tags and saved queries included, through
+// reencrypt and writes the results back, together with the new key generation, in
+// a single transaction. The search index and the tag tokens are keyed from the
+// vault key as well, so the index is dropped to be rebuilt. reencrypt writes
+// envelopes, so no legacy blob is left afterwards.
+func (db *DB) ReencryptEntries(generation uint64, reencrypt func(entryID int, field string, ciphertext []byte) ([]byte, error)) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+	SELECT id, encrypted_service_name, encrypted_username, encrypted_password, encrypted_notes
+	FROM password_entries
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query password entries: %w", err)
+	}
+
+	var entries []*PasswordEntry
+	for rows.Next() {
+		entry := &PasswordEntry{}
+		err := rows.Scan(&entry.ID, &entry.EncryptedServiceName, &entry.EncryptedUsername, &entry.EncryptedPassword, &entry.EncryptedNotes)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan password entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("error iterating over rows: %w", err)
+	}
+	rows.Close()
+
+	for _, entry := range entries {
+		if _, err := rewriteCiphertexts(tx, entry, reencrypt); err != nil {
+			return err
+		}
+	}
+	if err := rewriteSharedCiphertexts(tx, reencrypt); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM search_tokens`); err != nil {
+		return fmt.Errorf("failed to clear search tokens: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM vault_meta WHERE key = 'search_index'`); err != nil {
+		return fmt.Errorf("failed to reset search index: %w", err)
+	}
+	if err := db.clearFullText(tx); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO vault_meta (key, value) VALUES ('key_generation', ?)
+	ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, strconv.FormatUint(generation, 10))
+	if err != nil {
+		return fmt.Errorf("failed to record key generation: %w", err)
+	}
+	if err := markLegacyUpgraded(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpgradeCiphertexts passes every stored ciphertext through upgrade, which returns
+// the replacement or nil to keep it. Tags and saved queries are rewritten first, then the
+// entries in batches of batchSize rows, each in its own transaction, so the upgrade
+// can run in the background and stop at any point; it returns the number of
+// entries rewritten. Each batch records the last entry it upgraded and calls
+// committed with it, and a finished upgrade records that no legacy blob is left,
+// see LegacyCiphertexts.
+func (db *DB) UpgradeCiphertexts(batchSize int, upgrade func(entryID int, field string, ciphertext []byte) ([]byte, error), committed func(lastID int)) (int, error) {
+	if err := db.upgradeShared(upgrade); err != nil {
+		return 0, err
+	}
+
+	upgraded := 0
+	lastID := 0
+	for {
+		n, nextID, err := db.upgradeBatch(lastID, batchSize, upgrade)
+		upgraded += n
+		if err != nil {
+			return upgraded, err
+		}
+		if nextID == lastID {
+			break
+		}
+		lastID = nextID
+		committed(lastID)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return upgraded, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := markLegacyUpgraded(tx); err != nil {
+		return upgraded, err
+	}
+	return upgraded, tx.Commit()
+}
+
+// LegacyCiphertexts reports whether entries may still hold legacy blobs written
+// before envelopes, and that only the entries after upgradedThrough can
+func (db *DB) LegacyCiphertexts() (pending bool, upgradedThrough int, err error) {
+	var value string
+	err = db.conn.QueryRow(`SELECT value FROM vault_meta WHERE key = 'legacy_ciphertexts'`).Scan(&value)
+	if err == nil && value == "upgraded" {
+		return false, 0, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return false, 0, fmt.Errorf("failed to get legacy ciphertext state: %w", err)
+	}
+
+	err = db.conn.QueryRow(`SELECT value FROM vault_meta WHERE key = 'legacy_upgraded_through'`).Scan(&value)
+	if err == sql.ErrNoRows {
+		return true, 0, nil
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to get legacy ciphertext state: %w", err)
+	}
+
+	upgradedThrough, err = strconv.Atoi(value)
+	return true, upgradedThrough, err
+}
+
+// markLegacyUpgraded records that every legacy blob has been upgraded
+func markLegacyUpgraded(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	INSERT INTO vault_meta (key, value) VALUES ('legacy_ciphertexts', 'upgraded')
+	ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to record legacy ciphertext state: %w", err)
+	}
+	return nil
+}
+
+// upgradeShared upgrades the ciphertexts bound to no entry in a single transaction
+func (db *DB) upgradeShared(upgrade func(entryID int, field string, ciphertext []byte) ([]byte, error)) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = rewriteSharedCiphertexts(tx, func(entryID int, field string, ciphertext []byte) ([]byte, error) {
+		replacement, err := upgrade(entryID, field, ciphertext)
+		if replacement == nil && err == nil {
+			return ciphertext, nil
+		}
+		return replacement, err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit upgraded ciphertexts: %w", err)
+	}
+	return nil
+}
+
+// upgradeBatch upgrades the entries following lastID and returns the last ID it visited
+func (db *DB) upgradeBatch(lastID, batchSize int, upgrade func(entryID int, field string, ciphertext []byte) ([]byte, error)) (int, int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, lastID, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+	SELECT id, encrypted_service_name, encrypted_username, encrypted_password, encrypted_notes
+	FROM password_entries WHERE id > ? ORDER BY id LIMIT ?
+	`, lastID, batchSize)
+	if err != nil {
+		return 0, lastID, fmt.Errorf("failed to query password entries: %w", err)
+	}
+
+	var entries []*PasswordEntry
+	for rows.Next() {
+		entry := &PasswordEntry{}
+		err := rows.Scan(&entry.ID, &entry.EncryptedServiceName, &entry.EncryptedUsername, &entry.EncryptedPassword, &entry.EncryptedNotes)
+		if err != nil {
+			rows.Close()
+			return 0, lastID, fmt.Errorf("failed to scan password entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, lastID, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	rows.Close()
+
+	upgraded := 0
+	for _, entry := range entries {
+		changed, err := rewriteCiphertexts(tx, entry, func(entryID int, field string, ciphertext []byte) ([]byte, error) {
+			replacement, err := upgrade(entryID, field, ciphertext)
+			if replacement == nil && err == nil {
+				return ciphertext, nil
+			}
+			return replacement, err
+		})
+		if err != nil {
+			return 0, lastID, err
+		}
+		if changed {
+			upgraded++
+		}
+		lastID = entry.ID
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO vault_meta (key, value) VALUES ('legacy_upgraded_through', ?)
+	ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, strconv.Itoa(lastID))
+	if err != nil {
+		return 0, lastID, fmt.Errorf("failed to record upgrade progress: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, lastID, fmt.Errorf("failed to commit upgraded entries: %w", err)
+	}
+
+	return upgraded, lastID, nil
+}
+
+// rewriteCiphertexts passes the ciphertexts of entry, its password history and
+// its custom fields through rewrite and updates the rows that changed
+func rewriteCiphertexts(tx *sql.Tx, entry *PasswordEntry, rewrite func(entryID int, field string, ciphertext []byte) ([]byte, error)) (bool, error) {
+	fields := []struct {
+		name  string
+		value *[]byte
+	}{
+		{FieldServiceName, &entry.EncryptedServiceName},
+		{FieldUsername, &entry.EncryptedUsername},
+		{FieldPassword, &entry.EncryptedPassword},
+		{FieldNotes, &entry.EncryptedNotes},
+	}
+
+	changed, err := rewriteHistory(tx, entry.ID, rewrite)
+	if err != nil {
+		return false, err
+	}
+	fieldsChanged, err := rewriteCustomFields(tx, entry.ID, rewrite)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || fieldsChanged
+
+	rowChanged := false
+	for _, field := range fields {
+		// Metadata columns are NULL until the entry has been migrated
+		if len(*field.value) == 0 {
+			continue
+		}
+		rewritten, err := rewrite(entry.ID, field.name, *field.value)
+		if err != nil {
+			return false, fmt.Errorf("failed to re-encrypt %s of password entry %d: %w", field.name, entry.ID, err)
+		}
+		if !bytes.Equal(rewritten, *field.value) {
+			*field.value = rewritten
+			rowChanged = true
+		}
+	}
+
+	if !rowChanged {
+		return changed, nil
+	}
+
+	_, err = tx.Exec(`
+	UPDATE password_entries
+	SET encrypted_service_name = ?, encrypted_username = ?, encrypted_password = ?, encrypted_notes = ?
+	WHERE id = ?
+	`, entry.EncryptedServiceName, entry.EncryptedUsername, entry.EncryptedPassword, entry.EncryptedNotes, entry.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update password entry %d: %w", entry.ID, err)
+	}
+
+	return true, nil
+}
+
+// rewriteSharedCiphertexts passes the ciphertexts bound to no entry, the tag names
+// and the saved queries, through rewrite
+func rewriteSharedCiphertexts(tx *sql.Tx, rewrite func(entryID int, field string, ciphertext []byte) ([]byte, error)) error {
+	if _, err := rewriteTags(tx, rewrite); err != nil {
+		return err
+	}
+	return rewriteSavedQueries(tx, rewrite)
+}
+
+// SearchIndexVersion returns the version of the search index, or "" if it has to
+// be rebuilt, which includes a full-text index this build can use but is not current
+func (db *DB) SearchIndexVersion() (string, error) {
+	current, err := db.fullTextCurrent()
+	if err != nil {
+		return "", err
+	}
+	if !current {
+		return "", nil
+	}
+
+	var value string
+	err = db.conn.QueryRow(`SELECT value FROM vault_meta WHERE key = 'search_index'`).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get search index version: %w", err)
+	}
+
+	return value, nil
+}
+
+// RebuildSearchIndex replaces the search tokens and the full-text row of every
+// entry with those index sets on the entry and the token of every tag with the
+// one returned by tagToken, and records version, in a single transaction
+func (db *DB) RebuildSearchIndex(version string, index func(entry *PasswordEntry) error, tagToken func(tag *Tag) ([]byte, error)) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT ` + entryColumns + ` FROM password_entries WHERE encrypted_service_name IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to query password entries: %w", err)
+	}
+
+	entries, err := scanPasswordEntries(rows)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM search_tokens`); err != nil {
+		return fmt.Errorf("failed to clear search tokens: %w", err)
+	}
+	if err := db.clearFullText(tx); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := index(entry); err != nil {
+			return fmt.Errorf("failed to index entry %d: %w", entry.ID, err)
+		}
+		if err := db.replaceSearchTokens(tx, entry.ID, entry); err != nil {
+			return err
+		}
+	}
+	if err := reindexTags(tx, tagToken); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO vault_meta (key, value) VALUES ('search_index', ?)
+	ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, version)
+	if err != nil {
+		return fmt.Errorf("failed to record search index version: %w", err)
+	}
+
+	if db.fullText {
+		_, err = tx.Exec(`
+		INSERT INTO vault_meta (key, value) VALUES ('fulltext_index', ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+		`, fullTextIndexVersion)
+		if err != nil {
+			return fmt.Errorf("failed to record full-text index version: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// KeyGeneration returns the key generation recorded by the last re-encryption
+func (db *DB) KeyGeneration() (uint64, error) {
+	var value string
+	err := db.conn.QueryRow(`SELECT value FROM vault_meta WHERE key = 'key_generation'`).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get key generation: %w", err)
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// Backup writes a consistent snapshot of the database to destPath
+func (db *DB) Backup(destPath string) error {
+	if _, err := db.conn.Exec(`VACUUM INTO ?`, destPath); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// Wipe deletes every entry, custom field, password version, tag, saved query,
+// search token, full-text row and vault setting. Deleted content is overwritten
+// and the file is vacuumed so no old pages remain.
+func (db *DB) Wipe() error {
+	if _, err := db.conn.Exec(`PRAGMA secure_delete = ON`); err != nil {
+		return fmt.Errorf("failed to enable secure delete: %w", err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"password_entries", "custom_fields", "password_history", "entry_tags", "tags", "saved_queries", "search_tokens", "vault_meta"} {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return fmt.Errorf("failed to wipe %s: %w", table, err)
+		}
+	}
+	if err := db.clearFullText(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if _, err := db.conn.Exec(`VACUUM`); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	return db.conn.Close()
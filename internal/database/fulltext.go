@@ -0,0 +1,186 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The full-text index ranks search results with FTS5. Like search_tokens it holds
+// keyed tokens instead of words, one per word prefix, so BM25 sees how often and
+// in which column a word occurs but the database never sees the word.
+//
+// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag. Builds
+// without it still search, but cannot rank by relevance; whenever they change
+// an entry they drop the index version so the next build with FTS5 rebuilds it.
+
+// fullTextIndexVersion is recorded in vault_meta once the index matches the entries
+const fullTextIndexVersion = "1"
+
+// bm25 column weights of the service name, the username and the notes
+const fullTextWeights = "10.0, 5.0, 1.0"
+
+// FullTextTokens are the word tokens of the searchable columns of an entry
+type FullTextTokens struct {
+	Service  [][]byte
+	Username [][]byte
+	Notes    [][]byte
+}
+
+// FullTextAvailable reports whether this build can rank search results by relevance
+func (db *DB) FullTextAvailable() bool {
+	return db.fullText
+}
+
+// ensureFullTextIndex creates the full-text index when SQLite has FTS5 and
+// reports whether it can be used
+func (db *DB) ensureFullTextIndex() bool {
+	// A temporary probe, so builds without FTS5 never create a table they cannot read
+	if _, err := db.conn.Exec(`CREATE VIRTUAL TABLE temp.fts5_probe USING fts5(x)`); err != nil {
+		return false
+	}
+	if _, err := db.conn.Exec(`DROP TABLE temp.fts5_probe`); err != nil {
+		fmt.Printf("Warning: failed to drop full-text probe: %v\n", err)
+	}
+
+	_, err := db.conn.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS entry_fulltext USING fts5(service, username, notes)`)
+	if err != nil {
+		fmt.Printf("Warning: failed to create full-text index, results will not be ranked: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// replaceFullText replaces the full-text row of an entry, or marks the index as
+// stale when this build cannot write it
+func (db *DB) replaceFullText(tx *sql.Tx, entryID int, tokens FullTextTokens) error {
+	if !db.fullText {
+		if _, err := tx.Exec(`DELETE FROM vault_meta WHERE key = 'fulltext_index'`); err != nil {
+			return fmt.Errorf("failed to reset full-text index: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM entry_fulltext WHERE rowid = ?`, entryID); err != nil {
+		return fmt.Errorf("failed to clear full-text index: %w", err)
+	}
+
+	_, err := tx.Exec(`
+	INSERT INTO entry_fulltext (rowid, service, username, notes) VALUES (?, ?, ?, ?)
+	`, entryID, fullTextColumn(tokens.Service), fullTextColumn(tokens.Username), fullTextColumn(tokens.Notes))
+	if err != nil {
+		return fmt.Errorf("failed to update full-text index: %w", err)
+	}
+	return nil
+}
+
+// clearFullText empties the full-text index and drops its version, so it is
+// rebuilt together with the search tokens
+func (db *DB) clearFullText(tx *sql.Tx) error {
+	if db.fullText {
+		if _, err := tx.Exec(`DELETE FROM entry_fulltext`); err != nil {
+			return fmt.Errorf("failed to clear full-text index: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM vault_meta WHERE key = 'fulltext_index'`); err != nil {
+		return fmt.Errorf("failed to reset full-text index: %w", err)
+	}
+	return nil
+}
+
+// deleteFullText removes the full-text rows of the entries selected by the
+// subquery entries
+func (db *DB) deleteFullText(tx *sql.Tx, entries string, args ...any) error {
+	if !db.fullText {
+		return nil
+	}
+	if _, err := tx.Exec(`DELETE FROM entry_fulltext WHERE rowid IN (`+entries+`)`, args...); err != nil {
+		return fmt.Errorf("failed to purge full-text index: %w", err)
+	}
+	return nil
+}
+
+// fullTextCurrent reports whether the full-text index is missing entries, which
+// only matters to builds that can use it
+func (db *DB) fullTextCurrent() (bool, error) {
+	if !db.fullText {
+		return true, nil
+	}
+
+	var value string
+	err := db.conn.QueryRow(`SELECT value FROM vault_meta WHERE key = 'fulltext_index'`).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get full-text index version: %w", err)
+	}
+
+	return value == fullTextIndexVersion, nil
+}
+
+// RankEntries returns the BM25 relevance of the given entries for the word
+// tokens of a query by entry ID, higher is more relevant. Entries matching none
+// of the tokens are left out, and so is everything when FTS5 is not available.
+func (db *DB) RankEntries(entryIDs []int, tokens [][]byte) (map[int]float64, error) {
+	ranks := make(map[int]float64)
+	if !db.fullText || len(entryIDs) == 0 || len(tokens) == 0 {
+		return ranks, nil
+	}
+
+	// Tokens are hex, the match expression never holds user input
+	terms := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		terms = append(terms, `"`+hex.EncodeToString(token)+`"`)
+	}
+
+	args := []any{strings.Join(terms, " OR ")}
+	for _, id := range entryIDs {
+		args = append(args, id)
+	}
+
+	rows, err := db.conn.Query(`
+	SELECT rowid, bm25(entry_fulltext, `+fullTextWeights+`)
+	FROM entry_fulltext
+	WHERE entry_fulltext MATCH ? AND rowid IN (`+placeholders(len(entryIDs))+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank password entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var score float64
+		if err := rows.Scan(&id, &score); err != nil {
+			return nil, fmt.Errorf("failed to scan rank: %w", err)
+		}
+		// bm25 is negative, the more so the better the match
+		ranks[id] = -score
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return ranks, nil
+}
+
+// MarkEntryUsed records that the secret of an entry was just used, search
+// results rank recently used entries higher. The entry is not marked as updated.
+func (db *DB) MarkEntryUsed(id int) error {
+	if _, err := db.conn.Exec(`UPDATE password_entries SET last_used_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+		return fmt.Errorf("failed to record entry use: %w", err)
+	}
+	return nil
+}
+
+// fullTextColumn joins the tokens of a column into the text FTS5 indexes
+func fullTextColumn(tokens [][]byte) string {
+	words := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		words = append(words, hex.EncodeToString(token))
+	}
+	return strings.Join(words, " ")
+}
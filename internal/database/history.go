@@ -0,0 +1,210 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DefaultHistoryLimit is how many replaced passwords are kept per entry unless
+// the limit was changed with SetHistoryLimit
+const DefaultHistoryLimit = 10
+
+// GetPasswordHistory returns the replaced passwords of an entry, newest first
+func (db *DB) GetPasswordHistory(entryID int) ([]*PasswordHistoryEntry, error) {
+	rows, err := db.conn.Query(`
+	SELECT id, entry_id, encrypted_password, replaced_at
+	FROM password_history WHERE entry_id = ?
+	ORDER BY replaced_at DESC, id DESC
+	`, entryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query password history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []*PasswordHistoryEntry
+	for rows.Next() {
+		version := &PasswordHistoryEntry{}
+		if err := rows.Scan(&version.ID, &version.EntryID, &version.EncryptedPassword, &version.ReplacedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan password history: %w", err)
+		}
+		history = append(history, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return history, nil
+}
+
+// RollbackPassword makes the replaced password historyID the current password of
+// its entry. The current password goes into the history, so a rollback can be undone.
+func (db *DB) RollbackPassword(entryID, historyID int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var previous []byte
+	err = tx.QueryRow(`SELECT encrypted_password FROM password_history WHERE id = ? AND entry_id = ?`, historyID, entryID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("password version not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get password version: %w", err)
+	}
+
+	var current []byte
+	err = tx.QueryRow(`SELECT encrypted_password FROM password_entries WHERE id = ?`, entryID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("password entry not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get password entry: %w", err)
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec(`DELETE FROM password_history WHERE id = ?`, historyID); err != nil {
+		return fmt.Errorf("failed to remove password version: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE password_entries SET encrypted_password = ?, updated_at = ? WHERE id = ?`, previous, now, entryID); err != nil {
+		return fmt.Errorf("failed to restore password: %w", err)
+	}
+	if err := recordPasswordHistory(tx, entryID, current, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// HistoryLimit returns how many replaced passwords are kept per entry
+func (db *DB) HistoryLimit() (int, error) {
+	return historyLimit(db.conn)
+}
+
+// SetHistoryLimit changes how many replaced passwords are kept per entry and drops
+// the versions beyond the new limit, 0 keeps no history
+func (db *DB) SetHistoryLimit(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("history limit cannot be negative")
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO vault_meta (key, value) VALUES ('history_limit', ?)
+	ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, strconv.Itoa(limit))
+	if err != nil {
+		return fmt.Errorf("failed to record history limit: %w", err)
+	}
+
+	_, err = tx.Exec(`
+	DELETE FROM password_history WHERE id IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY entry_id ORDER BY replaced_at DESC, id DESC) AS position
+			FROM password_history
+		) WHERE position > ?
+	)`, limit)
+	if err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// queryRower is implemented by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// historyLimit reads the history limit, DefaultHistoryLimit when none was set
+func historyLimit(q queryRower) (int, error) {
+	var value string
+	err := q.QueryRow(`SELECT value FROM vault_meta WHERE key = 'history_limit'`).Scan(&value)
+	if err == sql.ErrNoRows {
+		return DefaultHistoryLimit, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get history limit: %w", err)
+	}
+
+	return strconv.Atoi(value)
+}
+
+// recordPasswordHistory keeps a replaced password of an entry and drops the
+// oldest versions beyond the history limit
+func recordPasswordHistory(tx *sql.Tx, entryID int, encryptedPassword []byte, replacedAt time.Time) error {
+	limit, err := historyLimit(tx)
+	if err != nil {
+		return err
+	}
+
+	if limit > 0 {
+		_, err := tx.Exec(`
+		INSERT INTO password_history (entry_id, encrypted_password, replaced_at) VALUES (?, ?, ?)
+		`, entryID, encryptedPassword, replacedAt)
+		if err != nil {
+			return fmt.Errorf("failed to record password history: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+	DELETE FROM password_history WHERE entry_id = ? AND id NOT IN (
+		SELECT id FROM password_history WHERE entry_id = ?
+		ORDER BY replaced_at DESC, id DESC LIMIT ?
+	)`, entryID, entryID, limit)
+	if err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+
+	return nil
+}
+
+// rewriteHistory passes the replaced passwords of an entry through rewrite and
+// updates the ones that changed
+func rewriteHistory(tx *sql.Tx, entryID int, rewrite func(entryID int, field string, ciphertext []byte) ([]byte, error)) (bool, error) {
+	rows, err := tx.Query(`SELECT id, encrypted_password FROM password_history WHERE entry_id = ?`, entryID)
+	if err != nil {
+		return false, fmt.Errorf("failed to query password history: %w", err)
+	}
+
+	var history []*PasswordHistoryEntry
+	for rows.Next() {
+		version := &PasswordHistoryEntry{EntryID: entryID}
+		if err := rows.Scan(&version.ID, &version.EncryptedPassword); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan password history: %w", err)
+		}
+		history = append(history, version)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return false, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	rows.Close()
+
+	changed := false
+	for _, version := range history {
+		rewritten, err := rewrite(entryID, FieldPassword, version.EncryptedPassword)
+		if err != nil {
+			return false, fmt.Errorf("failed to re-encrypt password history of password entry %d: %w", entryID, err)
+		}
+		if bytes.Equal(rewritten, version.EncryptedPassword) {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE password_history SET encrypted_password = ? WHERE id = ?`, rewritten, version.ID); err != nil {
+			return false, fmt.Errorf("failed to update password history of password entry %d: %w", entryID, err)
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,306 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// migration moves the schema from version-1 to version. Migrations run in order,
+// each in its own transaction together with the schema_version row recording it.
+type migration struct {
+	version int
+	name    string
+	apply   func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change. Append new migrations at the end and
+// never edit one that has been released.
+//
+// Databases from before the schema_version table are at version 0, whatever
+// they already contain, so the first migrations only create what is missing.
+var migrations = []migration{
+	{1, "initial schema", migrateInitialSchema},
+	{2, "encrypted metadata and blind index", migrateEncryptedMetadata},
+	{3, "password history", migratePasswordHistory},
+	{4, "trash", migrateTrash},
+	{5, "custom fields", migrateCustomFields},
+	{6, "entry types", migrateEntryTypes},
+	{7, "tags", migrateTags},
+	{8, "saved queries", migrateSavedQueries},
+	{9, "entry usage", migrateEntryUsage},
+}
+
+// SchemaVersion is the schema version this build creates and understands
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrate brings the schema up to date. A database from a newer build is refused,
+// and existing data is backed up into backupDir before the first migration runs.
+func (db *DB) migrate(backupDir string) error {
+	if _, err := db.conn.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	current, err := db.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	latest := SchemaVersion()
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than supported version %d, update svimpass", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	if backupDir != "" {
+		hasData, err := db.hasTables()
+		if err != nil {
+			return err
+		}
+		if hasData {
+			if err := db.backupBeforeMigration(backupDir, current); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := db.applyMigration(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// schemaVersion returns the highest applied migration, 0 when there is none
+func (db *DB) schemaVersion() (int, error) {
+	var version sql.NullInt64
+	if err := db.conn.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// hasTables reports whether the database holds tables besides schema_version,
+// new databases have nothing worth backing up
+func (db *DB) hasTables() (bool, error) {
+	var count int
+	err := db.conn.QueryRow(`
+	SELECT COUNT(*) FROM sqlite_master
+	WHERE type = 'table' AND name NOT IN ('schema_version', 'sqlite_sequence')
+	`).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect database: %w", err)
+	}
+	return count > 0, nil
+}
+
+// backupBeforeMigration snapshots the database into a timestamped directory in backupDir
+func (db *DB) backupBeforeMigration(backupDir string, version int) error {
+	dir := filepath.Join(backupDir, fmt.Sprintf("schema-v%d-%s", version, time.Now().Format("20060102-150405")))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := db.Backup(filepath.Join(dir, "passwords.db")); err != nil {
+		return fmt.Errorf("refusing to migrate without a backup: %w", err)
+	}
+	return nil
+}
+
+// applyMigration runs m and records it in a single transaction
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.apply(tx); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name) VALUES (?, ?)`, m.version, m.name); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+	}
+
+	return tx.Commit()
+}
+
+// columnNames returns the columns of table
+func columnNames(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		existing[name] = true
+	}
+
+	return existing, rows.Err()
+}
+
+// migrateInitialSchema creates the entry table of the first releases
+func migrateInitialSchema(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS password_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		service_name TEXT NOT NULL,
+		username TEXT NOT NULL,
+		encrypted_password BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		notes TEXT DEFAULT ''
+	)`)
+	return err
+}
+
+// migrateEncryptedMetadata adds the encrypted metadata columns, the vault settings
+// and the blind index. The old plaintext columns are kept, but emptied once the
+// rows have been migrated, and their indexes are dropped.
+func migrateEncryptedMetadata(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS vault_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS search_tokens (
+		entry_id INTEGER NOT NULL,
+		token BLOB NOT NULL,
+		PRIMARY KEY (entry_id, token)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_search_token ON search_tokens(token);
+
+	DROP INDEX IF EXISTS idx_service_name;
+	DROP INDEX IF EXISTS idx_username;
+	`)
+	if err != nil {
+		return err
+	}
+
+	existing, err := columnNames(tx, "password_entries")
+	if err != nil {
+		return err
+	}
+
+	for _, column := range []string{"encrypted_service_name", "encrypted_username", "encrypted_notes"} {
+		if existing[column] {
+			continue
+		}
+		if _, err := tx.Exec(`ALTER TABLE password_entries ADD COLUMN ` + column + ` BLOB`); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", column, err)
+		}
+	}
+
+	return nil
+}
+
+// migratePasswordHistory adds the table keeping the replaced passwords of each entry
+func migratePasswordHistory(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE password_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entry_id INTEGER NOT NULL,
+		encrypted_password BLOB NOT NULL,
+		replaced_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX idx_password_history_entry ON password_history(entry_id);
+	`)
+	return err
+}
+
+// migrateTrash lets deleted entries stay in the table until they are purged
+func migrateTrash(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	ALTER TABLE password_entries ADD COLUMN deleted_at DATETIME;
+
+	CREATE INDEX idx_password_entries_deleted ON password_entries(deleted_at);
+	`)
+	return err
+}
+
+// migrateCustomFields adds the table holding the named fields of each entry
+func migrateCustomFields(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE custom_fields (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entry_id INTEGER NOT NULL,
+		encrypted_name BLOB NOT NULL,
+		encrypted_value BLOB,
+		concealed INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE INDEX idx_custom_fields_entry ON custom_fields(entry_id);
+	`)
+	return err
+}
+
+// migrateEntryTypes records the type of each entry, existing entries are logins
+func migrateEntryTypes(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE password_entries ADD COLUMN entry_type TEXT NOT NULL DEFAULT 'login'`)
+	return err
+}
+
+// migrateTags adds the tags and the table linking them to entries. Tag names are
+// encrypted, tags are looked up by their blind index token.
+func migrateTags(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token BLOB NOT NULL UNIQUE,
+		encrypted_name BLOB NOT NULL
+	);
+
+	CREATE TABLE entry_tags (
+		entry_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (entry_id, tag_id)
+	);
+
+	CREATE INDEX idx_entry_tags_tag ON entry_tags(tag_id);
+	`)
+	return err
+}
+
+// migrateSavedQueries adds the table holding named searches, name and query both encrypted
+func migrateSavedQueries(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE saved_queries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		encrypted_name BLOB NOT NULL,
+		encrypted_query BLOB NOT NULL
+	)`)
+	return err
+}
+
+// migrateEntryUsage records when the secret of each entry was last used, so
+// search can rank recently used entries higher
+func migrateEntryUsage(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE password_entries ADD COLUMN last_used_at DATETIME`)
+	return err
+}
@@ -1,17 +1,119 @@
 // Package database handnles all the database
 package database
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
-// PasswordEntry represent a password entry
+// PasswordEntry represent a password entry. Every field but the type and the
+// timestamps is encrypted with the vault key; SearchTokens and FullText are the
+// blind index written with it and CustomFields are the fields CreatePasswordEntry
+// adds to a new entry. EncryptedPassword is empty for types without a secret.
 type PasswordEntry struct {
+	ID                   int            `db:"id"`
+	Type                 string         `db:"entry_type"`
+	EncryptedServiceName []byte         `db:"encrypted_service_name"`
+	EncryptedUsername    []byte         `db:"encrypted_username"`
+	EncryptedPassword    []byte         `db:"encrypted_password"`
+	CreatedAt            time.Time      `db:"created_at"`
+	UpdatedAt            time.Time      `db:"updated_at"`
+	EncryptedNotes       []byte         `db:"encrypted_notes"`
+	DeletedAt            time.Time      `db:"deleted_at"`   // zero unless the entry is in the trash
+	LastUsedAt           time.Time      `db:"last_used_at"` // zero until its secret is first used
+	SearchTokens         [][]byte       `db:"-"`
+	FullText             FullTextTokens `db:"-"`
+	CustomFields         []*CustomField `db:"-"`
+}
+
+// PasswordHistoryEntry is a password an entry held before it was replaced. The
+// ciphertext is kept as it was, still bound to the entry and FieldPassword.
+type PasswordHistoryEntry struct {
 	ID                int       `db:"id"`
-	ServiceName       string    `db:"service_name"`
-	Username          string    `db:"username"`
+	EntryID           int       `db:"entry_id"`
 	EncryptedPassword []byte    `db:"encrypted_password"`
-	CreatedAt         time.Time `db:"created_at"`
-	UpdatedAt         time.Time `db:"updated_at"`
-	Notes             string    `db:"notes"`
+	ReplacedAt        time.Time `db:"replaced_at"`
+}
+
+// CustomField is a named field of an entry. Name and value are encrypted, bound to
+// the entry and to the field ID; concealed values are bound to FieldConcealedValue
+// instead of FieldCustomValue, so flipping Concealed makes the value unreadable.
+type CustomField struct {
+	ID             int    `db:"id"`
+	EntryID        int    `db:"entry_id"`
+	EncryptedName  []byte `db:"encrypted_name"`
+	EncryptedValue []byte `db:"encrypted_value"`
+	Concealed      bool   `db:"concealed"`
+}
+
+// Tag is a label shared by any number of entries. Token is the blind index token
+// of the normalized name; the name is encrypted outside of any entry, bound to
+// the tag ID. Entries counts the entries outside the trash carrying the tag.
+type Tag struct {
+	ID            int    `db:"id"`
+	Token         []byte `db:"token"`
+	EncryptedName []byte `db:"encrypted_name"`
+	Entries       int    `db:"-"`
+}
+
+// NameBinding returns the field name the name ciphertext of t is bound to
+func (t *Tag) NameBinding() string {
+	return FieldTagName + ":" + strconv.Itoa(t.ID)
+}
+
+// SavedQuery is a named search. Like tags, saved queries belong to no entry, their
+// name and query are bound to the saved query ID.
+type SavedQuery struct {
+	ID             int    `db:"id"`
+	EncryptedName  []byte `db:"encrypted_name"`
+	EncryptedQuery []byte `db:"encrypted_query"`
+}
+
+// NameBinding returns the field name the name ciphertext of q is bound to
+func (q *SavedQuery) NameBinding() string {
+	return FieldSavedQueryName + ":" + strconv.Itoa(q.ID)
+}
+
+// QueryBinding returns the field name the query ciphertext of q is bound to
+func (q *SavedQuery) QueryBinding() string {
+	return FieldSavedQuery + ":" + strconv.Itoa(q.ID)
+}
+
+// Field names bound into the ciphertext of each encrypted column, so a ciphertext
+// only decrypts in the row and column it was written for
+const (
+	FieldServiceName = "service_name"
+	FieldUsername    = "username"
+	FieldPassword    = "password"
+	FieldNotes       = "notes"
+
+	FieldCustomName     = "custom_name"
+	FieldCustomValue    = "custom_value"
+	FieldConcealedValue = "concealed_value"
+	FieldTagName        = "tag_name"
+	FieldSavedQueryName = "saved_query_name"
+	FieldSavedQuery     = "saved_query"
+)
+
+// NameBinding returns the field name the name ciphertext of f is bound to
+func (f *CustomField) NameBinding() string {
+	return FieldCustomName + ":" + strconv.Itoa(f.ID)
+}
+
+// ValueBinding returns the field name the value ciphertext of f is bound to
+func (f *CustomField) ValueBinding() string {
+	if f.Concealed {
+		return FieldConcealedValue + ":" + strconv.Itoa(f.ID)
+	}
+	return FieldCustomValue + ":" + strconv.Itoa(f.ID)
+}
+
+// LegacyEntry holds the plaintext metadata of a row written before metadata encryption
+type LegacyEntry struct {
+	ID          int    `db:"id"`
+	ServiceName string `db:"service_name"`
+	Username    string `db:"username"`
+	Notes       string `db:"notes"`
 }
 
 // CreatePasswordRequest represents the data needed for a new entry
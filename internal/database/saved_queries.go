@@ -0,0 +1,155 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+)
+
+// GetSavedQueries returns the saved queries in the order they were saved
+func (db *DB) GetSavedQueries() ([]*SavedQuery, error) {
+	rows, err := db.conn.Query(`SELECT id, encrypted_name, encrypted_query FROM saved_queries ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query saved queries: %w", err)
+	}
+
+	return scanSavedQueries(rows)
+}
+
+// SaveQuery adds q, or replaces it when q.ID is set. Ciphertexts are bound to the
+// ID, so a new query is inserted first and seal fills in its encrypted name and
+// query once the ID is known.
+func (db *DB) SaveQuery(q *SavedQuery, seal func(q *SavedQuery) error) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if q.ID == 0 {
+		result, err := tx.Exec(`INSERT INTO saved_queries (encrypted_name, encrypted_query) VALUES (X'', X'')`)
+		if err != nil {
+			return fmt.Errorf("failed to create saved query: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get last insert id: %w", err)
+		}
+		q.ID = int(id)
+	}
+
+	if err := seal(q); err != nil {
+		return err
+	}
+	if err := writeSavedQuery(tx, q); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteSavedQuery removes a saved query
+func (db *DB) DeleteSavedQuery(id int) error {
+	result, err := db.conn.Exec(`DELETE FROM saved_queries WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete saved query: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("saved query not found")
+	}
+
+	return nil
+}
+
+// scanSavedQueries collects every row of a query selecting the id, name and query
+func scanSavedQueries(rows *sql.Rows) ([]*SavedQuery, error) {
+	defer rows.Close()
+
+	var queries []*SavedQuery
+	for rows.Next() {
+		q := &SavedQuery{}
+		if err := rows.Scan(&q.ID, &q.EncryptedName, &q.EncryptedQuery); err != nil {
+			return nil, fmt.Errorf("failed to scan saved query: %w", err)
+		}
+		queries = append(queries, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return queries, nil
+}
+
+// writeSavedQuery stores the encrypted name and query of q
+func writeSavedQuery(tx *sql.Tx, q *SavedQuery) error {
+	result, err := tx.Exec(`
+	UPDATE saved_queries SET encrypted_name = ?, encrypted_query = ? WHERE id = ?
+	`, q.EncryptedName, q.EncryptedQuery, q.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save query: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("saved query not found")
+	}
+
+	return nil
+}
+
+// rewriteSavedQueries passes the saved query ciphertexts through rewrite and
+// updates the queries that changed. Saved queries belong to no entry, their
+// ciphertexts are bound to entry ID 0.
+func rewriteSavedQueries(tx *sql.Tx, rewrite func(entryID int, field string, ciphertext []byte) ([]byte, error)) error {
+	rows, err := tx.Query(`SELECT id, encrypted_name, encrypted_query FROM saved_queries ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to query saved queries: %w", err)
+	}
+
+	queries, err := scanSavedQueries(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, q := range queries {
+		ciphertexts := []struct {
+			binding string
+			value   *[]byte
+		}{
+			{q.NameBinding(), &q.EncryptedName},
+			{q.QueryBinding(), &q.EncryptedQuery},
+		}
+
+		changed := false
+		for _, ciphertext := range ciphertexts {
+			rewritten, err := rewrite(0, ciphertext.binding, *ciphertext.value)
+			if err != nil {
+				return fmt.Errorf("failed to re-encrypt saved query %d: %w", q.ID, err)
+			}
+			if !bytes.Equal(rewritten, *ciphertext.value) {
+				*ciphertext.value = rewritten
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		if err := writeSavedQuery(tx, q); err != nil {
+			return fmt.Errorf("failed to update saved query %d: %w", q.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Condition is a parameterized SQL condition on password_entries. Conditions are
+// built with the functions below, combined with All, Any and Not, and run with
+// FindEntries; values never end up in the SQL text.
+type Condition struct {
+	sql  string
+	args []any
+}
+
+// Everything is the condition every entry meets
+var Everything = Condition{sql: "1"}
+
+// MatchTokens holds for the entries carrying every blind index token of at least
+// one of the token groups. Empty groups are skipped, with none left it holds for
+// every entry.
+func MatchTokens(tokenGroups ...[][]byte) Condition {
+	var subqueries []string
+	var args []any
+	for _, tokens := range tokenGroups {
+		if len(tokens) == 0 {
+			continue
+		}
+
+		subqueries = append(subqueries, `
+		SELECT entry_id FROM search_tokens
+		WHERE token IN (`+placeholders(len(tokens))+`)
+		GROUP BY entry_id HAVING COUNT(DISTINCT token) = ?`)
+		for _, token := range tokens {
+			args = append(args, token)
+		}
+		args = append(args, len(tokens))
+	}
+
+	if len(subqueries) == 0 {
+		return Everything
+	}
+	return Condition{sql: `id IN (` + strings.Join(subqueries, " UNION ") + `)`, args: args}
+}
+
+// HasTag holds for the entries carrying the tag with token
+func HasTag(token []byte) Condition {
+	return Condition{
+		sql: `id IN (
+		SELECT et.entry_id FROM entry_tags et JOIN tags t ON t.id = et.tag_id
+		WHERE t.token = ?)`,
+		args: []any{token},
+	}
+}
+
+// OfType holds for the entries of an entry type
+func OfType(entryType string) Condition {
+	return Condition{sql: `entry_type = ?`, args: []any{strings.ToLower(entryType)}}
+}
+
+// CreatedBetween holds for the entries created at or after after and before
+// before, a zero bound is left open
+func CreatedBetween(after, before time.Time) Condition {
+	return between("created_at", after, before)
+}
+
+// UpdatedBetween holds for the entries last updated at or after after and before
+// before, a zero bound is left open
+func UpdatedBetween(after, before time.Time) Condition {
+	return between("updated_at", after, before)
+}
+
+// between compares through julianday, the column holds timestamps written in
+// different layouts and time zones
+func between(column string, after, before time.Time) Condition {
+	var parts []string
+	var args []any
+	if !after.IsZero() {
+		parts = append(parts, `julianday(`+column+`) >= julianday(?)`)
+		args = append(args, after)
+	}
+	if !before.IsZero() {
+		parts = append(parts, `julianday(`+column+`) < julianday(?)`)
+		args = append(args, before)
+	}
+
+	if len(parts) == 0 {
+		return Everything
+	}
+	return Condition{sql: strings.Join(parts, " AND "), args: args}
+}
+
+// Not holds where c does not
+func Not(c Condition) Condition {
+	return Condition{sql: `NOT (` + c.sql + `)`, args: c.args}
+}
+
+// All holds where every one of conditions holds, and for every entry without conditions
+func All(conditions ...Condition) Condition {
+	return join(conditions, " AND ", Everything)
+}
+
+// Any holds where at least one of conditions holds, and for no entry without conditions
+func Any(conditions ...Condition) Condition {
+	return join(conditions, " OR ", Condition{sql: "0"})
+}
+
+func join(conditions []Condition, operator string, empty Condition) Condition {
+	if len(conditions) == 0 {
+		return empty
+	}
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+
+	parts := make([]string, 0, len(conditions))
+	var args []any
+	for _, c := range conditions {
+		parts = append(parts, `(`+c.sql+`)`)
+		args = append(args, c.args...)
+	}
+	return Condition{sql: strings.Join(parts, operator), args: args}
+}
+
+// FindEntries returns the entries outside the trash meeting c
+func (db *DB) FindEntries(c Condition) ([]*PasswordEntry, error) {
+	query := `SELECT ` + entryColumns + ` FROM password_entries
+	WHERE deleted_at IS NULL AND (` + c.sql + `)
+	ORDER BY id`
+
+	rows, err := db.conn.Query(query, c.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search password entries: %w", err)
+	}
+
+	return scanPasswordEntries(rows)
+}
+
+// placeholders returns n comma-separated SQL placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
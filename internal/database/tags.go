@@ -0,0 +1,264 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// GetTags returns the tags carried by at least one entry outside the trash, with
+// the number of such entries
+func (db *DB) GetTags() ([]*Tag, error) {
+	rows, err := db.conn.Query(`
+	SELECT t.id, t.token, t.encrypted_name, COUNT(*)
+	FROM tags t
+	JOIN entry_tags et ON et.tag_id = t.id
+	JOIN password_entries e ON e.id = et.entry_id AND e.deleted_at IS NULL
+	GROUP BY t.id
+	ORDER BY t.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []*Tag
+	for rows.Next() {
+		tag := &Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Token, &tag.EncryptedName, &tag.Entries); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return tags, nil
+}
+
+// GetEntryTags returns the tags of the given entries by entry ID
+func (db *DB) GetEntryTags(entryIDs ...int) (map[int][]*Tag, error) {
+	tags := make(map[int][]*Tag)
+	if len(entryIDs) == 0 {
+		return tags, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(entryIDs)), ", ")
+	args := make([]any, 0, len(entryIDs))
+	for _, id := range entryIDs {
+		args = append(args, id)
+	}
+
+	rows, err := db.conn.Query(`
+	SELECT et.entry_id, t.id, t.token, t.encrypted_name
+	FROM entry_tags et JOIN tags t ON t.id = et.tag_id
+	WHERE et.entry_id IN (`+placeholders+`)
+	ORDER BY t.id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query entry tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entryID int
+		tag := &Tag{}
+		if err := rows.Scan(&entryID, &tag.ID, &tag.Token, &tag.EncryptedName); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags[entryID] = append(tags[entryID], tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return tags, nil
+}
+
+// TagEntries adds the tag with tag.Token to the given entries outside the trash and
+// returns how many entries were newly tagged. A tag seen for the first time is
+// inserted first, seal fills in its encrypted name once its ID is known.
+func (db *DB) TagEntries(entryIDs []int, tag *Tag, seal func(tag *Tag) error) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`SELECT id, encrypted_name FROM tags WHERE token = ?`, tag.Token).Scan(&tag.ID, &tag.EncryptedName)
+	if err == sql.ErrNoRows {
+		if err := insertTag(tx, tag, seal); err != nil {
+			return 0, err
+		}
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to get tag: %w", err)
+	}
+
+	tagged := 0
+	for _, entryID := range entryIDs {
+		result, err := tx.Exec(`
+		INSERT OR IGNORE INTO entry_tags (entry_id, tag_id)
+		SELECT id, ? FROM password_entries WHERE id = ? AND deleted_at IS NULL
+		`, tag.ID, entryID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to tag entry %d: %w", entryID, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		tagged += int(rowsAffected)
+	}
+
+	// A tag that ended up on no entry is not kept
+	if err := deleteUnusedTags(tx); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit tags: %w", err)
+	}
+
+	return tagged, nil
+}
+
+// UntagEntries removes the tag with token from the given entries and returns how
+// many entries carried it. Tags left on no entry are deleted.
+func (db *DB) UntagEntries(entryIDs []int, token []byte) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	untagged := 0
+	for _, entryID := range entryIDs {
+		result, err := tx.Exec(`
+		DELETE FROM entry_tags
+		WHERE entry_id = ? AND tag_id = (SELECT id FROM tags WHERE token = ?)
+		`, entryID, token)
+		if err != nil {
+			return 0, fmt.Errorf("failed to untag entry %d: %w", entryID, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		untagged += int(rowsAffected)
+	}
+
+	if err := deleteUnusedTags(tx); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit tags: %w", err)
+	}
+
+	return untagged, nil
+}
+
+// insertTag inserts tag with an empty name, seals it and stores the encrypted name
+func insertTag(tx *sql.Tx, tag *Tag, seal func(tag *Tag) error) error {
+	result, err := tx.Exec(`INSERT INTO tags (token, encrypted_name) VALUES (?, X'')`, tag.Token)
+	if err != nil {
+		return fmt.Errorf("failed to create tag: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	tag.ID = int(id)
+
+	if err := seal(tag); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE tags SET encrypted_name = ? WHERE id = ?`, tag.EncryptedName, tag.ID); err != nil {
+		return fmt.Errorf("failed to save tag: %w", err)
+	}
+	return nil
+}
+
+// deleteUnusedTags deletes the tags no entry carries, including entries in the trash
+func deleteUnusedTags(tx *sql.Tx) error {
+	if _, err := tx.Exec(`DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM entry_tags)`); err != nil {
+		return fmt.Errorf("failed to delete unused tags: %w", err)
+	}
+	return nil
+}
+
+// scanTags collects the id, token and encrypted name of every tag
+func scanTags(tx *sql.Tx) ([]*Tag, error) {
+	rows, err := tx.Query(`SELECT id, token, encrypted_name FROM tags ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []*Tag
+	for rows.Next() {
+		tag := &Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Token, &tag.EncryptedName); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return tags, nil
+}
+
+// rewriteTags passes the encrypted tag names through rewrite and updates the tags
+// that changed. Tags belong to no entry, their names are bound to entry ID 0.
+func rewriteTags(tx *sql.Tx, rewrite func(entryID int, field string, ciphertext []byte) ([]byte, error)) (int, error) {
+	tags, err := scanTags(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, tag := range tags {
+		rewritten, err := rewrite(0, tag.NameBinding(), tag.EncryptedName)
+		if err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt tag %d: %w", tag.ID, err)
+		}
+		if bytes.Equal(rewritten, tag.EncryptedName) {
+			continue
+		}
+
+		if _, err := tx.Exec(`UPDATE tags SET encrypted_name = ? WHERE id = ?`, rewritten, tag.ID); err != nil {
+			return 0, fmt.Errorf("failed to update tag %d: %w", tag.ID, err)
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+// reindexTags replaces the token of every tag with the one returned by token
+func reindexTags(tx *sql.Tx, token func(tag *Tag) ([]byte, error)) error {
+	tags, err := scanTags(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		newToken, err := token(tag)
+		if err != nil {
+			return fmt.Errorf("failed to index tag %d: %w", tag.ID, err)
+		}
+		if _, err := tx.Exec(`UPDATE tags SET token = ? WHERE id = ?`, newToken, tag.ID); err != nil {
+			return fmt.Errorf("failed to update tag %d: %w", tag.ID, err)
+		}
+	}
+
+	return nil
+}
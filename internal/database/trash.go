@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DefaultTrashRetentionDays is how long deleted entries stay in the trash unless
+// the retention was changed with SetTrashRetentionDays
+const DefaultTrashRetentionDays = 30
+
+// GetTrashedEntries returns the entries in the trash, most recently deleted first
+func (db *DB) GetTrashedEntries() ([]*PasswordEntry, error) {
+	query := `SELECT ` + entryColumns + ` FROM password_entries
+	WHERE deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id DESC`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trashed entries: %w", err)
+	}
+
+	return scanPasswordEntries(rows)
+}
+
+// RestorePasswordEntry moves an entry out of the trash
+func (db *DB) RestorePasswordEntry(id int) error {
+	result, err := db.conn.Exec(`UPDATE password_entries SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to restore password entry: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("entry %d is not in the trash", id)
+	}
+
+	return nil
+}
+
+// PurgeTrash permanently deletes the trashed entries that were deleted at or
+// before cutoff, together with their custom fields, tags, search tokens and password history,
+// and returns how many were purged. A zero cutoff empties the whole trash.
+func (db *DB) PurgeTrash(cutoff time.Time) (int, error) {
+	// Purged credentials must not linger in free pages
+	if _, err := db.conn.Exec(`PRAGMA secure_delete = ON`); err != nil {
+		return 0, fmt.Errorf("failed to enable secure delete: %w", err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	trashed := `SELECT id FROM password_entries WHERE deleted_at IS NOT NULL`
+	var args []any
+	if !cutoff.IsZero() {
+		// Compared as times, the column holds timestamps in different time zones
+		trashed += ` AND julianday(deleted_at) <= julianday(?)`
+		args = append(args, cutoff)
+	}
+
+	for _, table := range []string{"custom_fields", "entry_tags", "search_tokens", "password_history"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE entry_id IN (`+trashed+`)`, args...); err != nil {
+			return 0, fmt.Errorf("failed to purge %s: %w", table, err)
+		}
+	}
+	if err := db.deleteFullText(tx, trashed, args...); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM password_entries WHERE id IN (`+trashed+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %w", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if err := deleteUnusedTags(tx); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit purge: %w", err)
+	}
+
+	return int(purged), nil
+}
+
+// TrashRetentionDays returns after how many days trashed entries are purged, 0
+// keeps them until the trash is emptied by hand
+func (db *DB) TrashRetentionDays() (int, error) {
+	var value string
+	err := db.conn.QueryRow(`SELECT value FROM vault_meta WHERE key = 'trash_retention_days'`).Scan(&value)
+	if err == sql.ErrNoRows {
+		return DefaultTrashRetentionDays, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get trash retention: %w", err)
+	}
+
+	return strconv.Atoi(value)
+}
+
+// SetTrashRetentionDays changes after how many days trashed entries are purged
+func (db *DB) SetTrashRetentionDays(days int) error {
+	if days < 0 {
+		return fmt.Errorf("trash retention cannot be negative")
+	}
+
+	_, err := db.conn.Exec(`
+	INSERT INTO vault_meta (key, value) VALUES ('trash_retention_days', ?)
+	ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, strconv.Itoa(days))
+	if err != nil {
+		return fmt.Errorf("failed to record trash retention: %w", err)
+	}
+
+	return nil
+}
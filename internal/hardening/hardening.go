@@ -0,0 +1,58 @@
+// Package hardening applies operating system protections that keep the vault
+// key out of core dumps, swap and the reach of debuggers
+package hardening
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Protection is the outcome of applying one protection
+type Protection struct {
+	Name string
+	Err  error // nil when the protection is active
+}
+
+// Active reports whether the protection was applied
+func (p Protection) Active() bool {
+	return p.Err == nil
+}
+
+// String returns a human readable status of the protection
+func (p Protection) String() string {
+	if p.Active() {
+		return fmt.Sprintf("%s: active", p.Name)
+	}
+	return fmt.Sprintf("%s: inactive (%v)", p.Name, p.Err)
+}
+
+// Report lists the protections applied at startup
+type Report struct {
+	Protections []Protection
+}
+
+// Apply applies every protection supported by the platform. It never fails,
+// protections that could not be applied are recorded in the report instead.
+func Apply() *Report {
+	return &Report{Protections: applyPlatform()}
+}
+
+// Warnings returns the protections that could not be applied
+func (r *Report) Warnings() []Protection {
+	var warnings []Protection
+	for _, protection := range r.Protections {
+		if !protection.Active() {
+			warnings = append(warnings, protection)
+		}
+	}
+	return warnings
+}
+
+// String returns the status of every protection
+func (r *Report) String() string {
+	statuses := make([]string, len(r.Protections))
+	for i, protection := range r.Protections {
+		statuses[i] = protection.String()
+	}
+	return strings.Join(statuses, "; ")
+}
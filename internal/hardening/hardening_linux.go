@@ -0,0 +1,55 @@
+//go:build linux
+
+package hardening
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// applyPlatform disables core dumps and ptrace attachment and locks the
+// process memory so it is never swapped
+func applyPlatform() []Protection {
+	return []Protection{
+		{Name: "no ptrace or core dumps (PR_SET_DUMPABLE=0)", Err: setNotDumpable()},
+		{Name: "core dump size limit (RLIMIT_CORE=0)", Err: disableCoreDumps()},
+		{Name: "memory locked (mlockall)", Err: lockAllMemory()},
+	}
+}
+
+// setNotDumpable stops the kernel from writing core dumps and keeps other
+// processes of the same user from attaching with ptrace or reading /proc/pid/mem
+func setNotDumpable() error {
+	if err := unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl failed: %w", err)
+	}
+	return nil
+}
+
+// disableCoreDumps sets the core dump size limit to zero, which also covers
+// crashes after the dumpable flag was reset by an exec
+func disableCoreDumps() error {
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{Cur: 0, Max: 0}); err != nil {
+		return fmt.Errorf("setrlimit failed: %w", err)
+	}
+	return nil
+}
+
+// lockAllMemory locks current and future mappings. With MCL_FUTURE every later
+// allocation has to fit in RLIMIT_MEMLOCK or the Go runtime aborts, so memory is
+// only locked when the limit is unlimited.
+func lockAllMemory() error {
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &limit); err != nil {
+		return fmt.Errorf("getrlimit failed: %w", err)
+	}
+	if limit.Cur != unix.RLIM_INFINITY {
+		return fmt.Errorf("RLIMIT_MEMLOCK is %d KiB, raise it to unlimited to lock all memory", limit.Cur/1024)
+	}
+
+	if err := unix.Mlockall(unix.MCL_CURRENT | unix.MCL_FUTURE); err != nil {
+		return fmt.Errorf("mlockall failed: %w", err)
+	}
+	return nil
+}
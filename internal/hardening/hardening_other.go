@@ -0,0 +1,19 @@
+//go:build !linux
+
+package hardening
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// applyPlatform reports the Linux protections as unavailable, secrets still
+// live in locked secure buffers where the platform supports them
+func applyPlatform() []Protection {
+	unsupported := fmt.Errorf("not supported on %s", runtime.GOOS)
+	return []Protection{
+		{Name: "no ptrace or core dumps (PR_SET_DUMPABLE=0)", Err: unsupported},
+		{Name: "core dump size limit (RLIMIT_CORE=0)", Err: unsupported},
+		{Name: "memory locked (mlockall)", Err: unsupported},
+	}
+}
@@ -0,0 +1,181 @@
+// Package legacy imports the master password config of builds that kept it in
+// the home directory into the XDG layout. Those builds already kept the database
+// at paths.Database(), only the config moves.
+package legacy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"svimpass/internal/paths"
+)
+
+// markerName records, in the config directory, which legacy files were copied
+// and still wait for the master password to verify them
+const markerName = "legacy-import"
+
+// Import is a legacy config copied into the XDG layout. The legacy file stays in
+// place until Finish has verified that it decrypts the database.
+type Import struct {
+	Sources    []string // legacy files that were copied
+	marker     string
+	archiveDir string
+}
+
+// Start copies the legacy config into appPaths when the XDG layout holds no config
+// yet and the database it protects exists. It returns the import waiting for
+// verification, which may have been started by an earlier run, or nil when there
+// is nothing to import.
+func Start(appPaths *paths.Paths) (*Import, error) {
+	imp := &Import{
+		marker:     filepath.Join(appPaths.ConfigDir, markerName),
+		archiveDir: appPaths.BackupDir(),
+	}
+
+	sources, err := readMarker(imp.marker)
+	if err != nil {
+		return nil, err
+	}
+	if sources != nil {
+		imp.Sources = sources
+		return imp, nil
+	}
+
+	legacyConfig, err := paths.LegacyConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	if !exists(legacyConfig) {
+		return nil, nil
+	}
+
+	if exists(appPaths.Config()) || exists(appPaths.ConfigCopy()) {
+		fmt.Printf("Warning: legacy config %s ignored, %s already holds a vault\n", legacyConfig, appPaths.ConfigDir)
+		return nil, nil
+	}
+
+	if !exists(appPaths.Database()) {
+		fmt.Printf("Warning: legacy config %s ignored, there is no database at %s\n", legacyConfig, appPaths.Database())
+		return nil, nil
+	}
+
+	if err := copyFile(legacyConfig, appPaths.Config()); err != nil {
+		return nil, fmt.Errorf("failed to copy legacy config: %w", err)
+	}
+	imp.Sources = append(imp.Sources, legacyConfig)
+
+	if err := os.WriteFile(imp.marker, []byte(strings.Join(imp.Sources, "\n")+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to record legacy import: %w", err)
+	}
+
+	fmt.Printf("Imported legacy config %s, it is archived after the next unlock\n", legacyConfig)
+	return imp, nil
+}
+
+// Finish runs verify against the imported vault and, if it passes, moves the
+// legacy files into a timestamped directory under the backup directory
+func (imp *Import) Finish(verify func() error) (string, error) {
+	if err := verify(); err != nil {
+		return "", fmt.Errorf("imported legacy config failed verification, the legacy config was kept: %w", err)
+	}
+
+	dir := filepath.Join(imp.archiveDir, "legacy-"+time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create legacy archive: %w", err)
+	}
+
+	for _, source := range imp.Sources {
+		if !exists(source) {
+			continue
+		}
+		if err := moveFile(source, filepath.Join(dir, strings.TrimPrefix(filepath.Base(source), "."))); err != nil {
+			return "", fmt.Errorf("failed to archive %s: %w", source, err)
+		}
+	}
+
+	if err := os.Remove(imp.marker); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to remove legacy import record: %w", err)
+	}
+
+	return dir, nil
+}
+
+// readMarker returns the legacy files of an unfinished import, nil when there is none
+func readMarker(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy import record: %w", err)
+	}
+	defer file.Close()
+
+	sources := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			sources = append(sources, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read legacy import record: %w", err)
+	}
+
+	return sources, nil
+}
+
+// copyFile copies src to a temporary file next to dest, syncs it and renames it
+// over dest, readable by the owner only
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+// moveFile renames src to dest, copying it when they are on different file systems
+func moveFile(src, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+	if err := copyFile(src, dest); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -8,6 +8,9 @@ import (
 
 const appName = "svimpass"
 
+// Master password config of builds that kept it in the home directory
+const legacyConfigName = ".password-manager-config"
+
 // Paths holds all application directory paths
 type Paths struct {
 	DataDir    string // ~/.local/share/svimpass
@@ -46,6 +49,12 @@ func (p *Paths) Config() string {
 	return filepath.Join(p.ConfigDir, "config.json")
 }
 
+// ConfigCopy returns the path to the copy of the config kept next to the database,
+// used to restore a damaged config file
+func (p *Paths) ConfigCopy() string {
+	return filepath.Join(p.DataDir, "config.copy.json")
+}
+
 // Socket returns the path to the Unix domain socket
 func (p *Paths) Socket() string {
 	return filepath.Join(p.RuntimeDir, "app.sock")
@@ -77,6 +86,15 @@ func (p *Paths) EnsureDirectories() error {
 	return nil
 }
 
+// LegacyConfig returns the master password config path of builds before the XDG layout
+func LegacyConfig() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, legacyConfigName), nil
+}
+
 // getXDGDataDir returns XDG_DATA_HOME/appName or ~/.local/share/appName
 func getXDGDataDir(homeDir string) string {
 	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
@@ -0,0 +1,390 @@
+// Package query parses the search language of the launcher: words, field
+// qualifiers such as user: or tag:, date qualifiers such as updated:>90d,
+// negation with - or NOT, alternatives with OR and saved queries recalled as @name
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"svimpass/internal/crypto"
+)
+
+// Fields a term can be qualified with. A term without a qualifier matches the
+// service name, the username or the notes.
+const (
+	FieldText    = ""
+	FieldService = "service"
+	FieldUser    = "user"
+	FieldNotes   = "notes"
+	FieldURL     = "url"
+	FieldTag     = "tag"
+	FieldType    = "type"
+	FieldCreated = "created"
+	FieldUpdated = "updated"
+)
+
+// qualifiers maps what users type before the colon to the field, unknown
+// prefixes such as https: are searched as text
+var qualifiers = map[string]string{
+	"service":  FieldService,
+	"user":     FieldUser,
+	"username": FieldUser,
+	"notes":    FieldNotes,
+	"url":      FieldURL,
+	"tag":      FieldTag,
+	"type":     FieldType,
+	"created":  FieldCreated,
+	"updated":  FieldUpdated,
+}
+
+var relativeDate = regexp.MustCompile(`^([0-9]+)([dwmy])$`)
+
+// Query is a parsed search, an entry matches when it matches any of the clauses.
+// A query without clauses matches every entry.
+type Query struct {
+	Clauses []Clause
+}
+
+// Clause is a conjunction, an entry matches when it matches every term
+type Clause struct {
+	Terms []Term
+}
+
+// Term is one condition of a clause. Date terms hold the bounds their value
+// resolved to, the entry date must be at or after After and before Before.
+type Term struct {
+	Field   string
+	Value   string
+	Negated bool
+	After   time.Time
+	Before  time.Time
+}
+
+// Entry is what terms are matched against, the decrypted fields of an entry
+type Entry struct {
+	Service  string
+	Username string
+	Notes    string
+	URL      string
+	Type     string
+	Tags     []string
+	Created  time.Time
+	Updated  time.Time
+}
+
+// Lookup returns the text of the saved query called name
+type Lookup func(name string) (string, error)
+
+// Parse parses input, resolving relative dates against now and @name through
+// lookup. Saved queries cannot refer to other saved queries, a nil lookup
+// rejects @name altogether.
+func Parse(input string, now time.Time, lookup Lookup) (Query, error) {
+	words, err := split(input)
+	if err != nil {
+		return Query{}, err
+	}
+
+	var query Query
+	current := []Clause{{}}
+	negated := false
+
+	flush := func() {
+		for _, clause := range current {
+			if len(clause.Terms) > 0 {
+				query.Clauses = append(query.Clauses, clause)
+			}
+		}
+		current = []Clause{{}}
+	}
+
+	for _, word := range words {
+		switch {
+		case word.text == "":
+			continue
+		case !word.quoted && (word.text == "OR" || word.text == "|"):
+			if negated {
+				return Query{}, fmt.Errorf("NOT must be followed by a term")
+			}
+			flush()
+			continue
+		case !word.quoted && word.text == "NOT":
+			negated = !negated
+			continue
+		}
+
+		text := word.text
+		if !word.quoted && len(text) > 1 && strings.HasPrefix(text, "-") {
+			negated = !negated
+			text = text[1:]
+		}
+
+		if !word.quoted && len(text) > 1 && strings.HasPrefix(text, "@") {
+			if negated {
+				return Query{}, fmt.Errorf("saved queries cannot be negated")
+			}
+			saved, err := expand(text[1:], now, lookup)
+			if err != nil {
+				return Query{}, err
+			}
+			current = and(current, saved.Clauses)
+			continue
+		}
+
+		term, err := parseTerm(text, word.quoted, now)
+		if err != nil {
+			return Query{}, err
+		}
+		term.Negated = negated
+		negated = false
+
+		for i := range current {
+			current[i].Terms = append(current[i].Terms, term)
+		}
+	}
+
+	if negated {
+		return Query{}, fmt.Errorf("NOT must be followed by a term")
+	}
+	flush()
+
+	return query, nil
+}
+
+// Matches reports whether entry matches q
+func (q Query) Matches(entry Entry) bool {
+	if len(q.Clauses) == 0 {
+		return true
+	}
+	for _, clause := range q.Clauses {
+		if clause.Matches(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether entry matches every term of c
+func (c Clause) Matches(entry Entry) bool {
+	for _, term := range c.Terms {
+		if !term.Matches(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether entry matches t, taking negation into account
+func (t Term) Matches(entry Entry) bool {
+	return t.matches(entry) != t.Negated
+}
+
+func (t Term) matches(entry Entry) bool {
+	switch t.Field {
+	case FieldService:
+		return contains(entry.Service, t.Value)
+	case FieldUser:
+		return contains(entry.Username, t.Value)
+	case FieldNotes:
+		return contains(entry.Notes, t.Value)
+	case FieldURL:
+		return contains(entry.URL, t.Value)
+	case FieldTag:
+		for _, tag := range entry.Tags {
+			if crypto.NormalizeSearchText(tag) == crypto.NormalizeSearchText(t.Value) {
+				return true
+			}
+		}
+		return false
+	case FieldType:
+		return strings.EqualFold(entry.Type, t.Value)
+	case FieldCreated:
+		return t.InRange(entry.Created)
+	case FieldUpdated:
+		return t.InRange(entry.Updated)
+	}
+	return contains(entry.Service, t.Value) || contains(entry.Username, t.Value) || contains(entry.Notes, t.Value)
+}
+
+// InRange reports whether date lies within the bounds of a date term
+func (t Term) InRange(date time.Time) bool {
+	return (t.After.IsZero() || !date.Before(t.After)) && (t.Before.IsZero() || date.Before(t.Before))
+}
+
+// IsDate reports whether t is a created: or updated: term
+func (t Term) IsDate() bool {
+	return t.Field == FieldCreated || t.Field == FieldUpdated
+}
+
+// word is a piece of the input, quoted words are always searched as text
+type word struct {
+	text   string
+	quoted bool
+}
+
+// split cuts input at whitespace outside of double quotes. A quoted value after
+// a qualifier, as in notes:"two words", stays part of its word.
+func split(input string) ([]word, error) {
+	var words []word
+	var current strings.Builder
+	inQuotes, quoted, started := false, false, false
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			quoted = quoted || current.Len() == 0
+			started = true
+		case !inQuotes && (r == ' ' || r == '\t' || r == '\n'):
+			if started {
+				words = append(words, word{text: current.String(), quoted: quoted})
+			}
+			current.Reset()
+			quoted, started = false, false
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if started {
+		words = append(words, word{text: current.String(), quoted: quoted})
+	}
+
+	return words, nil
+}
+
+// parseTerm reads a single term, qualified or not
+func parseTerm(text string, quoted bool, now time.Time) (Term, error) {
+	if !quoted && len(text) > 1 && strings.HasPrefix(text, "#") {
+		return Term{Field: FieldTag, Value: text[1:]}, nil
+	}
+
+	prefix, value, ok := strings.Cut(text, ":")
+	field, known := qualifiers[strings.ToLower(prefix)]
+	if quoted || !ok || !known {
+		return Term{Field: FieldText, Value: text}, nil
+	}
+
+	term := Term{Field: field, Value: strings.TrimPrefix(value, "#")}
+	if term.Value == "" {
+		return Term{}, fmt.Errorf("%s: needs a value", prefix)
+	}
+	if term.IsDate() {
+		if err := term.parseDate(now); err != nil {
+			return Term{}, fmt.Errorf("%s: %w", prefix, err)
+		}
+	}
+
+	return term, nil
+}
+
+// parseDate resolves the value of a date term into its bounds. Relative values
+// count back from now, so updated:>90d is more than 90 days ago and created:<2w
+// less than two weeks ago; absolute values are whole days in now's location.
+func (t *Term) parseDate(now time.Time) error {
+	op := ""
+	for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(t.Value, candidate) {
+			op = candidate
+			break
+		}
+	}
+	value := strings.TrimPrefix(t.Value, op)
+
+	if m := relativeDate.FindStringSubmatch(value); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return fmt.Errorf("invalid age %q", value)
+		}
+
+		var cutoff time.Time
+		switch m[2] {
+		case "d":
+			cutoff = now.AddDate(0, 0, -n)
+		case "w":
+			cutoff = now.AddDate(0, 0, -7*n)
+		case "m":
+			cutoff = now.AddDate(0, -n, 0)
+		case "y":
+			cutoff = now.AddDate(-n, 0, 0)
+		}
+
+		switch op {
+		case ">", ">=":
+			t.Before = cutoff
+		case "<", "<=":
+			t.After = cutoff
+		default:
+			return fmt.Errorf("ages need < or >, as in >%s for older than %s", value, value)
+		}
+		return nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, now.Location())
+	if err != nil {
+		return fmt.Errorf("expected a date like 2024-01-31 or an age like 90d, 6m or 1y")
+	}
+	next := day.AddDate(0, 0, 1)
+
+	switch op {
+	case ">":
+		t.After = next
+	case ">=":
+		t.After = day
+	case "<":
+		t.Before = day
+	case "<=":
+		t.Before = next
+	default:
+		t.After, t.Before = day, next
+	}
+	return nil
+}
+
+// expand parses the saved query called name
+func expand(name string, now time.Time, lookup Lookup) (Query, error) {
+	if lookup == nil {
+		return Query{}, fmt.Errorf("saved queries cannot refer to other saved queries")
+	}
+
+	text, err := lookup(name)
+	if err != nil {
+		return Query{}, err
+	}
+
+	saved, err := Parse(text, now, nil)
+	if err != nil {
+		return Query{}, fmt.Errorf("saved query @%s: %w", name, err)
+	}
+	return saved, nil
+}
+
+// and returns the clauses matching both sides, the terms of every clause of
+// left combined with those of every clause of right
+func and(left, right []Clause) []Clause {
+	if len(right) == 0 {
+		return left
+	}
+
+	combined := make([]Clause, 0, len(left)*len(right))
+	for _, l := range left {
+		for _, r := range right {
+			terms := make([]Term, 0, len(l.Terms)+len(r.Terms))
+			terms = append(terms, l.Terms...)
+			terms = append(terms, r.Terms...)
+			combined = append(combined, Clause{Terms: terms})
+		}
+	}
+	return combined
+}
+
+// contains reports whether value appears in text, ignoring case and accents
+func contains(text, value string) bool {
+	return strings.Contains(crypto.FoldText(text), crypto.FoldText(value))
+}
@@ -0,0 +1,116 @@
+// Package recoverykit writes the printable emergency sheet holding the recovery key
+package recoverykit
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"svimpass/internal/crypto"
+)
+
+// Kit is the content of an emergency sheet
+type Kit struct {
+	RecoveryKey  string // space separated recovery words
+	DatabasePath string
+	ConfigPath   string
+	BackupDir    string
+	CreatedAt    time.Time
+}
+
+// Words returns the recovery words numbered from 1, so they can be copied back in order
+func (k Kit) Words() []string {
+	words := strings.Fields(k.RecoveryKey)
+	for i, word := range words {
+		words[i] = fmt.Sprintf("%2d. %s", i+1, word)
+	}
+	return words
+}
+
+const textSheet = `svimpass emergency kit
+======================
+
+Created: {{.CreatedAt.Format "2006-01-02 15:04"}}
+
+Recovery key
+------------
+{{range .Words}}{{.}}
+{{end}}
+Anyone holding these words can open your vault. Print this sheet, store it
+somewhere safe and delete the file.
+
+If you forget the master password, press Tab on the login screen,
+enter the words in order and set a new master password. The recovery key is
+revoked once it has been used, create a new kit with :recovery-kit afterwards.
+
+Vault location
+--------------
+Database: {{.DatabasePath}}
+Config:   {{.ConfigPath}}
+Backups:  {{.BackupDir}}
+
+Both the database and the config file are needed to restore the vault.
+`
+
+const htmlSheet = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>svimpass emergency kit</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; }
+ol { columns: 3; font-family: monospace; font-size: 1.2em; }
+code { word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>svimpass emergency kit</h1>
+<p>Created: {{.CreatedAt.Format "2006-01-02 15:04"}}</p>
+<h2>Recovery key</h2>
+<ol>{{range (.RecoveryKey | words)}}<li>{{.}}</li>{{end}}</ol>
+<p>Anyone holding these words can open your vault. Print this sheet, store it
+somewhere safe and delete the file.</p>
+<p>If you forget the master password, press Tab on the login screen,
+enter the words in order and set a new master password. The recovery key is
+revoked once it has been used, create a new kit with <code>:recovery-kit</code> afterwards.</p>
+<h2>Vault location</h2>
+<ul>
+<li>Database: <code>{{.DatabasePath}}</code></li>
+<li>Config: <code>{{.ConfigPath}}</code></li>
+<li>Backups: <code>{{.BackupDir}}</code></li>
+</ul>
+<p>Both the database and the config file are needed to restore the vault.</p>
+</body>
+</html>
+`
+
+// Write renders kit as HTML when path ends in .html or .htm and as plain text
+// otherwise, readable by the owner only
+func Write(path string, kit Kit) error {
+	var buf bytes.Buffer
+	defer func() { crypto.Wipe(buf.Bytes()) }()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		tmpl := htmltemplate.Must(htmltemplate.New("kit").Funcs(htmltemplate.FuncMap{"words": strings.Fields}).Parse(htmlSheet))
+		if err := tmpl.Execute(&buf, kit); err != nil {
+			return fmt.Errorf("failed to render recovery kit: %w", err)
+		}
+	default:
+		tmpl := texttemplate.Must(texttemplate.New("kit").Parse(textSheet))
+		if err := tmpl.Execute(&buf, kit); err != nil {
+			return fmt.Errorf("failed to render recovery kit: %w", err)
+		}
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write recovery kit: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package recoverykit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	texttemplate "text/template"
+	"time"
+
+	"svimpass/internal/crypto"
+)
+
+// ShareSheet is the content of the sheet handed to one holder of a key share
+type ShareSheet struct {
+	Share     string
+	Number    int
+	Count     int
+	Threshold int
+	CreatedAt time.Time
+}
+
+const shareSheet = `svimpass key share {{.Number}} of {{.Count}}
+=============================
+
+Created: {{.CreatedAt.Format "2006-01-02 15:04"}}
+
+{{.Share}}
+
+This share alone reveals nothing about the vault. Any {{.Threshold}} of the {{.Count}}
+shares together unlock it, so keep this one apart from the others.
+
+To recover the vault, press Tab on the login screen, paste {{.Threshold}} shares
+separated by spaces and set a new master password. The shares are revoked
+once they have been used, split the key again with :split-key afterwards.
+`
+
+// WriteShares writes one text sheet per share into dir, readable by the owner
+// only, and returns the paths written
+func WriteShares(dir string, shares []string, threshold int, createdAt time.Time) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create share directory: %w", err)
+	}
+
+	tmpl := texttemplate.Must(texttemplate.New("share").Parse(shareSheet))
+	written := make([]string, 0, len(shares))
+	for i, share := range shares {
+		sheet := ShareSheet{
+			Share:     share,
+			Number:    i + 1,
+			Count:     len(shares),
+			Threshold: threshold,
+			CreatedAt: createdAt,
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, sheet); err != nil {
+			return written, fmt.Errorf("failed to render share %d: %w", i+1, err)
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("svimpass-share-%d-of-%d.txt", i+1, len(shares)))
+		err := os.WriteFile(path, buf.Bytes(), 0o600)
+		crypto.Wipe(buf.Bytes())
+		if err != nil {
+			return written, fmt.Errorf("failed to write share %d: %w", i+1, err)
+		}
+		written = append(written, path)
+	}
+
+	return written, nil
+}
@@ -1,15 +1,34 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"svimpass/internal/crypto"
+	"svimpass/internal/strength"
 )
 
 type AuthService struct {
-	masterMgr *crypto.MasterPasswordManager
-	encKey    *crypto.EncryptionKey
-	unlocked  bool
+	masterMgr   *crypto.MasterPasswordManager
+	encKey      *crypto.EncryptionKey
+	unlocked    bool
+	unlockHooks []func(encKey *crypto.EncryptionKey) error
+	lockHooks   []func()
+	recovery    *pendingRecovery
+	stateMu     sync.Mutex   // guards encKey, unlocked and recovery against the auto-lock goroutines
+	keyMu       sync.RWMutex // held for reading while a vault key is in use, keys are only destroyed holding it
+	idleMu      sync.Mutex
+	idleTimer   *time.Timer // locks the vault when no activity resets it in time
+	idleGen     uint64      // generation of idleTimer, a fired timer of an older one does not lock
+}
+
+// pendingRecovery holds the vault key unwrapped with a recovery key or shares until a new
+// master password has been set, the app stays locked in the meantime
+type pendingRecovery struct {
+	slotID int
+	encKey *crypto.EncryptionKey
 }
 
 func NewAuthService(masterMgr *crypto.MasterPasswordManager) *AuthService {
@@ -26,19 +45,22 @@ func (as *AuthService) IsInitialized() bool {
 	return as.masterMgr.IsInitialized()
 }
 
-func (as *AuthService) SetupMasterPassword(password, confirmPassword string) error {
+// SetupMasterPassword creates the vault, optionally requiring the keyfile at keyfilePath
+func (as *AuthService) SetupMasterPassword(password, confirmPassword, keyfilePath string) error {
 	if password != confirmPassword {
 		return fmt.Errorf("passwords do not match")
 	}
 
-	encKey, err := as.masterMgr.SetupMasterPassword(password)
+	if err := as.requireStrength(password); err != nil {
+		return err
+	}
+
+	encKey, err := as.masterMgr.SetupMasterPassword(password, keyfilePath)
 	if err != nil {
 		return err
 	}
 
-	as.encKey = encKey
-	as.unlocked = true
-	return nil
+	return as.unlock(encKey)
 }
 
 func (as *AuthService) UnlockApp(password string) error {
@@ -47,23 +69,410 @@ func (as *AuthService) UnlockApp(password string) error {
 		return err
 	}
 
+	return as.unlock(encKey)
+}
+
+// UnlockWithPIN unlocks the app with the quick unlock PIN set after an earlier full unlock
+func (as *AuthService) UnlockWithPIN(pin string) error {
+	encKey, err := as.masterMgr.UnlockWithPIN(pin)
+	if err != nil {
+		return err
+	}
+
+	return as.unlock(encKey)
+}
+
+// EnableQuickUnlock lets pin unlock the app for window, the vault key is
+// re-wrapped in memory only and never written to disk
+func (as *AuthService) EnableQuickUnlock(pin string, window time.Duration) error {
+	encKey, release, err := as.AcquireKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return as.masterMgr.EnableQuickUnlock(encKey, pin, window)
+}
+
+// DisableQuickUnlock discards the PIN, the master password is required again
+func (as *AuthService) DisableQuickUnlock() {
+	as.masterMgr.DisableQuickUnlock()
+}
+
+// QuickUnlockExpiry returns when the PIN expires, the zero time when no PIN is set
+func (as *AuthService) QuickUnlockExpiry() time.Time {
+	if as.masterMgr == nil {
+		return time.Time{}
+	}
+	return as.masterMgr.QuickUnlockExpiry()
+}
+
+// CheckPasswordStrength rates a candidate master password against the configured minimum
+func (as *AuthService) CheckPasswordStrength(password string) PasswordStrengthResponse {
+	result := strength.Check(password)
+	minScore := as.masterMgr.MinStrength()
+	return PasswordStrengthResponse{
+		Score:      result.Score,
+		MaxScore:   strength.MaxScore,
+		MinScore:   minScore,
+		Acceptable: result.Acceptable(minScore),
+		Feedback:   result.Feedback,
+	}
+}
+
+// requireStrength rejects master passwords below the configured strength score
+func (as *AuthService) requireStrength(password string) error {
+	return strength.Require(password, as.masterMgr.MinStrength())
+}
+
+// MinStrength returns the strength score a new master password needs
+func (as *AuthService) MinStrength() int {
+	return as.masterMgr.MinStrength()
+}
+
+// SetMinStrength changes the strength score new master passwords need
+func (as *AuthService) SetMinStrength(score int) error {
+	if !as.IsUnlocked() {
+		return fmt.Errorf("app is locked")
+	}
+	return as.masterMgr.SetMinStrength(score)
+}
+
+// OnUnlock registers a hook that runs with the vault key every time the app is unlocked
+func (as *AuthService) OnUnlock(hook func(encKey *crypto.EncryptionKey) error) {
+	as.unlockHooks = append(as.unlockHooks, hook)
+}
+
+// OnLock registers a hook that runs every time the app is locked, before the vault key is
+// dropped. Hooks run while the key is held exclusively and must not acquire it.
+func (as *AuthService) OnLock(hook func()) {
+	as.lockHooks = append(as.lockHooks, hook)
+}
+
+// unlock stores the vault key and runs the unlock hooks, staying locked if one fails
+func (as *AuthService) unlock(encKey *crypto.EncryptionKey) error {
+	for _, hook := range as.unlockHooks {
+		if err := hook(encKey); err != nil {
+			as.LockApp()
+			encKey.Destroy()
+			return err
+		}
+	}
+
+	as.keyMu.Lock()
+	as.stateMu.Lock()
+	if as.encKey != nil && as.encKey != encKey {
+		as.encKey.Destroy()
+	}
 	as.encKey = encKey
 	as.unlocked = true
+	as.stateMu.Unlock()
+	as.keyMu.Unlock()
+
+	as.startIdleTimer()
 	return nil
 }
 
+// ChangeMasterPassword replaces the vault key and protects it with the new master
+// password only, returning the key slots that were removed. The app is locked once
+// the old password is verified, so nothing uses the old key while the entries are
+// re-encrypted, and the next unlock with the new password rebuilds the search index.
+func (as *AuthService) ChangeMasterPassword(oldPassword, newPassword, confirmPassword string) ([]crypto.KeySlot, error) {
+	if !as.IsUnlocked() {
+		return nil, fmt.Errorf("app is locked")
+	}
+
+	if newPassword != confirmPassword {
+		return nil, fmt.Errorf("passwords do not match")
+	}
+
+	if err := as.requireStrength(newPassword); err != nil {
+		return nil, err
+	}
+
+	as.keyMu.Lock()
+	removed, err := as.masterMgr.ChangeMasterPassword(oldPassword, newPassword, as.lockLocked)
+	as.keyMu.Unlock()
+
+	if !as.IsUnlocked() {
+		as.stopIdleTimer()
+	}
+	return removed, as.lockOnLockout(err)
+}
+
+// lockOnLockout locks the app when wrong passwords given while unlocked triggered
+// the lockout policy, so the session does not outlive a locked or wiped vault
+func (as *AuthService) lockOnLockout(err error) error {
+	if errors.Is(err, crypto.ErrLockedOut) || errors.Is(err, crypto.ErrVaultWiped) {
+		as.LockApp()
+	}
+	return err
+}
+
+// LockApp waits for the operations holding the vault key to release it, then runs
+// the lock hooks and wipes the key from memory
 func (as *AuthService) LockApp() {
+	as.stopIdleTimer()
+
+	as.keyMu.Lock()
+	defer as.keyMu.Unlock()
+	as.lockLocked()
+}
+
+// lockLocked does the work of LockApp, the caller holds keyMu exclusively
+func (as *AuthService) lockLocked() {
+	for _, hook := range as.lockHooks {
+		hook()
+	}
+
+	as.stateMu.Lock()
+	defer as.stateMu.Unlock()
+
 	if as.encKey != nil {
+		as.encKey.Destroy()
 		as.encKey = nil
 	}
+	as.setRecoveryLocked(nil)
 	as.unlocked = false
 }
 
 func (as *AuthService) IsUnlocked() bool {
+	as.stateMu.Lock()
+	defer as.stateMu.Unlock()
 	return as.unlocked
 }
 
-func (as *AuthService) GetEncryptionKey() *crypto.EncryptionKey {
-	return as.encKey
+// AcquireKey returns the vault key of the unlocked app, or an error while it is
+// locked. The key stays valid until release is called, locking the app waits for
+// it, so release must be called once the operation is done and before any call
+// that acquires the key again.
+func (as *AuthService) AcquireKey() (encKey *crypto.EncryptionKey, release func(), err error) {
+	as.keyMu.RLock()
+
+	as.stateMu.Lock()
+	encKey, unlocked := as.encKey, as.unlocked
+	as.stateMu.Unlock()
+
+	if !unlocked || encKey == nil {
+		as.keyMu.RUnlock()
+		return nil, nil, fmt.Errorf("app is locked")
+	}
+	return encKey, as.keyMu.RUnlock, nil
+}
+
+// RequiredKeyfile returns the keyfile the master password has to be combined with, if any
+func (as *AuthService) RequiredKeyfile() string {
+	if as.masterMgr == nil {
+		return ""
+	}
+	return as.masterMgr.RequiredKeyfile()
+}
+
+// KDFParams returns the key derivation parameters protecting the vault
+func (as *AuthService) KDFParams() crypto.KDFParams {
+	return as.masterMgr.KDFParams()
+}
+
+// UpdateKDFParams raises the key derivation parameters, re-encrypting the vault
+func (as *AuthService) UpdateKDFParams(password string, params crypto.KDFParams) error {
+	if !as.IsUnlocked() {
+		return fmt.Errorf("app is locked")
+	}
+
+	return as.lockOnLockout(as.masterMgr.UpdateKDFParams(password, params))
 }
 
+// UnlockWithRecoveryKey verifies a recovery key. The app only unlocks once a new
+// master password has been set with CompleteRecovery.
+func (as *AuthService) UnlockWithRecoveryKey(recoveryKey string) error {
+	slot, encKey, err := as.masterMgr.UnlockWithRecoveryKey(recoveryKey)
+	if err != nil {
+		return err
+	}
+
+	as.setRecovery(&pendingRecovery{slotID: slot.ID, encKey: encKey})
+	return nil
+}
+
+// UnlockWithShares rebuilds the unlock secret from Shamir shares made by SplitKey.
+// Like a recovery key, the app only unlocks once CompleteRecovery has set a new
+// master password, and the shares are revoked since they have been pooled.
+func (as *AuthService) UnlockWithShares(shares []string) error {
+	slot, encKey, err := as.masterMgr.UnlockWithShares(shares)
+	if err != nil {
+		return err
+	}
+
+	as.setRecovery(&pendingRecovery{slotID: slot.ID, encKey: encKey})
+	return nil
+}
+
+// RecoveryPending reports whether a recovery key was accepted and a new master password is required
+func (as *AuthService) RecoveryPending() bool {
+	return as.currentRecovery() != nil
+}
+
+// CompleteRecovery sets the new master password after UnlockWithRecoveryKey or
+// UnlockWithShares, revokes the used recovery slot and unlocks the app
+func (as *AuthService) CompleteRecovery(newPassword, confirmPassword string) error {
+	if newPassword != confirmPassword {
+		return fmt.Errorf("passwords do not match")
+	}
+
+	if err := as.requireStrength(newPassword); err != nil {
+		return err
+	}
+
+	// Hold the key so a lock cannot destroy it while the password slot is written
+	as.keyMu.RLock()
+	recovery := as.currentRecovery()
+	if recovery == nil {
+		as.keyMu.RUnlock()
+		return fmt.Errorf("no recovery in progress, enter the recovery key first")
+	}
+
+	if err := as.masterMgr.RecoverMasterPassword(recovery.encKey, recovery.slotID, newPassword); err != nil {
+		as.keyMu.RUnlock()
+		return err
+	}
+
+	// The key moves from the pending recovery to the unlocked app
+	as.stateMu.Lock()
+	if as.recovery == recovery {
+		as.recovery = nil
+	}
+	as.stateMu.Unlock()
+	as.keyMu.RUnlock()
+	return as.unlock(recovery.encKey)
+}
+
+// currentRecovery returns the recovery waiting for a new master password, if any
+func (as *AuthService) currentRecovery() *pendingRecovery {
+	as.stateMu.Lock()
+	defer as.stateMu.Unlock()
+	return as.recovery
+}
+
+// setRecovery replaces the pending recovery, dropping the vault key of the previous one
+func (as *AuthService) setRecovery(recovery *pendingRecovery) {
+	as.keyMu.Lock()
+	defer as.keyMu.Unlock()
+	as.stateMu.Lock()
+	defer as.stateMu.Unlock()
+	as.setRecoveryLocked(recovery)
+}
+
+func (as *AuthService) setRecoveryLocked(recovery *pendingRecovery) {
+	if as.recovery != nil {
+		as.recovery.encKey.Destroy()
+	}
+	as.recovery = recovery
+}
+
+// SplitKey splits a new unlock secret into count Shamir shares, any threshold of
+// which unlock the vault, revoking the shares of any earlier split
+func (as *AuthService) SplitKey(threshold, count int) ([]string, error) {
+	encKey, release, err := as.AcquireKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return as.masterMgr.SplitKey(encKey, threshold, count)
+}
+
+// LockoutPolicy returns the action taken after too many failed unlock attempts
+func (as *AuthService) LockoutPolicy() crypto.LockoutPolicy {
+	return as.masterMgr.LockoutPolicy()
+}
+
+// SetLockoutPolicy changes the action taken after too many failed unlock attempts
+func (as *AuthService) SetLockoutPolicy(policy crypto.LockoutPolicy) error {
+	if !as.IsUnlocked() {
+		return fmt.Errorf("app is locked")
+	}
+	return as.masterMgr.SetLockoutPolicy(policy)
+}
+
+// RegenerateRecoveryKey creates a new recovery key and revokes the previous ones
+func (as *AuthService) RegenerateRecoveryKey() (string, error) {
+	encKey, release, err := as.AcquireKey()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return as.masterMgr.RegenerateRecoveryKey(encKey)
+}
+
+// UnlockWithKeyfile unlocks the vault through a keyfile slot
+func (as *AuthService) UnlockWithKeyfile(path string) error {
+	encKey, err := as.masterMgr.UnlockWithKeyfile(path)
+	if err != nil {
+		return err
+	}
+
+	return as.unlock(encKey)
+}
+
+// KeySlots lists the key slots able to unlock the vault
+func (as *AuthService) KeySlots() ([]crypto.KeySlot, error) {
+	if !as.IsUnlocked() {
+		return nil, fmt.Errorf("app is locked")
+	}
+	return as.masterMgr.KeySlots(), nil
+}
+
+// AddPasswordKeySlot adds another password able to unlock the vault
+func (as *AuthService) AddPasswordKeySlot(password string) (crypto.KeySlot, error) {
+	if err := as.requireStrength(password); err != nil {
+		return crypto.KeySlot{}, err
+	}
+
+	encKey, release, err := as.AcquireKey()
+	if err != nil {
+		return crypto.KeySlot{}, err
+	}
+	defer release()
+	return as.masterMgr.AddPasswordSlot(encKey, password)
+}
+
+// AddRecoveryKeySlot generates a recovery key able to unlock the vault
+func (as *AuthService) AddRecoveryKeySlot() (string, error) {
+	encKey, release, err := as.AcquireKey()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return as.masterMgr.AddRecoverySlot(encKey)
+}
+
+// AddKeyfileKeySlot adds a keyfile able to unlock the vault
+func (as *AuthService) AddKeyfileKeySlot(path string) (crypto.KeySlot, error) {
+	encKey, release, err := as.AcquireKey()
+	if err != nil {
+		return crypto.KeySlot{}, err
+	}
+	defer release()
+	return as.masterMgr.AddKeyfileSlot(encKey, path)
+}
+
+// RemoveKeySlot removes a key slot, refusing to remove the last one
+func (as *AuthService) RemoveKeySlot(id int) error {
+	if !as.IsUnlocked() {
+		return fmt.Errorf("app is locked")
+	}
+	return as.masterMgr.RemoveKeySlot(id)
+}
+
+// Cipher returns the cipher new ciphertexts are encrypted with
+func (as *AuthService) Cipher() string {
+	return as.masterMgr.Cipher()
+}
+
+// SetCipher selects the cipher new ciphertexts are encrypted with
+func (as *AuthService) SetCipher(name string) error {
+	encKey, release, err := as.AcquireKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return as.masterMgr.SetCipher(encKey, name)
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"svimpass/internal/crypto"
+	"svimpass/internal/database"
+)
+
+// Blind index fields, searches match on any of them. Word tokens rank results
+// and are shared by every field, so a word scores wherever it occurs.
+const (
+	indexFieldService  = "service"
+	indexFieldUsername = "username"
+	indexFieldNotes    = "notes"
+	indexFieldWord     = "word"
+)
+
+// entryFields is the decrypted metadata of a password entry
+type entryFields struct {
+	ServiceName string
+	Username    string
+	Notes       string
+}
+
+// sealEntry encrypts the metadata of an entry, bound to its ID, and computes its search index
+func sealEntry(encKey *crypto.EncryptionKey, fields entryFields, entry *database.PasswordEntry) error {
+	var err error
+	if entry.EncryptedServiceName, err = encKey.EncryptField(fields.ServiceName, entry.ID, database.FieldServiceName); err != nil {
+		return fmt.Errorf("failed to encrypt service name: %w", err)
+	}
+	if entry.EncryptedUsername, err = encryptOptional(encKey, fields.Username, entry.ID, database.FieldUsername); err != nil {
+		return fmt.Errorf("failed to encrypt username: %w", err)
+	}
+	if entry.EncryptedNotes, err = encryptOptional(encKey, fields.Notes, entry.ID, database.FieldNotes); err != nil {
+		return fmt.Errorf("failed to encrypt notes: %w", err)
+	}
+
+	return indexEntry(encKey, fields, entry)
+}
+
+// openEntry decrypts the metadata of an entry
+func openEntry(encKey *crypto.EncryptionKey, entry *database.PasswordEntry) (entryFields, error) {
+	var fields entryFields
+	var err error
+	if fields.ServiceName, err = encKey.DecryptField(entry.EncryptedServiceName, entry.ID, database.FieldServiceName); err != nil {
+		return entryFields{}, fmt.Errorf("failed to decrypt service name of entry %d: %w", entry.ID, err)
+	}
+	if fields.Username, err = decryptOptional(encKey, entry.EncryptedUsername, entry.ID, database.FieldUsername); err != nil {
+		return entryFields{}, fmt.Errorf("failed to decrypt username of entry %d: %w", entry.ID, err)
+	}
+	if fields.Notes, err = decryptOptional(encKey, entry.EncryptedNotes, entry.ID, database.FieldNotes); err != nil {
+		return entryFields{}, fmt.Errorf("failed to decrypt notes of entry %d: %w", entry.ID, err)
+	}
+	return fields, nil
+}
+
+// sealPassword encrypts the password of an entry, bound to its ID. Entry types
+// without a secret store an empty password.
+func sealPassword(encKey *crypto.EncryptionKey, password string, entry *database.PasswordEntry) error {
+	if password == "" {
+		entry.EncryptedPassword = []byte{}
+		return nil
+	}
+
+	encryptedPassword, err := encKey.EncryptField(password, entry.ID, database.FieldPassword)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt password: %w", err)
+	}
+	entry.EncryptedPassword = encryptedPassword
+	return nil
+}
+
+// openPassword decrypts the password of an entry into a buffer the caller destroys,
+// nil when the entry has no password
+func openPassword(encKey *crypto.EncryptionKey, entry *database.PasswordEntry) (*crypto.SecureBuffer, error) {
+	if len(entry.EncryptedPassword) == 0 {
+		return nil, nil
+	}
+	return encKey.DecryptSecret(entry.EncryptedPassword, entry.ID, database.FieldPassword)
+}
+
+// indexEntry sets the blind index tokens and the full-text tokens of the searchable fields
+func indexEntry(encKey *crypto.EncryptionKey, fields entryFields, entry *database.PasswordEntry) error {
+	index, err := encKey.BlindIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Destroy()
+
+	entry.SearchTokens = index.Tokens(indexFieldService, fields.ServiceName)
+	entry.SearchTokens = append(entry.SearchTokens, index.Tokens(indexFieldUsername, fields.Username)...)
+	entry.SearchTokens = append(entry.SearchTokens, index.Tokens(indexFieldNotes, fields.Notes)...)
+
+	entry.FullText = database.FullTextTokens{
+		Service:  index.WordTokens(indexFieldWord, fields.ServiceName),
+		Username: index.WordTokens(indexFieldWord, fields.Username),
+		Notes:    index.WordTokens(indexFieldWord, fields.Notes),
+	}
+	return nil
+}
+
+// encryptOptional encrypts value, storing empty values as NULL
+func encryptOptional(encKey *crypto.EncryptionKey, value string, entryID int, field string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+	return encKey.EncryptField(value, entryID, field)
+}
+
+// decryptOptional decrypts a value written by encryptOptional
+func decryptOptional(encKey *crypto.EncryptionKey, ciphertext []byte, entryID int, field string) (string, error) {
+	if len(ciphertext) == 0 {
+		return "", nil
+	}
+	return encKey.DecryptField(ciphertext, entryID, field)
+}
+
+// sortEntries orders entries by service name and username, as the database
+// did when the metadata was stored in plaintext
+func sortEntries(entries []PasswordEntryResponse) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].ServiceName != entries[j].ServiceName {
+			return entries[i].ServiceName < entries[j].ServiceName
+		}
+		return entries[i].Username < entries[j].Username
+	})
+}
+
+// migrateMetadata runs on unlock: it encrypts the metadata of entries written
+// before metadata encryption and rebuilds the search index when it is missing
+func (ps *PasswordService) migrateMetadata(encKey *crypto.EncryptionKey) error {
+	migrated, err := ps.db.MigrateLegacyEntries(func(legacy *database.LegacyEntry) (*database.PasswordEntry, error) {
+		entry := &database.PasswordEntry{ID: legacy.ID}
+		fields := entryFields{
+			ServiceName: legacy.ServiceName,
+			Username:    legacy.Username,
+			Notes:       legacy.Notes,
+		}
+		if err := sealEntry(encKey, fields, entry); err != nil {
+			return nil, err
+		}
+		return entry, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encrypt entry metadata: %w", err)
+	}
+	if migrated > 0 {
+		fmt.Printf("Encrypted the metadata of %d password entries\n", migrated)
+	}
+
+	version, err := ps.db.SearchIndexVersion()
+	if err != nil {
+		return err
+	}
+	if version == crypto.BlindIndexVersion {
+		return nil
+	}
+
+	return ps.db.RebuildSearchIndex(crypto.BlindIndexVersion, func(entry *database.PasswordEntry) error {
+		fields, err := openEntry(encKey, entry)
+		if err != nil {
+			return err
+		}
+		return indexEntry(encKey, fields, entry)
+	}, func(tag *database.Tag) ([]byte, error) {
+		name, err := openTag(encKey, tag)
+		if err != nil {
+			return nil, err
+		}
+		return tagToken(encKey, name)
+	})
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Entry types. The type decides which fields an entry needs and what its
+// password column holds: the password, the text of a note, a card number or a token.
+const (
+	EntryTypeLogin    = "login"
+	EntryTypeNote     = "note"
+	EntryTypeCard     = "card"
+	EntryTypeIdentity = "identity"
+	EntryTypeToken    = "token"
+)
+
+// fieldRule says whether an entry type needs, allows or refuses a core field
+type fieldRule int
+
+const (
+	fieldOptional fieldRule = iota
+	fieldRequired
+	fieldForbidden
+)
+
+// typedField is a custom field defined by an entry type
+type typedField struct {
+	Name      string
+	Concealed bool
+	Required  bool
+	Validate  func(value string) error
+}
+
+// entrySchema defines an entry type
+type entrySchema struct {
+	Type           string
+	Username       fieldRule
+	UsernameLabel  string
+	Secret         fieldRule
+	SecretLabel    string
+	ValidateSecret func(secret string) error
+	Fields         []typedField
+	// AddLayout lists, in order, what the ;-separated parts of :add type:... hold:
+	// service, username, secret, notes or the name of a typed field
+	AddLayout []string
+	// Summary describes the entry in search results from its username and plain field values
+	Summary func(username string, fields map[string]string) string
+}
+
+var (
+	expiryPattern = regexp.MustCompile(`^(0[1-9]|1[0-2])/([0-9]{2}|[0-9]{4})$`)
+	cvvPattern    = regexp.MustCompile(`^[0-9]{3,4}$`)
+)
+
+var entrySchemas = map[string]*entrySchema{
+	EntryTypeLogin: {
+		Type:          EntryTypeLogin,
+		Username:      fieldRequired,
+		UsernameLabel: "username",
+		Secret:        fieldRequired,
+		SecretLabel:   "password",
+		Fields: []typedField{
+			{Name: "url"},
+		},
+		AddLayout: []string{"service", "username", "notes"},
+		Summary: func(username string, fields map[string]string) string {
+			return username
+		},
+	},
+	EntryTypeNote: {
+		Type:        EntryTypeNote,
+		Username:    fieldForbidden,
+		Secret:      fieldRequired,
+		SecretLabel: "note text",
+		AddLayout:   []string{"service", "secret"},
+		Summary: func(username string, fields map[string]string) string {
+			return "Secure note"
+		},
+	},
+	EntryTypeCard: {
+		Type:           EntryTypeCard,
+		Username:       fieldOptional,
+		UsernameLabel:  "cardholder",
+		Secret:         fieldRequired,
+		SecretLabel:    "card number",
+		ValidateSecret: validateCardNumber,
+		Fields: []typedField{
+			{Name: "expiry", Required: true, Validate: matching(expiryPattern, "MM/YY")},
+			{Name: "cvv", Concealed: true, Validate: matching(cvvPattern, "3 or 4 digits")},
+		},
+		AddLayout: []string{"service", "username", "expiry", "cvv"},
+		Summary: func(username string, fields map[string]string) string {
+			return joinSummary("Card", username, "expires "+fields["expiry"])
+		},
+	},
+	EntryTypeIdentity: {
+		Type:          EntryTypeIdentity,
+		Username:      fieldOptional,
+		UsernameLabel: "username",
+		Secret:        fieldForbidden,
+		Fields: []typedField{
+			{Name: "name", Required: true},
+			{Name: "email", Validate: validateEmail},
+			{Name: "phone"},
+			{Name: "address"},
+		},
+		AddLayout: []string{"service", "name", "email", "phone", "address"},
+		Summary: func(username string, fields map[string]string) string {
+			return joinSummary(fields["name"], fields["email"])
+		},
+	},
+	EntryTypeToken: {
+		Type:          EntryTypeToken,
+		Username:      fieldOptional,
+		UsernameLabel: "key id",
+		Secret:        fieldRequired,
+		SecretLabel:   "token",
+		Fields: []typedField{
+			{Name: "expires", Validate: validateDate},
+		},
+		AddLayout: []string{"service", "username", "expires", "notes"},
+		Summary: func(username string, fields map[string]string) string {
+			expires := ""
+			if fields["expires"] != "" {
+				expires = "expires " + fields["expires"]
+			}
+			return joinSummary("API token", username, expires)
+		},
+	},
+}
+
+// EntryTypes lists the entry types
+func EntryTypes() []string {
+	return []string{EntryTypeLogin, EntryTypeNote, EntryTypeCard, EntryTypeIdentity, EntryTypeToken}
+}
+
+// schemaFor returns the schema of an entry type, an empty type being a login
+func schemaFor(entryType string) (*entrySchema, error) {
+	if entryType == "" {
+		entryType = EntryTypeLogin
+	}
+	schema, ok := entrySchemas[strings.ToLower(entryType)]
+	if !ok {
+		return nil, fmt.Errorf("unknown entry type %q, use one of %s", entryType, strings.Join(EntryTypes(), ", "))
+	}
+	return schema, nil
+}
+
+// validateCore checks the fields every entry has against the rules of the type
+func (s *entrySchema) validateCore(serviceName, username string, hasSecret bool) error {
+	if serviceName == "" {
+		return fmt.Errorf("service name is required")
+	}
+
+	switch {
+	case s.Username == fieldRequired && username == "":
+		return fmt.Errorf("%s is required for %s entries", s.UsernameLabel, s.Type)
+	case s.Username == fieldForbidden && username != "":
+		return fmt.Errorf("%s entries have no username", s.Type)
+	case s.Secret == fieldRequired && !hasSecret:
+		return fmt.Errorf("%s is required for %s entries", s.SecretLabel, s.Type)
+	case s.Secret == fieldForbidden && hasSecret:
+		return fmt.Errorf("%s entries have no password", s.Type)
+	}
+
+	return nil
+}
+
+// validateSecret checks a new secret of an entry of this type
+func (s *entrySchema) validateSecret(secret string) error {
+	if secret == "" || s.ValidateSecret == nil {
+		return nil
+	}
+	return s.ValidateSecret(secret)
+}
+
+// typedField returns the field of this type called name, nil when the type
+// defines no such field
+func (s *entrySchema) typedField(name string) *typedField {
+	for i := range s.Fields {
+		if strings.EqualFold(s.Fields[i].Name, name) {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+// checkField validates a custom field of an entry of this type. Fields the type
+// defines take its spelling and concealment.
+func (s *entrySchema) checkField(field CustomField) (CustomField, error) {
+	if err := validateCustomField(field); err != nil {
+		return field, err
+	}
+
+	spec := s.typedField(field.Name)
+	if spec == nil {
+		return field, nil
+	}
+
+	field.Name = spec.Name
+	field.Concealed = spec.Concealed
+	if spec.Required && field.Value == "" {
+		return field, fmt.Errorf("%s is required for %s entries", spec.Name, s.Type)
+	}
+	if field.Value != "" && spec.Validate != nil {
+		if err := spec.Validate(field.Value); err != nil {
+			return field, fmt.Errorf("invalid %s: %w", spec.Name, err)
+		}
+	}
+	return field, nil
+}
+
+// checkFields validates the custom fields of a new entry of this type
+func (s *entrySchema) checkFields(fields []CustomField) ([]CustomField, error) {
+	checked := make([]CustomField, 0, len(fields))
+	for _, field := range fields {
+		field, err := s.checkField(field)
+		if err != nil {
+			return nil, err
+		}
+		checked = append(checked, field)
+	}
+	if err := validateCustomFields(checked); err != nil {
+		return nil, err
+	}
+
+	for _, spec := range s.Fields {
+		if !spec.Required {
+			continue
+		}
+		found := false
+		for _, field := range checked {
+			found = found || field.Name == spec.Name
+		}
+		if !found {
+			return nil, fmt.Errorf("%s is required for %s entries", spec.Name, s.Type)
+		}
+	}
+
+	return checked, nil
+}
+
+// summarize describes an entry in search results
+func (s *entrySchema) summarize(response PasswordEntryResponse) string {
+	values := make(map[string]string, len(response.Fields))
+	for _, field := range response.Fields {
+		if !field.Concealed {
+			values[strings.ToLower(field.Name)] = field.Value
+		}
+	}
+	return s.Summary(response.Username, values)
+}
+
+// CheckNewEntry validates req against its entry type, normalizing the type and
+// the typed fields. It returns what the secret of the entry is called when the
+// type needs one and req has none yet, so it can be asked for.
+func CheckNewEntry(req *CreatePasswordRequest) (string, error) {
+	schema, err := schemaFor(req.Type)
+	if err != nil {
+		return "", err
+	}
+	req.Type = schema.Type
+
+	for i := range req.Fields {
+		req.Fields[i].Name = strings.TrimSpace(req.Fields[i].Name)
+	}
+	if req.Fields, err = schema.checkFields(req.Fields); err != nil {
+		return "", err
+	}
+
+	missingSecret := schema.Secret == fieldRequired && req.Password == ""
+	if err := schema.validateCore(req.ServiceName, req.Username, req.Password != "" || missingSecret); err != nil {
+		return "", err
+	}
+	if err := schema.validateSecret(req.Password); err != nil {
+		return "", err
+	}
+
+	if missingSecret {
+		return schema.SecretLabel, nil
+	}
+	return "", nil
+}
+
+// ParseNewEntry reads the arguments of :add, an optional type prefix such as
+// card: followed by the ;-separated parts of the type's layout
+func ParseNewEntry(args string) (CreatePasswordRequest, error) {
+	req := CreatePasswordRequest{Type: EntryTypeLogin}
+
+	if prefix, rest, ok := strings.Cut(args, ":"); ok && !strings.ContainsAny(prefix, "; ") {
+		if _, err := schemaFor(prefix); err == nil {
+			req.Type = strings.ToLower(prefix)
+			args = rest
+		}
+	}
+	schema, _ := schemaFor(req.Type)
+
+	parts := strings.Split(args, ";")
+	if len(parts) > len(schema.AddLayout) {
+		return req, fmt.Errorf("usage: :add %s", AddUsage(req.Type))
+	}
+
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		switch slot := schema.AddLayout[i]; slot {
+		case "service":
+			req.ServiceName = part
+		case "username":
+			req.Username = part
+		case "secret":
+			req.Password = part
+		case "notes":
+			req.Notes = part
+		default:
+			if part != "" {
+				req.Fields = append(req.Fields, CustomField{Name: slot, Value: part})
+			}
+		}
+	}
+
+	return req, nil
+}
+
+// AddUsage describes the :add syntax of an entry type
+func AddUsage(entryType string) string {
+	schema, err := schemaFor(entryType)
+	if err != nil {
+		return ""
+	}
+
+	slots := make([]string, 0, len(schema.AddLayout))
+	for _, slot := range schema.AddLayout {
+		switch slot {
+		case "username":
+			slot = schema.UsernameLabel
+		case "secret":
+			slot = schema.SecretLabel
+		}
+		slots = append(slots, slot)
+	}
+
+	usage := strings.Join(slots, ";")
+	if schema.Type != EntryTypeLogin {
+		usage = schema.Type + ":" + usage
+	}
+	return usage
+}
+
+// validateCardNumber checks the length and the Luhn checksum of a card number,
+// ignoring spaces and dashes
+func validateCardNumber(number string) error {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(number)
+	if len(digits) < 12 || len(digits) > 19 {
+		return fmt.Errorf("card numbers have 12 to 19 digits")
+	}
+
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		c := digits[i]
+		if c < '0' || c > '9' {
+			return fmt.Errorf("card numbers only hold digits")
+		}
+		d := int(c - '0')
+		if (len(digits)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	if sum%10 != 0 {
+		return fmt.Errorf("card number checksum does not match, check for typos")
+	}
+
+	return nil
+}
+
+// matching returns a validator accepting the values that match pattern
+func matching(pattern *regexp.Regexp, format string) func(string) error {
+	return func(value string) error {
+		if !pattern.MatchString(value) {
+			return fmt.Errorf("expected %s", format)
+		}
+		return nil
+	}
+}
+
+func validateEmail(value string) error {
+	if at := strings.Index(value, "@"); at < 1 || at == len(value)-1 {
+		return fmt.Errorf("expected an email address")
+	}
+	return nil
+}
+
+func validateDate(value string) error {
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return fmt.Errorf("expected YYYY-MM-DD")
+	}
+	return nil
+}
+
+// joinSummary joins the non-empty parts of a summary
+func joinSummary(parts ...string) string {
+	kept := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, " · ")
+}
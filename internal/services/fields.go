@@ -0,0 +1,250 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"svimpass/internal/crypto"
+	"svimpass/internal/database"
+)
+
+// EntryFields lists the custom fields of an entry, concealed values left empty
+func (ps *PasswordService) EntryFields(id int) ([]CustomField, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	if _, err := ps.db.GetPasswordEntry(id); err != nil {
+		return nil, err
+	}
+
+	stored, err := ps.db.GetCustomFields(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return openCustomFields(encKey, stored[id])
+}
+
+// GetField decrypts the value of a custom field of an entry into a buffer the
+// caller destroys. This is the only way to read a concealed value.
+func (ps *PasswordService) GetField(id int, name string) (*crypto.SecureBuffer, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	if _, err := ps.db.GetPasswordEntry(id); err != nil {
+		return nil, err
+	}
+
+	field, err := ps.findField(encKey, id, name)
+	if err != nil {
+		return nil, err
+	}
+	if field == nil {
+		return nil, fmt.Errorf("entry %d has no field %q", id, name)
+	}
+	if len(field.EncryptedValue) == 0 {
+		return nil, fmt.Errorf("field %q is empty", name)
+	}
+
+	value, err := encKey.DecryptSecret(field.EncryptedValue, id, field.ValueBinding())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ps.db.MarkEntryUsed(id); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	return value, nil
+}
+
+// SetField adds a custom field to an entry, or replaces the field of the same name
+func (ps *PasswordService) SetField(id int, field CustomField) error {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	entry, err := ps.db.GetPasswordEntry(id)
+	if err != nil {
+		return err
+	}
+	schema, err := schemaFor(entry.Type)
+	if err != nil {
+		return err
+	}
+
+	field.Name = strings.TrimSpace(field.Name)
+	if field, err = schema.checkField(field); err != nil {
+		return err
+	}
+
+	existing, err := ps.findField(encKey, id, field.Name)
+	if err != nil {
+		return err
+	}
+
+	stored := &database.CustomField{EntryID: id, Concealed: field.Concealed}
+	if existing != nil {
+		stored.ID = existing.ID
+	}
+
+	return ps.db.SaveCustomField(stored, func(stored *database.CustomField) error {
+		return sealCustomField(encKey, field, stored)
+	})
+}
+
+// RemoveField deletes a custom field of an entry
+func (ps *PasswordService) RemoveField(id int, name string) error {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	entry, err := ps.db.GetPasswordEntry(id)
+	if err != nil {
+		return err
+	}
+	schema, err := schemaFor(entry.Type)
+	if err != nil {
+		return err
+	}
+	if spec := schema.typedField(name); spec != nil && spec.Required {
+		return fmt.Errorf("%s is required for %s entries, it can be changed but not removed", spec.Name, entry.Type)
+	}
+
+	field, err := ps.findField(encKey, id, name)
+	if err != nil {
+		return err
+	}
+	if field == nil {
+		return fmt.Errorf("entry %d has no field %q", id, name)
+	}
+
+	return ps.db.DeleteCustomField(id, field.ID)
+}
+
+// findField returns the custom field of an entry named name, ignoring case, or
+// nil when the entry has no such field
+func (ps *PasswordService) findField(encKey *crypto.EncryptionKey, id int, name string) (*database.CustomField, error) {
+	stored, err := ps.db.GetCustomFields(id)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	for _, field := range stored[id] {
+		fieldName, err := encKey.DecryptField(field.EncryptedName, id, field.NameBinding())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt field name of entry %d: %w", id, err)
+		}
+		if strings.EqualFold(fieldName, name) {
+			return field, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// completeResponses loads the custom fields and the tags of the entries in
+// responses and summarizes each entry according to its type
+func (ps *PasswordService) completeResponses(encKey *crypto.EncryptionKey, responses []PasswordEntryResponse) error {
+	ids := make([]int, 0, len(responses))
+	for _, response := range responses {
+		ids = append(ids, response.ID)
+	}
+
+	stored, err := ps.db.GetCustomFields(ids...)
+	if err != nil {
+		return err
+	}
+	tags, err := ps.entryTagNames(encKey, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range responses {
+		responses[i].Tags = tags[responses[i].ID]
+		if responses[i].Fields, err = openCustomFields(encKey, stored[responses[i].ID]); err != nil {
+			return err
+		}
+
+		schema, err := schemaFor(responses[i].Type)
+		if err != nil {
+			return err
+		}
+		responses[i].Summary = schema.summarize(responses[i])
+	}
+	return nil
+}
+
+// validateCustomField checks a custom field before it is stored
+func validateCustomField(field CustomField) error {
+	if field.Name == "" {
+		return fmt.Errorf("field name cannot be empty")
+	}
+	if field.Concealed && field.Value == "" {
+		return fmt.Errorf("concealed field %q needs a value", field.Name)
+	}
+	return nil
+}
+
+// validateCustomFields checks the custom fields of a new entry, names must be unique
+func validateCustomFields(fields []CustomField) error {
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if err := validateCustomField(field); err != nil {
+			return err
+		}
+		key := strings.ToLower(field.Name)
+		if seen[key] {
+			return fmt.Errorf("duplicate field %q", field.Name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// sealCustomField encrypts the name and value of a custom field, bound to its entry and ID
+func sealCustomField(encKey *crypto.EncryptionKey, field CustomField, stored *database.CustomField) error {
+	var err error
+	if stored.EncryptedName, err = encKey.EncryptField(field.Name, stored.EntryID, stored.NameBinding()); err != nil {
+		return fmt.Errorf("failed to encrypt field name: %w", err)
+	}
+	if stored.EncryptedValue, err = encryptOptional(encKey, field.Value, stored.EntryID, stored.ValueBinding()); err != nil {
+		return fmt.Errorf("failed to encrypt field %q: %w", field.Name, err)
+	}
+	return nil
+}
+
+// openCustomFields decrypts the names and plain values of custom fields, concealed
+// values are left empty
+func openCustomFields(encKey *crypto.EncryptionKey, stored []*database.CustomField) ([]CustomField, error) {
+	fields := make([]CustomField, 0, len(stored))
+	for _, field := range stored {
+		name, err := encKey.DecryptField(field.EncryptedName, field.EntryID, field.NameBinding())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt field name of entry %d: %w", field.EntryID, err)
+		}
+
+		opened := CustomField{Name: name, Concealed: field.Concealed}
+		if !field.Concealed {
+			if opened.Value, err = decryptOptional(encKey, field.EncryptedValue, field.EntryID, field.ValueBinding()); err != nil {
+				return nil, fmt.Errorf("failed to decrypt field %q of entry %d: %w", name, field.EntryID, err)
+			}
+		}
+		fields = append(fields, opened)
+	}
+	return fields, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+
+	"svimpass/internal/crypto"
+	"svimpass/internal/database"
+)
+
+// PasswordHistory lists the replaced passwords of an entry, version 1 being the
+// password it held last
+func (ps *PasswordService) PasswordHistory(id int) ([]PasswordHistoryResponse, error) {
+	if !ps.authSvc.IsUnlocked() {
+		return nil, fmt.Errorf("app is locked")
+	}
+	ps.authSvc.Touch()
+
+	history, err := ps.db.GetPasswordHistory(id)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]PasswordHistoryResponse, 0, len(history))
+	for i, version := range history {
+		response = append(response, PasswordHistoryResponse{
+			Version:    i + 1,
+			ReplacedAt: version.ReplacedAt.Format(timestampLayout),
+		})
+	}
+	return response, nil
+}
+
+// GetHistoricPassword decrypts a replaced password of an entry into a buffer the
+// caller destroys
+func (ps *PasswordService) GetHistoricPassword(id, version int) (*crypto.SecureBuffer, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	previous, err := ps.historyVersion(id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return encKey.DecryptSecret(previous.EncryptedPassword, id, database.FieldPassword)
+}
+
+// RollbackPassword restores a replaced password of an entry. The password it
+// replaces becomes version 1, so rolling back version 1 again undoes the rollback.
+func (ps *PasswordService) RollbackPassword(id, version int) error {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	previous, err := ps.historyVersion(id, version)
+	if err != nil {
+		return err
+	}
+
+	// Refuse versions that do not decrypt rather than leave the entry unreadable
+	password, err := encKey.DecryptSecret(previous.EncryptedPassword, id, database.FieldPassword)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt password version %d: %w", version, err)
+	}
+	password.Destroy()
+
+	return ps.db.RollbackPassword(id, previous.ID)
+}
+
+// HistoryLimit returns how many replaced passwords are kept per entry
+func (ps *PasswordService) HistoryLimit() (int, error) {
+	return ps.db.HistoryLimit()
+}
+
+// SetHistoryLimit changes how many replaced passwords are kept per entry, older
+// versions beyond the new limit are deleted
+func (ps *PasswordService) SetHistoryLimit(limit int) error {
+	if !ps.authSvc.IsUnlocked() {
+		return fmt.Errorf("app is locked")
+	}
+
+	return ps.db.SetHistoryLimit(limit)
+}
+
+// historyVersion returns version of the password history of an entry, counted from 1
+func (ps *PasswordService) historyVersion(id, version int) (*database.PasswordHistoryEntry, error) {
+	history, err := ps.db.GetPasswordHistory(id)
+	if err != nil {
+		return nil, err
+	}
+	if version < 1 || version > len(history) {
+		return nil, fmt.Errorf("entry %d has %d previous passwords, no version %d", id, len(history), version)
+	}
+	return history[version-1], nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// startIdleTimer arms the auto-lock after an unlock, replacing any running timer
+func (as *AuthService) startIdleTimer() {
+	as.idleMu.Lock()
+	defer as.idleMu.Unlock()
+
+	as.stopIdleTimerLocked()
+	as.armIdleTimerLocked()
+}
+
+// armIdleTimerLocked starts a new generation of the auto-lock, the caller holds
+// idleMu and has stopped the previous timer
+func (as *AuthService) armIdleTimerLocked() {
+	timeout := as.masterMgr.IdleTimeout()
+	if timeout <= 0 {
+		return
+	}
+
+	as.idleGen++
+	generation := as.idleGen
+	as.idleTimer = time.AfterFunc(timeout, func() { as.idleLock(generation) })
+}
+
+// stopIdleTimer disarms the auto-lock
+func (as *AuthService) stopIdleTimer() {
+	as.idleMu.Lock()
+	defer as.idleMu.Unlock()
+
+	as.stopIdleTimerLocked()
+}
+
+func (as *AuthService) stopIdleTimerLocked() {
+	if as.idleTimer != nil {
+		as.idleTimer.Stop()
+		as.idleTimer = nil
+	}
+}
+
+// idleLock locks the vault once the timer of generation expired, unless it was
+// stopped or replaced by activity meanwhile. The timer is cleared before the lock,
+// so activity from then on cannot postpone it.
+func (as *AuthService) idleLock(generation uint64) {
+	as.idleMu.Lock()
+	current := as.idleTimer != nil && as.idleGen == generation
+	if current {
+		as.idleTimer = nil
+	}
+	as.idleMu.Unlock()
+	if !current {
+		return
+	}
+
+	fmt.Println("Vault idle, locking")
+	as.LockApp()
+}
+
+// Touch records activity such as a search, a reveal or a command, postponing the auto-lock
+func (as *AuthService) Touch() {
+	as.idleMu.Lock()
+	defer as.idleMu.Unlock()
+
+	// A timer that already fired cannot be reset, its lock is ignored by replacing it
+	if as.idleTimer != nil {
+		as.stopIdleTimerLocked()
+		as.armIdleTimerLocked()
+	}
+}
+
+// IdleTimeout returns how long the unlocked vault may stay idle before it locks, 0 means never
+func (as *AuthService) IdleTimeout() time.Duration {
+	return as.masterMgr.IdleTimeout()
+}
+
+// SetIdleTimeout changes how long the unlocked vault may stay idle, 0 disables the auto-lock
+func (as *AuthService) SetIdleTimeout(timeout time.Duration) error {
+	if !as.IsUnlocked() {
+		return fmt.Errorf("app is locked")
+	}
+
+	if err := as.masterMgr.SetIdleTimeout(timeout); err != nil {
+		return err
+	}
+
+	as.startIdleTimer()
+	return nil
+}
@@ -1,55 +1,112 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	"svimpass/internal/crypto"
 	"svimpass/internal/csv"
 	"svimpass/internal/database"
 	"svimpass/internal/generator"
+	"svimpass/internal/query"
 )
 
+// timestampLayout formats the entry timestamps handed to the frontend
+const timestampLayout = "2006-01-02 15:04:05"
+
+// updatedAtLayout formats updatedAt at full precision, it is the token UpdateEntry
+// checks to refuse updates of entries that changed meanwhile
+const updatedAtLayout = time.RFC3339Nano
+
 type PasswordService struct {
-	db      *database.DB
-	authSvc *AuthService
+	db        *database.DB
+	authSvc   *AuthService
+	upgrade   *ciphertextUpgrade
+	upgradeMu sync.Mutex
 }
 
 func NewPasswordService(db *database.DB, authSvc *AuthService) *PasswordService {
-	return &PasswordService{
+	ps := &PasswordService{
 		db:      db,
 		authSvc: authSvc,
 	}
+	authSvc.OnUnlock(ps.restrictLegacy)
+	authSvc.OnUnlock(ps.migrateMetadata)
+	authSvc.OnUnlock(ps.purgeTrashOnUnlock)
+	authSvc.OnUnlock(func(encKey *crypto.EncryptionKey) error {
+		ps.startUpgrade(encKey)
+		return nil
+	})
+	authSvc.OnLock(ps.stopUpgrade)
+	return ps
 }
 
-func (ps *PasswordService) SearchPasswords(query string) ([]PasswordEntryResponse, error) {
-	if !ps.authSvc.IsUnlocked() {
-		return nil, fmt.Errorf("the application is locked")
+// SearchPasswords returns the entries matching a search in the query language of
+// package query, the most relevant first, with the matched text highlighted
+func (ps *PasswordService) SearchPasswords(input string) ([]PasswordEntryResponse, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
+	ps.authSvc.Touch()
 
-	var entries []*database.PasswordEntry
-	var err error
+	q, err := query.Parse(input, time.Now(), ps.savedQueryLookup(encKey))
+	if err != nil {
+		return nil, err
+	}
 
-	if query == "" {
-		entries, err = ps.db.GetAllPasswordEntries()
-	} else {
-		entries, err = ps.db.SearchPasswordEntries(query)
+	index, err := encKey.BlindIndex()
+	if err != nil {
+		return nil, err
 	}
+	defer index.Destroy()
 
+	entries, err := ps.db.FindEntries(compileQuery(index, q))
 	if err != nil {
 		return nil, err
 	}
 
-	response := make([]PasswordEntryResponse, len(entries))
-	for i, entry := range entries {
-		response[i] = PasswordEntryResponse{
+	candidates := make([]PasswordEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		fields, err := openEntry(encKey, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, PasswordEntryResponse{
 			ID:          entry.ID,
-			ServiceName: entry.ServiceName,
-			Username:    entry.Username,
-			Notes:       entry.Notes,
-			CreatedAt:   entry.CreatedAt.Format("2006-01-02 15:04:05"),
-			UpdatedAt:   entry.UpdatedAt.Format("2006-01-02 15:04:05"),
+			Type:        entry.Type,
+			ServiceName: fields.ServiceName,
+			Username:    fields.Username,
+			Notes:       fields.Notes,
+			CreatedAt:   entry.CreatedAt.Format(timestampLayout),
+			UpdatedAt:   entry.UpdatedAt.Format(updatedAtLayout),
+		})
+	}
+
+	if err := ps.completeResponses(encKey, candidates); err != nil {
+		return nil, err
+	}
+
+	// The blind index only preselects, the query is confirmed on the decrypted entries
+	response := make([]PasswordEntryResponse, 0, len(candidates))
+	var matched []*database.PasswordEntry
+	for i, candidate := range candidates {
+		if q.Matches(queryEntry(candidate, entries[i])) {
+			candidate.Highlights = highlights(q, &candidate)
+			response = append(response, candidate)
+			matched = append(matched, entries[i])
 		}
 	}
 
+	if err := ps.rankResults(index, q, response, matched); err != nil {
+		return nil, err
+	}
+
 	return response, nil
 }
 
@@ -58,9 +115,11 @@ func (ps *PasswordService) GeneratePassword() (string, error) {
 }
 
 func (ps *PasswordService) GenerateAndSavePassword(req CreatePasswordRequest) (string, error) {
-	if !ps.authSvc.IsUnlocked() {
-		return "", fmt.Errorf("you must be logged in")
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return "", err
 	}
+	defer release()
 
 	if req.ServiceName == "" || req.Username == "" {
 		return "", fmt.Errorf("service name and username are required")
@@ -72,20 +131,11 @@ func (ps *PasswordService) GenerateAndSavePassword(req CreatePasswordRequest) (s
 	}
 
 	req.Password = password
-
-	encryptedPassword, err := ps.authSvc.GetEncryptionKey().Encrypt(password)
-	if err != nil {
-		return "", fmt.Errorf("error encrypting the password")
-	}
-
-	entry := &database.PasswordEntry{
-		ServiceName:       req.ServiceName,
-		Username:          req.Username,
-		EncryptedPassword: encryptedPassword,
-		Notes:             req.Notes,
+	if _, err := CheckNewEntry(&req); err != nil {
+		return "", err
 	}
 
-	err = ps.db.CreatePasswordEntry(entry)
+	err = ps.createEntry(encKey, req)
 	if err != nil {
 		return "", err
 	}
@@ -93,102 +143,347 @@ func (ps *PasswordService) GenerateAndSavePassword(req CreatePasswordRequest) (s
 	return password, nil
 }
 
-func (ps *PasswordService) GetPassword(id int) (string, error) {
-	if !ps.authSvc.IsUnlocked() {
-		return "", fmt.Errorf("app is locked")
+// GetPassword decrypts the password of an entry into a buffer the caller destroys
+// as soon as the password has been handed over
+func (ps *PasswordService) GetPassword(id int) (*crypto.SecureBuffer, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
+	ps.authSvc.Touch()
 
 	entry, err := ps.db.GetPasswordEntry(id)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	password, err := ps.authSvc.GetEncryptionKey().Decrypt(entry.EncryptedPassword)
+	password, err := openPassword(encKey, entry)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if password == nil {
+		return nil, fmt.Errorf("%s entries have no password to copy", entry.Type)
 	}
 
+	if err := ps.db.MarkEntryUsed(id); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
 	return password, nil
 }
 
 func (ps *PasswordService) CreatePassword(req CreatePasswordRequest) error {
-	if !ps.authSvc.IsUnlocked() {
-		return fmt.Errorf("app is locked")
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return err
 	}
+	defer release()
 
-	if req.ServiceName == "" || req.Username == "" || req.Password == "" {
-		return fmt.Errorf("service name, username, and password are required")
+	missing, err := CheckNewEntry(&req)
+	if err != nil {
+		return err
+	}
+	if missing != "" {
+		return fmt.Errorf("%s is required for %s entries", missing, req.Type)
 	}
 
-	encryptedPassword, err := ps.authSvc.GetEncryptionKey().Encrypt(req.Password)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt password: %w", err)
+	return ps.createEntry(encKey, req)
+}
+
+// createEntry encrypts a new entry, including its metadata and custom fields, and stores it
+func (ps *PasswordService) createEntry(encKey *crypto.EncryptionKey, req CreatePasswordRequest) error {
+	for i := range req.Fields {
+		req.Fields[i].Name = strings.TrimSpace(req.Fields[i].Name)
+	}
+	if err := validateCustomFields(req.Fields); err != nil {
+		return err
 	}
 
-	entry := &database.PasswordEntry{
-		ServiceName:       req.ServiceName,
-		Username:          req.Username,
-		EncryptedPassword: encryptedPassword,
-		Notes:             req.Notes,
+	fields := entryFields{
+		ServiceName: req.ServiceName,
+		Username:    req.Username,
+		Notes:       req.Notes,
 	}
 
-	return ps.db.CreatePasswordEntry(entry)
+	newEntry := &database.PasswordEntry{Type: req.Type}
+	if newEntry.Type == "" {
+		newEntry.Type = EntryTypeLogin
+	}
+	for _, field := range req.Fields {
+		newEntry.CustomFields = append(newEntry.CustomFields, &database.CustomField{Concealed: field.Concealed})
+	}
+
+	return ps.db.CreatePasswordEntry(newEntry, func(entry *database.PasswordEntry) error {
+		if err := sealPassword(encKey, req.Password, entry); err != nil {
+			return err
+		}
+		for i, field := range req.Fields {
+			if err := sealCustomField(encKey, field, entry.CustomFields[i]); err != nil {
+				return err
+			}
+		}
+		return sealEntry(encKey, fields, entry)
+	})
 }
 
+// DeletePassword moves an entry into the trash
 func (ps *PasswordService) DeletePassword(id int) error {
 	if !ps.authSvc.IsUnlocked() {
 		return fmt.Errorf("app is locked")
 	}
 
-	return ps.db.DeletePasswordEntry(id)
+	if err := ps.db.DeletePasswordEntry(id); err != nil {
+		return err
+	}
+	if err := ps.purgeExpiredTrash(); err != nil {
+		fmt.Printf("Warning: failed to purge expired trash: %v\n", err)
+	}
+	return nil
 }
 
 func (ps *PasswordService) UpdatePasswordEntry(id int, newpassword string) error {
-	if !ps.authSvc.IsUnlocked() {
-		return fmt.Errorf("app is locked")
+	_, err := ps.UpdateEntry(id, UpdateEntryRequest{Password: &newpassword})
+	return err
+}
+
+// UpdateEntry applies the fields set in patch to an entry and returns the updated
+// entry. With UpdatedAt set, the update is refused if the entry changed since.
+func (ps *PasswordService) UpdateEntry(id int, patch UpdateEntryRequest) (*PasswordEntryResponse, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	if patch.ServiceName != nil && *patch.ServiceName == "" {
+		return nil, fmt.Errorf("service name cannot be empty")
+	}
+	if patch.Password != nil && *patch.Password == "" {
+		return nil, fmt.Errorf("password cannot be empty")
 	}
 
 	currentEntry, err := ps.db.GetPasswordEntry(id)
 	if err != nil {
-		return fmt.Errorf("error getting the password you want to edit: %w", err)
+		return nil, fmt.Errorf("error getting the password you want to edit: %w", err)
+	}
+	expected := currentEntry.UpdatedAt
+	if patch.UpdatedAt != "" {
+		expected, err = time.Parse(updatedAtLayout, patch.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid updatedAt %q", patch.UpdatedAt)
+		}
+		if !expected.Equal(currentEntry.UpdatedAt) {
+			return nil, database.ErrEntryModified
+		}
 	}
 
-	newEncryptedPassword, err := ps.authSvc.GetEncryptionKey().Encrypt(newpassword)
+	schema, err := schemaFor(currentEntry.Type)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	if patch.Password != nil {
+		if err := schema.validateSecret(*patch.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	fields, err := openEntry(encKey, currentEntry)
+	if err != nil {
+		return nil, err
+	}
+	if patch.ServiceName != nil {
+		fields.ServiceName = *patch.ServiceName
+	}
+	if patch.Username != nil {
+		fields.Username = *patch.Username
+	}
+	if patch.Notes != nil {
+		fields.Notes = *patch.Notes
+	}
+
+	hasSecret := len(currentEntry.EncryptedPassword) > 0 || patch.Password != nil
+	if err := schema.validateCore(fields.ServiceName, fields.Username, hasSecret); err != nil {
+		return nil, err
+	}
+
 	newEntry := &database.PasswordEntry{
 		ID:                currentEntry.ID,
-		ServiceName:       currentEntry.ServiceName,
-		Username:          currentEntry.Username,
-		EncryptedPassword: newEncryptedPassword,
-		Notes:             currentEntry.Notes,
+		EncryptedPassword: currentEntry.EncryptedPassword,
+		CreatedAt:         currentEntry.CreatedAt,
+	}
+	if patch.Password != nil {
+		if err := sealPassword(encKey, *patch.Password, newEntry); err != nil {
+			return nil, err
+		}
+	}
+	if err := sealEntry(encKey, fields, newEntry); err != nil {
+		return nil, err
 	}
 
-	err = ps.db.UpdatePasswordEntry(newEntry)
-	if err != nil {
-		return fmt.Errorf("error updating the password entry %w", err)
+	// The entry may still change between the read above and this write
+	if err := ps.db.UpdatePasswordEntryIfUnchanged(newEntry, expected); err != nil {
+		if errors.Is(err, database.ErrEntryModified) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error updating the password entry %w", err)
 	}
 
-	return nil
+	response := []PasswordEntryResponse{{
+		ID:          newEntry.ID,
+		Type:        currentEntry.Type,
+		ServiceName: fields.ServiceName,
+		Username:    fields.Username,
+		Notes:       fields.Notes,
+		CreatedAt:   newEntry.CreatedAt.Format(timestampLayout),
+		UpdatedAt:   newEntry.UpdatedAt.Format(updatedAtLayout),
+	}}
+	if err := ps.completeResponses(encKey, response); err != nil {
+		return nil, err
+	}
+
+	return &response[0], nil
 }
 
 func (ps *PasswordService) ImportPasswordFromCSV(filepath string) (int, error) {
-	if !ps.authSvc.IsUnlocked() {
-		return -1, fmt.Errorf("you must unlock the application")
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return -1, err
+	}
+	defer release()
+
+	rows, err := csv.ReadPasswordCSV(filepath)
+	if err != nil {
+		return -1, err
 	}
-	return csv.ImportPasswordFromCSV(ps.db, ps.authSvc.GetEncryptionKey(), filepath)
+
+	successCounter := 0
+	for _, row := range rows {
+		err := ps.createEntry(encKey, CreatePasswordRequest{
+			ServiceName: row.ServiceName,
+			Username:    row.Username,
+			Password:    row.Password,
+			Notes:       row.Notes,
+		})
+		if err != nil {
+			continue
+		}
+		successCounter++
+	}
+
+	return successCounter, nil
 }
 
-func (ps *PasswordService) ExportPasswordToCSV() error {
-	if !ps.authSvc.IsUnlocked() {
-		return fmt.Errorf("you must unlock the application")
+// ExportPasswordToCSV exports the entries to CSV, only those carrying every one
+// of tags when tags are given
+func (ps *PasswordService) ExportPasswordToCSV(tags ...string) error {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	entries, err := ps.exportedEntries(encKey, tags)
+	if err != nil {
+		return fmt.Errorf("error getting the entries from the database %v", err)
+	}
+	if len(tags) > 0 && len(entries) == 0 {
+		return fmt.Errorf("no entry is tagged %s", strings.Join(tags, " and "))
+	}
+
+	rows := make([]csv.ExportEntry, 0, len(entries))
+	defer func() {
+		for _, row := range rows {
+			row.Password.Destroy()
+		}
+	}()
+
+	for _, entry := range entries {
+		fields, err := openEntry(encKey, entry)
+		if err != nil {
+			return err
+		}
+		password, err := openPassword(encKey, entry)
+		if err != nil {
+			return fmt.Errorf("error decrypting the password %v", err)
+		}
+		rows = append(rows, csv.ExportEntry{
+			ServiceName: fields.ServiceName,
+			Username:    fields.Username,
+			Password:    password,
+			Notes:       fields.Notes,
+		})
+	}
+
+	return csv.ExportPasswordToCSV(rows)
+}
+
+// exportedEntries returns every entry outside the trash, or those carrying every one of tags
+func (ps *PasswordService) exportedEntries(encKey *crypto.EncryptionKey, tags []string) ([]*database.PasswordEntry, error) {
+	if len(tags) == 0 {
+		return ps.db.GetAllPasswordEntries()
+	}
+
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		name, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	index, err := encKey.BlindIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer index.Destroy()
+
+	conditions := make([]database.Condition, 0, len(names))
+	for _, name := range names {
+		conditions = append(conditions, database.HasTag(index.ExactToken(indexFieldTag, name)))
+	}
+	return ps.db.FindEntries(database.All(conditions...))
+}
+
+// VerifyEntries decrypts every field of every entry with encKey and returns how
+// many entries were checked
+func (ps *PasswordService) VerifyEntries(encKey *crypto.EncryptionKey) (int, error) {
+	entries, err := ps.db.GetAllPasswordEntries()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		if _, err := openEntry(encKey, entry); err != nil {
+			return 0, err
+		}
+		password, err := openPassword(encKey, entry)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt password of entry %d: %w", entry.ID, err)
+		}
+		password.Destroy()
 	}
 
-	return csv.ExportPasswordToCSV(ps.db, ps.authSvc.encKey)
+	return len(entries), nil
+}
+
+// UpgradeEncryption re-encrypts, in the background, every ciphertext that is not an
+// envelope of the current version and cipher
+func (ps *PasswordService) UpgradeEncryption() error {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ps.startUpgrade(encKey)
+	return nil
 }
 
 func (ps *PasswordService) ResetApp() error {
+	// The PIN wraps the vault key in memory and would outlive the deleted files
+	ps.authSvc.DisableQuickUnlock()
 	ps.authSvc.LockApp()
 	if ps.db != nil {
 		ps.db.Close()
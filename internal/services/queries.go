@@ -0,0 +1,183 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"svimpass/internal/crypto"
+	"svimpass/internal/database"
+	"svimpass/internal/query"
+)
+
+// SavedQueries returns the saved queries sorted by name
+func (ps *PasswordService) SavedQueries() ([]SavedQueryResponse, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	stored, err := ps.db.GetSavedQueries()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]SavedQueryResponse, 0, len(stored))
+	for _, q := range stored {
+		opened, err := openSavedQuery(encKey, q)
+		if err != nil {
+			return nil, err
+		}
+		response = append(response, opened)
+	}
+	sort.Slice(response, func(i, j int) bool {
+		return strings.ToLower(response[i].Name) < strings.ToLower(response[j].Name)
+	})
+
+	return response, nil
+}
+
+// SaveQuery stores a search under name, replacing the query saved under the same
+// name, so that it can be recalled as @name
+func (ps *PasswordService) SaveQuery(name, text string) error {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	name, err = normalizeQueryName(name)
+	if err != nil {
+		return err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("query cannot be empty")
+	}
+	if _, err := query.Parse(text, time.Now(), nil); err != nil {
+		return err
+	}
+
+	stored, err := ps.findSavedQuery(encKey, name)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		stored = &database.SavedQuery{}
+	}
+
+	return ps.db.SaveQuery(stored, func(q *database.SavedQuery) error {
+		var err error
+		if q.EncryptedName, err = encKey.EncryptField(name, 0, q.NameBinding()); err != nil {
+			return fmt.Errorf("failed to encrypt query name: %w", err)
+		}
+		if q.EncryptedQuery, err = encKey.EncryptField(text, 0, q.QueryBinding()); err != nil {
+			return fmt.Errorf("failed to encrypt query: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteQuery removes the saved query called name
+func (ps *PasswordService) DeleteQuery(name string) error {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	name, err = normalizeQueryName(name)
+	if err != nil {
+		return err
+	}
+
+	stored, err := ps.findSavedQuery(encKey, name)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return fmt.Errorf("no saved query @%s", name)
+	}
+
+	return ps.db.DeleteSavedQuery(stored.ID)
+}
+
+// savedQueryLookup resolves @name in searches, loading the saved queries the
+// first time one is recalled
+func (ps *PasswordService) savedQueryLookup(encKey *crypto.EncryptionKey) query.Lookup {
+	var saved map[string]string
+	return func(name string) (string, error) {
+		if saved == nil {
+			stored, err := ps.db.GetSavedQueries()
+			if err != nil {
+				return "", err
+			}
+
+			saved = make(map[string]string, len(stored))
+			for _, q := range stored {
+				opened, err := openSavedQuery(encKey, q)
+				if err != nil {
+					return "", err
+				}
+				saved[strings.ToLower(opened.Name)] = opened.Query
+			}
+		}
+
+		text, ok := saved[strings.ToLower(name)]
+		if !ok {
+			return "", fmt.Errorf("no saved query @%s", name)
+		}
+		return text, nil
+	}
+}
+
+// findSavedQuery returns the saved query called name, ignoring case, or nil when
+// there is none
+func (ps *PasswordService) findSavedQuery(encKey *crypto.EncryptionKey, name string) (*database.SavedQuery, error) {
+	stored, err := ps.db.GetSavedQueries()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, q := range stored {
+		storedName, err := encKey.DecryptField(q.EncryptedName, 0, q.NameBinding())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt saved query %d: %w", q.ID, err)
+		}
+		if strings.EqualFold(storedName, name) {
+			return q, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// normalizeQueryName trims a saved query name and drops the @ it is recalled with
+func normalizeQueryName(name string) (string, error) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+	if name == "" {
+		return "", fmt.Errorf("query name cannot be empty")
+	}
+	if strings.ContainsAny(name, " \t@\"") {
+		return "", fmt.Errorf("query name %q cannot contain spaces, @ or quotes", name)
+	}
+	return name, nil
+}
+
+// openSavedQuery decrypts the name and text of a saved query
+func openSavedQuery(encKey *crypto.EncryptionKey, q *database.SavedQuery) (SavedQueryResponse, error) {
+	name, err := encKey.DecryptField(q.EncryptedName, 0, q.NameBinding())
+	if err != nil {
+		return SavedQueryResponse{}, fmt.Errorf("failed to decrypt saved query %d: %w", q.ID, err)
+	}
+	text, err := encKey.DecryptField(q.EncryptedQuery, 0, q.QueryBinding())
+	if err != nil {
+		return SavedQueryResponse{}, fmt.Errorf("failed to decrypt saved query %d: %w", q.ID, err)
+	}
+	return SavedQueryResponse{Name: name, Query: text}, nil
+}
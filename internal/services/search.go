@@ -0,0 +1,265 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"svimpass/internal/crypto"
+	"svimpass/internal/database"
+	"svimpass/internal/query"
+)
+
+// compileQuery turns q into the SQL condition preselecting its candidates. Terms
+// on encrypted fields can only narrow the search through the blind index, whose
+// trigram matches may be false positives: negated text terms, terms shorter than
+// a trigram and terms on unindexed fields such as url are left to the match on
+// the decrypted entries.
+func compileQuery(index *crypto.BlindIndex, q query.Query) database.Condition {
+	if len(q.Clauses) == 0 {
+		return database.Everything
+	}
+
+	clauses := make([]database.Condition, 0, len(q.Clauses))
+	for _, clause := range q.Clauses {
+		var conditions []database.Condition
+		for _, term := range clause.Terms {
+			if condition, ok := compileTerm(index, term); ok {
+				conditions = append(conditions, condition)
+			}
+		}
+		clauses = append(clauses, database.All(conditions...))
+	}
+
+	return database.Any(clauses...)
+}
+
+// compileTerm returns the SQL condition of a term, false when it has none
+func compileTerm(index *crypto.BlindIndex, term query.Term) (database.Condition, bool) {
+	var condition database.Condition
+
+	switch term.Field {
+	case query.FieldText, query.FieldService, query.FieldUser, query.FieldNotes:
+		if term.Negated {
+			return condition, false
+		}
+
+		var groups [][][]byte
+		for _, field := range searchedFields(term) {
+			groups = append(groups, index.Tokens(field.index, term.Value))
+		}
+		for _, tokens := range groups {
+			if tokens == nil {
+				return condition, false
+			}
+		}
+		return database.MatchTokens(groups...), true
+	case query.FieldTag:
+		condition = database.HasTag(index.ExactToken(indexFieldTag, term.Value))
+	case query.FieldType:
+		condition = database.OfType(term.Value)
+	case query.FieldCreated:
+		condition = database.CreatedBetween(term.After, term.Before)
+	case query.FieldUpdated:
+		condition = database.UpdatedBetween(term.After, term.Before)
+	default:
+		return condition, false
+	}
+
+	if term.Negated {
+		condition = database.Not(condition)
+	}
+	return condition, true
+}
+
+// queryEntry is what a query is matched against, the decrypted response of an
+// entry and the timestamps of the stored entry
+func queryEntry(response PasswordEntryResponse, entry *database.PasswordEntry) query.Entry {
+	matched := query.Entry{
+		Service:  response.ServiceName,
+		Username: response.Username,
+		Notes:    response.Notes,
+		Type:     response.Type,
+		Tags:     response.Tags,
+		Created:  entry.CreatedAt,
+		Updated:  entry.UpdatedAt,
+	}
+	for _, field := range response.Fields {
+		if strings.EqualFold(field.Name, query.FieldURL) {
+			matched.URL = field.Value
+		}
+	}
+	return matched
+}
+
+// searchedField is a field free text is searched in: its blind index field, its
+// JSON name in responses and its value in a result
+type searchedField struct {
+	index string
+	name  string
+	value func(response *PasswordEntryResponse) string
+}
+
+var searchedFieldList = []searchedField{
+	{indexFieldService, "serviceName", func(r *PasswordEntryResponse) string { return r.ServiceName }},
+	{indexFieldUsername, "username", func(r *PasswordEntryResponse) string { return r.Username }},
+	{indexFieldNotes, "notes", func(r *PasswordEntryResponse) string { return r.Notes }},
+}
+
+// searchedFields returns the fields a text term looks at, none for other terms
+func searchedFields(term query.Term) []searchedField {
+	switch term.Field {
+	case query.FieldText:
+		return searchedFieldList
+	case query.FieldService:
+		return searchedFieldList[:1]
+	case query.FieldUser:
+		return searchedFieldList[1:2]
+	case query.FieldNotes:
+		return searchedFieldList[2:]
+	}
+	return nil
+}
+
+// textTerms returns the terms of q that look for text in the searched fields,
+// negated terms excluded
+func textTerms(q query.Query) []query.Term {
+	var terms []query.Term
+	for _, clause := range q.Clauses {
+		for _, term := range clause.Terms {
+			if !term.Negated && len(searchedFields(term)) > 0 {
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// rankResults orders search results by their BM25 relevance to the words of q,
+// relative to the best match, plus a bonus of up to recencyWeight for entries
+// used recently. Without a full-text index results are ordered by recency alone;
+// ties fall back to service name and username. entries holds the stored entry of
+// each result.
+func (ps *PasswordService) rankResults(index *crypto.BlindIndex, q query.Query, results []PasswordEntryResponse, entries []*database.PasswordEntry) error {
+	var tokens [][]byte
+	for _, term := range textTerms(q) {
+		for _, word := range crypto.SearchWords(term.Value) {
+			tokens = append(tokens, index.WordToken(indexFieldWord, word))
+		}
+	}
+
+	ids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+
+	relevance, err := ps.db.RankEntries(ids, tokens)
+	if err != nil {
+		return err
+	}
+
+	// BM25 scores only compare within one search, the best match scores 1
+	best := 0.0
+	for _, score := range relevance {
+		best = max(best, score)
+	}
+
+	now := time.Now()
+	scores := make(map[int]float64, len(entries))
+	for _, entry := range entries {
+		score := recencyWeight * recency(entry.LastUsedAt, now)
+		if best > 0 {
+			score += relevance[entry.ID] / best
+		}
+		scores[entry.ID] = score
+	}
+
+	sortEntries(results)
+	sort.SliceStable(results, func(i, j int) bool {
+		return scores[results[i].ID] > scores[results[j].ID]
+	})
+	return nil
+}
+
+// recencyWeight is the bonus of an entry used just now, half the score of the
+// best match so recent use reorders close matches without burying the best one
+const recencyWeight = 0.5
+
+// recency is 1 for an entry used just now, halving after a week and fading from
+// there, and 0 for an entry never used
+func recency(lastUsed, now time.Time) float64 {
+	if lastUsed.IsZero() {
+		return 0
+	}
+	days := max(now.Sub(lastUsed).Hours()/24, 0)
+	return 1 / (1 + days/7)
+}
+
+// highlights returns where the text terms of q occur in the searched fields of a
+// result, as rune offsets with overlapping ranges merged
+func highlights(q query.Query, response *PasswordEntryResponse) []Highlight {
+	terms := textTerms(q)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	var found []Highlight
+	for _, field := range searchedFieldList {
+		text := []rune(crypto.FoldText(field.value(response)))
+
+		var ranges []Highlight
+		for _, term := range terms {
+			if !hasField(searchedFields(term), field.index) {
+				continue
+			}
+			value := []rune(crypto.FoldText(term.Value))
+			for _, start := range runeIndexes(text, value) {
+				ranges = append(ranges, Highlight{Field: field.name, Start: start, End: start + len(value)})
+			}
+		}
+		found = append(found, mergeHighlights(ranges)...)
+	}
+	return found
+}
+
+// hasField reports whether fields holds the field with blind index field name
+func hasField(fields []searchedField, name string) bool {
+	for _, field := range fields {
+		if field.index == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runeIndexes returns the offset of every occurrence of value in text
+func runeIndexes(text, value []rune) []int {
+	if len(value) == 0 {
+		return nil
+	}
+
+	var indexes []int
+	for i := 0; i+len(value) <= len(text); i++ {
+		if string(text[i:i+len(value)]) == string(value) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// mergeHighlights sorts the ranges of one field and merges those that overlap or touch
+func mergeHighlights(ranges []Highlight) []Highlight {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Start < ranges[j].Start
+	})
+
+	var merged []Highlight
+	for _, r := range ranges {
+		if last := len(merged) - 1; last >= 0 && r.Start <= merged[last].End {
+			merged[last].End = max(merged[last].End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
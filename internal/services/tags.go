@@ -0,0 +1,149 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"svimpass/internal/crypto"
+	"svimpass/internal/database"
+)
+
+// Blind index field of tag names, tags only ever match in full
+const indexFieldTag = "tag"
+
+// TagEntries adds a tag to the given entries and returns how many of them did not
+// carry it yet. The tag is created the first time it is used.
+func (ps *PasswordService) TagEntries(tag string, ids []int) (int, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	name, err := normalizeTag(tag)
+	if err != nil {
+		return 0, err
+	}
+
+	token, err := tagToken(encKey, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return ps.db.TagEntries(ids, &database.Tag{Token: token}, func(stored *database.Tag) error {
+		var err error
+		if stored.EncryptedName, err = encKey.EncryptField(name, 0, stored.NameBinding()); err != nil {
+			return fmt.Errorf("failed to encrypt tag name: %w", err)
+		}
+		return nil
+	})
+}
+
+// UntagEntries removes a tag from the given entries and returns how many of them
+// carried it
+func (ps *PasswordService) UntagEntries(tag string, ids []int) (int, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	name, err := normalizeTag(tag)
+	if err != nil {
+		return 0, err
+	}
+
+	token, err := tagToken(encKey, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return ps.db.UntagEntries(ids, token)
+}
+
+// ListTags returns the tags in use, sorted by name, with the number of entries
+// carrying each of them
+func (ps *PasswordService) ListTags() ([]TagResponse, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	tags, err := ps.db.GetTags()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]TagResponse, 0, len(tags))
+	for _, tag := range tags {
+		name, err := openTag(encKey, tag)
+		if err != nil {
+			return nil, err
+		}
+		response = append(response, TagResponse{Name: name, Entries: tag.Entries})
+	}
+	sort.Slice(response, func(i, j int) bool {
+		return strings.ToLower(response[i].Name) < strings.ToLower(response[j].Name)
+	})
+
+	return response, nil
+}
+
+// normalizeTag trims a tag name and drops the # it is written with in searches
+func normalizeTag(tag string) (string, error) {
+	name := strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	if name == "" {
+		return "", fmt.Errorf("tag name cannot be empty")
+	}
+	if strings.ContainsAny(name, " \t#") {
+		return "", fmt.Errorf("tag %q cannot contain spaces or #", name)
+	}
+	return name, nil
+}
+
+// tagToken returns the blind index token of a tag name
+func tagToken(encKey *crypto.EncryptionKey, name string) ([]byte, error) {
+	index, err := encKey.BlindIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer index.Destroy()
+
+	return index.ExactToken(indexFieldTag, name), nil
+}
+
+// openTag decrypts the name of a tag
+func openTag(encKey *crypto.EncryptionKey, tag *database.Tag) (string, error) {
+	name, err := encKey.DecryptField(tag.EncryptedName, 0, tag.NameBinding())
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt tag %d: %w", tag.ID, err)
+	}
+	return name, nil
+}
+
+// entryTagNames loads and decrypts the tag names of the given entries by entry ID,
+// each sorted by name
+func (ps *PasswordService) entryTagNames(encKey *crypto.EncryptionKey, ids []int) (map[int][]string, error) {
+	stored, err := ps.db.GetEntryTags(ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[int][]string, len(stored))
+	for id, tags := range stored {
+		for _, tag := range tags {
+			name, err := openTag(encKey, tag)
+			if err != nil {
+				return nil, err
+			}
+			names[id] = append(names[id], name)
+		}
+		sort.Strings(names[id])
+	}
+	return names, nil
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"svimpass/internal/crypto"
+)
+
+// TrashedPasswords lists the entries in the trash, most recently deleted first
+func (ps *PasswordService) TrashedPasswords() ([]TrashedEntryResponse, error) {
+	encKey, release, err := ps.authSvc.AcquireKey()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ps.authSvc.Touch()
+
+	entries, err := ps.db.GetTrashedEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := ps.db.TrashRetentionDays()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]TrashedEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		fields, err := openEntry(encKey, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		trashed := TrashedEntryResponse{
+			ID:          entry.ID,
+			ServiceName: fields.ServiceName,
+			Username:    fields.Username,
+			DeletedAt:   entry.DeletedAt.Format(timestampLayout),
+		}
+		if days > 0 {
+			trashed.PurgeAt = entry.DeletedAt.AddDate(0, 0, days).Format(timestampLayout)
+		}
+		response = append(response, trashed)
+	}
+
+	return response, nil
+}
+
+// RestorePassword moves an entry out of the trash
+func (ps *PasswordService) RestorePassword(id int) error {
+	if !ps.authSvc.IsUnlocked() {
+		return fmt.Errorf("app is locked")
+	}
+	ps.authSvc.Touch()
+
+	return ps.db.RestorePasswordEntry(id)
+}
+
+// EmptyTrash permanently deletes every entry in the trash and returns how many
+func (ps *PasswordService) EmptyTrash() (int, error) {
+	if !ps.authSvc.IsUnlocked() {
+		return 0, fmt.Errorf("app is locked")
+	}
+	ps.authSvc.Touch()
+
+	return ps.db.PurgeTrash(time.Time{})
+}
+
+// TrashRetentionDays returns after how many days trashed entries are purged
+func (ps *PasswordService) TrashRetentionDays() (int, error) {
+	return ps.db.TrashRetentionDays()
+}
+
+// SetTrashRetentionDays changes after how many days trashed entries are purged,
+// 0 keeps them until the trash is emptied
+func (ps *PasswordService) SetTrashRetentionDays(days int) error {
+	if !ps.authSvc.IsUnlocked() {
+		return fmt.Errorf("app is locked")
+	}
+
+	if err := ps.db.SetTrashRetentionDays(days); err != nil {
+		return err
+	}
+	return ps.purgeExpiredTrash()
+}
+
+// purgeExpiredTrash permanently deletes the entries that have been in the trash
+// longer than the retention
+func (ps *PasswordService) purgeExpiredTrash() error {
+	days, err := ps.db.TrashRetentionDays()
+	if err != nil || days == 0 {
+		return err
+	}
+
+	_, err = ps.db.PurgeTrash(time.Now().AddDate(0, 0, -days))
+	return err
+}
+
+// purgeTrashOnUnlock runs on unlock, a failed purge is retried on the next unlock
+func (ps *PasswordService) purgeTrashOnUnlock(encKey *crypto.EncryptionKey) error {
+	if err := ps.purgeExpiredTrash(); err != nil {
+		fmt.Printf("Warning: failed to purge expired trash: %v\n", err)
+	}
+	return nil
+}
@@ -1,17 +1,94 @@
 package services
 
+// PasswordEntryResponse is an entry as search results show it. Summary describes
+// the entry according to its type, Highlights where the search matched it.
 type PasswordEntryResponse struct {
-	ID          int    `json:"id"`
-	ServiceName string `json:"serviceName"`
-	Username    string `json:"username"`
-	Notes       string `json:"notes"`
-	CreatedAt   string `json:"createdAt"`
-	UpdatedAt   string `json:"updatedAt"`
+	ID          int           `json:"id"`
+	Type        string        `json:"type,omitempty"`
+	Summary     string        `json:"summary,omitempty"`
+	ServiceName string        `json:"serviceName"`
+	Username    string        `json:"username"`
+	Notes       string        `json:"notes"`
+	CreatedAt   string        `json:"createdAt"`
+	UpdatedAt   string        `json:"updatedAt"`
+	Fields      []CustomField `json:"fields,omitempty"`
+	Tags        []string      `json:"tags,omitempty"`
+	Highlights  []Highlight   `json:"highlights,omitempty"`
 }
 
+// Highlight is a match of a search in a field of a result, Field being the JSON
+// name of the field. Start and End are offsets in runes, End excluded.
+type Highlight struct {
+	Field string `json:"field"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// CreatePasswordRequest is a new entry. Type is one of the entry types, empty
+// for a login; Password holds the secret of the type.
 type CreatePasswordRequest struct {
+	Type        string        `json:"type,omitempty"`
+	ServiceName string        `json:"serviceName"`
+	Username    string        `json:"username"`
+	Password    string        `json:"password"`
+	Notes       string        `json:"notes"`
+	Fields      []CustomField `json:"fields,omitempty"`
+}
+
+// CustomField is a named field of an entry. Responses leave the value of a
+// concealed field empty, it is only read through GetField.
+type CustomField struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Concealed bool   `json:"concealed"`
+}
+
+// UpdateEntryRequest is a partial update of an entry, nil fields are left as they
+// are. UpdatedAt is the updatedAt the caller last saw, unchanged from the response,
+// the update is refused if the entry changed since; leave it empty to skip the check.
+type UpdateEntryRequest struct {
+	ServiceName *string `json:"serviceName,omitempty"`
+	Username    *string `json:"username,omitempty"`
+	Password    *string `json:"password,omitempty"`
+	Notes       *string `json:"notes,omitempty"`
+	UpdatedAt   string  `json:"updatedAt,omitempty"`
+}
+
+// TagResponse is a tag in use and the number of entries outside the trash carrying it
+type TagResponse struct {
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+}
+
+// SavedQueryResponse is a search saved under a name, recalled as @name
+type SavedQueryResponse struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// PasswordHistoryResponse is a replaced password of an entry, version 1 is the
+// most recent one
+type PasswordHistoryResponse struct {
+	Version    int    `json:"version"`
+	ReplacedAt string `json:"replacedAt"`
+}
+
+// TrashedEntryResponse is an entry in the trash, PurgeAt is empty when trashed
+// entries are kept until the trash is emptied
+type TrashedEntryResponse struct {
+	ID          int    `json:"id"`
 	ServiceName string `json:"serviceName"`
 	Username    string `json:"username"`
-	Password    string `json:"password"`
-	Notes       string `json:"notes"`
-}
\ No newline at end of file
+	DeletedAt   string `json:"deletedAt"`
+	PurgeAt     string `json:"purgeAt"`
+}
+
+// PasswordStrengthResponse is the strength check the setup screen shows while a
+// master password is chosen
+type PasswordStrengthResponse struct {
+	Score      int      `json:"score"`
+	MaxScore   int      `json:"maxScore"`
+	MinScore   int      `json:"minScore"`
+	Acceptable bool     `json:"acceptable"`
+	Feedback   []string `json:"feedback"`
+}
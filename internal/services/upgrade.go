@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"svimpass/internal/crypto"
+)
+
+// upgradeBatchSize is the number of entries re-encrypted per transaction
+const upgradeBatchSize = 50
+
+// ciphertextUpgrade is a running background re-encryption
+type ciphertextUpgrade struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startUpgrade re-encrypts legacy blobs and envelopes of another cipher in the
+// background, replacing any upgrade that is still running
+func (ps *PasswordService) startUpgrade(encKey *crypto.EncryptionKey) {
+	ps.upgradeMu.Lock()
+	defer ps.upgradeMu.Unlock()
+
+	ps.cancelUpgrade()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	upgrade := &ciphertextUpgrade{cancel: cancel, done: make(chan struct{})}
+	ps.upgrade = upgrade
+
+	go func() {
+		defer close(upgrade.done)
+
+		upgraded, err := ps.db.UpgradeCiphertexts(upgradeBatchSize, func(entryID int, field string, ciphertext []byte) ([]byte, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if !encKey.NeedsUpgrade(ciphertext) {
+				return nil, nil
+			}
+
+			plaintext, err := encKey.DecryptField(ciphertext, entryID, field)
+			if err != nil {
+				return nil, err
+			}
+			return encKey.EncryptField(plaintext, entryID, field)
+		}, func(lastID int) {
+			// Upgraded entries hold envelopes only from here on
+			encKey.LegacyUpgraded(lastID)
+		})
+		if err == nil {
+			encKey.RefuseLegacy()
+		}
+
+		if upgraded > 0 {
+			fmt.Printf("Upgraded the encryption of %d password entries\n", upgraded)
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Printf("Warning: failed to upgrade the encryption of password entries: %v\n", err)
+		}
+	}()
+}
+
+// restrictLegacy runs first on unlock: the vault key only accepts legacy blobs
+// for the entries an upgrade has not rewritten yet, and none once it finished
+func (ps *PasswordService) restrictLegacy(encKey *crypto.EncryptionKey) error {
+	pending, upgradedThrough, err := ps.db.LegacyCiphertexts()
+	if err != nil {
+		return err
+	}
+
+	if pending {
+		encKey.AllowLegacy(upgradedThrough)
+	} else {
+		encKey.RefuseLegacy()
+	}
+	return nil
+}
+
+// stopUpgrade cancels a running upgrade and waits for it, so the vault key is
+// never dropped while it is still in use
+func (ps *PasswordService) stopUpgrade() {
+	ps.upgradeMu.Lock()
+	defer ps.upgradeMu.Unlock()
+
+	ps.cancelUpgrade()
+}
+
+// cancelUpgrade stops the running upgrade, the caller holds upgradeMu
+func (ps *PasswordService) cancelUpgrade() {
+	if ps.upgrade == nil {
+		return
+	}
+	ps.upgrade.cancel()
+	<-ps.upgrade.done
+	ps.upgrade = nil
+}
@@ -0,0 +1,14 @@
+// Package session watches the desktop session and locks the vault when the
+// system is about to suspend or the session is locked
+package session
+
+// Watcher delivers session events until it is stopped
+type Watcher interface {
+	// Stop unsubscribes from the session events
+	Stop()
+}
+
+// Watch calls onLock whenever the system prepares to sleep or the session is locked
+func Watch(onLock func()) (Watcher, error) {
+	return watchPlatform(onLock)
+}
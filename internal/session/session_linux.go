@@ -0,0 +1,120 @@
+//go:build linux
+
+package session
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	logindService   = "org.freedesktop.login1"
+	logindPath      = dbus.ObjectPath("/org/freedesktop/login1")
+	logindManager   = "org.freedesktop.login1.Manager"
+	logindSession   = "org.freedesktop.login1.Session"
+	prepareForSleep = "PrepareForSleep"
+	sessionLock     = "Lock"
+)
+
+// logindWatcher listens to logind on the system bus
+type logindWatcher struct {
+	conn    *dbus.Conn
+	signals chan *dbus.Signal
+	done    chan struct{}
+}
+
+// watchPlatform subscribes to logind PrepareForSleep and to the Lock signal of
+// the session svimpass runs in. Without a session only suspend is watched.
+func watchPlatform(onLock func()) (Watcher, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the system bus: %w", err)
+	}
+
+	err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(logindPath),
+		dbus.WithMatchInterface(logindManager),
+		dbus.WithMatchMember(prepareForSleep),
+	)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", prepareForSleep, err)
+	}
+
+	sessionPath, err := currentSession(conn)
+	if err != nil {
+		fmt.Printf("Warning: session lock is not watched, %v\n", err)
+	} else {
+		err = conn.AddMatchSignal(
+			dbus.WithMatchObjectPath(sessionPath),
+			dbus.WithMatchInterface(logindSession),
+			dbus.WithMatchMember(sessionLock),
+		)
+		if err != nil {
+			fmt.Printf("Warning: failed to subscribe to the session %s signal: %v\n", sessionLock, err)
+		}
+	}
+
+	watcher := &logindWatcher{
+		conn:    conn,
+		signals: make(chan *dbus.Signal, 8),
+		done:    make(chan struct{}),
+	}
+	conn.Signal(watcher.signals)
+	go watcher.run(sessionPath, onLock)
+
+	return watcher, nil
+}
+
+// currentSession returns the logind session object of this process, falling back
+// to the caller's display session for processes started outside of one
+func currentSession(conn *dbus.Conn) (dbus.ObjectPath, error) {
+	manager := conn.Object(logindService, logindPath)
+
+	var path dbus.ObjectPath
+	err := manager.Call(logindManager+".GetSessionByPID", 0, uint32(os.Getpid())).Store(&path)
+	if err == nil {
+		return path, nil
+	}
+
+	if err := manager.Call(logindManager+".GetSession", 0, "auto").Store(&path); err != nil {
+		return "", fmt.Errorf("no logind session found: %w", err)
+	}
+	return path, nil
+}
+
+func (w *logindWatcher) run(sessionPath dbus.ObjectPath, onLock func()) {
+	for {
+		select {
+		case <-w.done:
+			return
+		case signal, ok := <-w.signals:
+			if !ok {
+				return
+			}
+
+			switch signal.Name {
+			case logindManager + "." + prepareForSleep:
+				// The signal is sent with true before sleeping and false after resuming
+				if len(signal.Body) == 1 {
+					if sleeping, ok := signal.Body[0].(bool); ok && sleeping {
+						onLock()
+					}
+				}
+			case logindSession + "." + sessionLock:
+				if signal.Path == sessionPath {
+					onLock()
+				}
+			}
+		}
+	}
+}
+
+// Stop unsubscribes from logind and closes the bus connection
+func (w *logindWatcher) Stop() {
+	close(w.done)
+	w.conn.RemoveSignal(w.signals)
+	w.conn.Close()
+}
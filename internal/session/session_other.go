@@ -0,0 +1,13 @@
+//go:build !linux
+
+package session
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// watchPlatform reports session watching as unavailable, the idle timer still locks the vault
+func watchPlatform(onLock func()) (Watcher, error) {
+	return nil, fmt.Errorf("session lock and suspend events are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,335 @@
+// Package strength estimates how hard a master password is to guess, using an
+// embedded list of common passwords and detection of predictable patterns
+package strength
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxScore is the score of a strong password
+	MaxScore = 4
+	// DefaultMinScore is the score a master password needs unless configured otherwise
+	DefaultMinScore = 3
+	// minLength is the length below which a password is always too short
+	minLength = 8
+)
+
+// Feedback messages, the setup screen shows them as they are
+const (
+	FeedbackTooShort  = "too short, use at least 8 characters"
+	FeedbackCommon    = "contains a common password or word"
+	FeedbackSequence  = "contains a sequence like abc or 123"
+	FeedbackKeyboard  = "contains a keyboard pattern like qwerty"
+	FeedbackRepeated  = "contains repeated characters"
+	FeedbackYear      = "contains a year"
+	FeedbackOneClass  = "uses a single kind of character"
+	FeedbackAddLength = "add more characters or words"
+)
+
+// Every score above 0 needs scoreBitsPerStep more bits than the one below it,
+// starting at scoreBitsThreshold for a score of 1
+const (
+	scoreBitsThreshold = 28
+	scoreBitsPerStep   = 14
+)
+
+//go:embed common.txt
+var commonList string
+
+// common maps every common password to its rank, 1 being the most frequent
+var common = parseCommon(commonList)
+
+// keyboardRows are the rows whose runs count as keyboard patterns, in both directions
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm", "qwertzuiop", "azertyuiop"}
+
+// leet undoes the substitutions commonly used to disguise words
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i", "+", "t")
+
+// Result is the strength estimate of a password
+type Result struct {
+	Score    int      `json:"score"`    // 0 (very weak) to MaxScore (strong)
+	Entropy  float64  `json:"entropy"`  // estimated bits of guessing entropy
+	Feedback []string `json:"feedback"` // what makes the password weak, empty for strong ones
+}
+
+// Acceptable reports whether the password reaches minScore
+func (r Result) Acceptable(minScore int) bool {
+	return r.Score >= minScore
+}
+
+// WeakError is returned when a password does not reach the required score
+type WeakError struct {
+	Result   Result
+	MinScore int
+}
+
+func (e *WeakError) Error() string {
+	return fmt.Sprintf("master password too weak (score %d of %d, %d required): %s",
+		e.Result.Score, MaxScore, e.MinScore, strings.Join(e.Result.Feedback, ", "))
+}
+
+// Require returns a WeakError when password scores below minScore
+func Require(password string, minScore int) error {
+	result := Check(password)
+	if !result.Acceptable(minScore) {
+		return &WeakError{Result: result, MinScore: minScore}
+	}
+	return nil
+}
+
+// Check estimates the strength of password. Predictable parts such as common
+// words, sequences, keyboard runs, repeats and years are charged a few bits
+// each, the remaining characters the bits of their character classes.
+func Check(password string) Result {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return Result{Feedback: []string{FeedbackTooShort}}
+	}
+
+	lower := []rune(strings.ToLower(password))
+	covered := make([]bool, len(runes))
+	feedback := newFeedback()
+	var bits float64
+
+	bits += matchCommon(lower, covered, feedback)
+	bits += matchKeyboard(lower, covered, feedback)
+	bits += matchSequences(lower, covered, feedback)
+	bits += matchRepeats(lower, covered, feedback)
+	bits += matchYears(lower, covered, feedback)
+
+	pool, classes := charsetSize(runes)
+	for i := range runes {
+		if !covered[i] {
+			bits += math.Log2(float64(pool))
+		}
+	}
+
+	score := 0
+	for threshold := float64(scoreBitsThreshold); bits >= threshold && score < MaxScore; threshold += scoreBitsPerStep {
+		score++
+	}
+
+	if len(runes) < minLength {
+		feedback.add(FeedbackTooShort)
+		score = min(score, 1)
+	}
+	if classes == 1 && score < MaxScore {
+		feedback.add(FeedbackOneClass)
+	}
+	if score == MaxScore {
+		// Strong despite a predictable part, as in a passphrase with a common word
+		feedback.items = []string{}
+	} else if len(feedback.items) == 0 {
+		feedback.add(FeedbackAddLength)
+	}
+
+	return Result{Score: score, Entropy: math.Round(bits*10) / 10, Feedback: feedback.items}
+}
+
+// matchCommon charges common passwords by their rank, also when disguised with
+// substitutions like p@ssw0rd. Short words only count as the whole password.
+func matchCommon(lower []rune, covered []bool, feedback *feedbackSet) float64 {
+	var bits float64
+	for _, candidate := range []string{string(lower), leet.Replace(string(lower)), strings.ReplaceAll(leet.Replace(string(lower)), "i", "l")} {
+		text := []rune(candidate)
+		if len(text) != len(lower) {
+			continue
+		}
+
+		// Longest matches first, so "password1" is not split into "password" and "1"
+		for length := len(text); length >= 3; length-- {
+			if length < 4 && length != len(text) {
+				break
+			}
+			for start := 0; start+length <= len(text); start++ {
+				rank, ok := common[string(text[start:start+length])]
+				if !ok || !uncovered(covered, start, length) {
+					continue
+				}
+				cover(covered, start, length)
+				// One extra bit for capitalization or substitutions
+				bits += math.Log2(float64(rank)) + 1
+				feedback.add(FeedbackCommon)
+			}
+		}
+	}
+	return bits
+}
+
+// matchKeyboard charges runs of at least four keys along a keyboard row
+func matchKeyboard(lower []rune, covered []bool, feedback *feedbackSet) float64 {
+	var bits float64
+	for _, row := range keyboardRows {
+		for _, pattern := range []string{row, reverse(row)} {
+			bits += matchRuns(lower, covered, 4, func(start, length int) bool {
+				return strings.Contains(pattern, string(lower[start:start+length]))
+			}, func(length int) float64 {
+				return math.Log2(float64(len(keyboardRows)*2*len(row))) + math.Log2(float64(length))
+			}, FeedbackKeyboard, feedback)
+		}
+	}
+	return bits
+}
+
+// matchSequences charges ascending or descending runs like abcd or 4321
+func matchSequences(lower []rune, covered []bool, feedback *feedbackSet) float64 {
+	return matchRuns(lower, covered, 3, func(start, length int) bool {
+		step := lower[start+1] - lower[start]
+		if step != 1 && step != -1 {
+			return false
+		}
+		for i := start + 1; i < start+length; i++ {
+			if lower[i]-lower[i-1] != step {
+				return false
+			}
+		}
+		return true
+	}, func(length int) float64 {
+		return math.Log2(26*2) + math.Log2(float64(length))
+	}, FeedbackSequence, feedback)
+}
+
+// matchRepeats charges a character repeated three times or more, like aaa
+func matchRepeats(lower []rune, covered []bool, feedback *feedbackSet) float64 {
+	return matchRuns(lower, covered, 3, func(start, length int) bool {
+		for i := start + 1; i < start+length; i++ {
+			if lower[i] != lower[start] {
+				return false
+			}
+		}
+		return true
+	}, func(length int) float64 {
+		return math.Log2(95) + math.Log2(float64(length))
+	}, FeedbackRepeated, feedback)
+}
+
+// matchYears charges four digit years from 1900 to 2099
+func matchYears(lower []rune, covered []bool, feedback *feedbackSet) float64 {
+	return matchRuns(lower, covered, 4, func(start, length int) bool {
+		if length != 4 {
+			return false
+		}
+		year := string(lower[start : start+4])
+		return (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) &&
+			unicode.IsDigit(rune(year[2])) && unicode.IsDigit(rune(year[3]))
+	}, func(length int) float64 {
+		return math.Log2(200)
+	}, FeedbackYear, feedback)
+}
+
+// matchRuns covers the longest uncovered runs of at least minRun characters that
+// match, charging each with cost
+func matchRuns(lower []rune, covered []bool, minRun int, match func(start, length int) bool, cost func(length int) float64, message string, feedback *feedbackSet) float64 {
+	var bits float64
+	for start := 0; start+minRun <= len(lower); start++ {
+		best := 0
+		for length := minRun; start+length <= len(lower); length++ {
+			if !uncovered(covered, start, length) || !match(start, length) {
+				break
+			}
+			best = length
+		}
+		if best == 0 {
+			continue
+		}
+		cover(covered, start, best)
+		bits += cost(best)
+		feedback.add(message)
+		start += best - 1
+	}
+	return bits
+}
+
+// charsetSize returns the number of characters an attacker has to try per
+// position, given the character classes password uses, and the class count
+func charsetSize(runes []rune) (int, int) {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool, classes := 0, 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+			classes++
+		}
+	}
+	return pool, classes
+}
+
+func parseCommon(list string) map[string]int {
+	ranks := make(map[string]int)
+	rank := 0
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rank++
+		if _, ok := ranks[line]; !ok {
+			ranks[line] = rank
+		}
+	}
+	return ranks
+}
+
+func uncovered(covered []bool, start, length int) bool {
+	for i := start; i < start+length; i++ {
+		if covered[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func cover(covered []bool, start, length int) {
+	for i := start; i < start+length; i++ {
+		covered[i] = true
+	}
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// feedbackSet collects feedback messages once each, in the order they were found
+type feedbackSet struct {
+	items []string
+}
+
+func newFeedback() *feedbackSet {
+	return &feedbackSet{items: []string{}}
+}
+
+func (f *feedbackSet) add(message string) {
+	for _, item := range f.items {
+		if item == message {
+			return
+		}
+	}
+	f.items = append(f.items, message)
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 
+	"svimpass/internal/hardening"
 	"svimpass/internal/paths"
 
 	"github.com/wailsapp/wails/v2"
@@ -34,9 +35,16 @@ func main() {
 		return
 	}
 
+	// Keep the vault key out of core dumps, swap and debuggers before it is ever derived
+	security := hardening.Apply()
+	for _, protection := range security.Warnings() {
+		fmt.Printf("Warning: %s\n", protection)
+	}
+
 	// Create an instance of the app structure
 	app := NewApp()
 	app.paths = appPaths
+	app.security = security
 
 	// Start socket listener for toggle commands
 	go startSocketListener(app, appPaths)
@@ -12,7 +12,7 @@ go mod tidy
 
 # Build for macOS
 echo "Running wails build for macOS..."
-GOOS=darwin GOARCH=amd64 wails build -tags "desktop,production,darwin"
+GOOS=darwin GOARCH=amd64 wails build -tags "desktop,production,darwin,sqlite_fts5"
 
 echo "macOS build completed successfully!"
 echo "Binary location: build/bin/svimpass.app"
@@ -16,7 +16,7 @@ go clean -modcache || true
 
 # Build for Linux
 echo "Running wails build for Linux..."
-GOOS=linux GOARCH=amd64 wails build -tags "desktop,production,linux"
+GOOS=linux GOARCH=amd64 wails build -tags "desktop,production,linux,sqlite_fts5"
 
 # Restore original go.mod
 mv go.mod.backup go.mod
@@ -12,7 +12,7 @@ go mod tidy
 
 # Build for Windows
 echo "Running wails build for Windows..."
-GOOS=windows GOARCH=amd64 wails build -tags "desktop,production,windows"
+GOOS=windows GOARCH=amd64 wails build -tags "desktop,production,windows,sqlite_fts5"
 
 echo "Windows build completed successfully!"
 echo "Binary location: build/bin/svimpass.exe"